@@ -48,6 +48,15 @@ var (
 	VaultConfigGroupVersionKind = SchemeGroupVersion.WithKind(VaultConfigKind)
 )
 
+// VaultNamespacedConfig type metadata.
+var (
+	VaultNamespacedConfigKind             = reflect.TypeOf(VaultNamespacedConfig{}).Name()
+	VaultNamespacedConfigGroupKind        = schema.GroupKind{Group: Group, Kind: VaultNamespacedConfigKind}.String()
+	VaultNamespacedConfigKindAPIVersion   = VaultNamespacedConfigKind + "." + SchemeGroupVersion.String()
+	VaultNamespacedConfigGroupVersionKind = SchemeGroupVersion.WithKind(VaultNamespacedConfigKind)
+)
+
 func init() {
 	SchemeBuilder.Register(&VaultConfig{}, &VaultConfigList{})
+	SchemeBuilder.Register(&VaultNamespacedConfig{}, &VaultNamespacedConfigList{})
 }
@@ -27,17 +27,45 @@ import (
 // VaultConfig is the CRD type for External Vault Config.
 // +kubebuilder:subresource:status
 // +kubebuilder:storageversion
+// +kubebuilder:printcolumn:name="SERVER",type="string",JSONPath=".status.server"
+// +kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
 // +kubebuilder:resource:scope=Cluster,categories={crossplane,pkg}
 type VaultConfig struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
-	Spec *VaultConfigSpec `json:"spec,omitempty"`
+	Spec   *VaultConfigSpec  `json:"spec,omitempty"`
+	Status VaultConfigStatus `json:"status,omitempty"`
 }
 
+// A VaultServerURL is the url of a Vault server.
+// +kubebuilder:validation:MaxLength=2048
+type VaultServerURL string
+
+// VaultConfigSpec defines the desired configuration of Vault.
+// +kubebuilder:validation:XValidation:rule="has(self.server) != has(self.servers)",message="exactly one of server or servers is required"
+// +kubebuilder:validation:XValidation:rule="!has(self.server) || self.server.matches('^(https?|unix)://')",message="server must be an http, https or unix URL"
+// +kubebuilder:validation:XValidation:rule="!has(self.servers) || self.servers.all(s, s.matches('^https?://'))",message="servers must be http or https URLs"
+// +kubebuilder:validation:XValidation:rule="!self.mountPath.startsWith('/')",message="mountPath must not start with a slash"
+// +kubebuilder:validation:XValidation:rule="self.auth.method != 'Token' || has(self.auth.token)",message="auth.token is required for Token auth"
+// +kubebuilder:validation:XValidation:rule="self.auth.method != 'Kubernetes' || has(self.auth.kubernetes)",message="auth.kubernetes is required for Kubernetes auth"
 type VaultConfigSpec struct {
-	// Server is the url of the Vault server, e.g. "https://vault.acme.org"
-	Server string `json:"server"`
+	// Server is the url of the Vault server, e.g. "https://vault.acme.org",
+	// or of the unix socket of a Vault Agent or Vault Proxy listener, e.g.
+	// "unix:///var/run/vault/agent.sock". Either server or servers is
+	// required.
+	// +optional
+	// +kubebuilder:validation:MaxLength=2048
+	Server string `json:"server,omitempty"`
+
+	// Servers are the urls of the nodes or endpoints of a Vault cluster, in
+	// order of preference. Their health is checked periodically, and the
+	// first active server is used, or else the first standby. Requests fail
+	// over to the next server if the used one is unreachable or sealed.
+	// +optional
+	// +kubebuilder:validation:MinItems=1
+	// +kubebuilder:validation:MaxItems=16
+	Servers []VaultServerURL `json:"servers,omitempty"`
 
 	// Namesoace is the Namespace of vault on which to operate
 	Namespace *string `json:"namespace,omitempty"`
@@ -49,6 +77,7 @@ type VaultConfigSpec struct {
 	// https://www.vaultproject.io/docs/secrets/kv
 	// +optional
 	// +kubebuilder:default=v2
+	// +kubebuilder:validation:Enum=v1;v2
 	Version *VaultKVVersion `json:"version,omitempty"`
 
 	// CABundle configures CA bundle for Vault Server.
@@ -57,6 +86,159 @@ type VaultConfigSpec struct {
 
 	// Auth configures an authentication method for Vault.
 	Auth VaultAuthConfig `json:"auth"`
+
+	// DeletionPolicy configures how secrets are deleted from a KV Secrets
+	// Engine Version 2. It is ignored for Version 1, where deletions are
+	// always permanent.
+	// +optional
+	DeletionPolicy *VaultDeletionPolicy `json:"deletionPolicy,omitempty"`
+
+	// SecretMetadata configures the metadata settings applied to secrets
+	// written to a KV Secrets Engine Version 2. It is ignored for Version 1.
+	// +optional
+	SecretMetadata *VaultSecretMetadataConfig `json:"secretMetadata,omitempty"`
+
+	// WriteStrategy configures how secrets are written to a KV Secrets Engine
+	// Version 2. It is ignored for Version 1.
+	// +optional
+	WriteStrategy *VaultWriteStrategy `json:"writeStrategy,omitempty"`
+
+	// ResponseWrapping configures secrets to be read as response-wrapped
+	// tokens, so that their values never traverse the network in plain. It
+	// cannot be combined with Transit, KeyMapping or the JSON and Nested
+	// layouts, since consumers unwrap secrets as they are stored.
+	// https://developer.hashicorp.com/vault/docs/concepts/response-wrapping
+	// +optional
+	ResponseWrapping *VaultResponseWrappingConfig `json:"responseWrapping,omitempty"`
+
+	// Transit configures secret values to be encrypted with the Transit
+	// Secrets Engine before being stored, so that reading them requires
+	// access to the encryption key in addition to the KV mount.
+	// https://developer.hashicorp.com/vault/docs/secrets/transit
+	// +optional
+	Transit *VaultTransitConfig `json:"transit,omitempty"`
+
+	// Mirror configures writes and deletions of secrets to be mirrored to the
+	// secrets engine of another config, e.g. while migrating to another Vault
+	// cluster.
+	// +optional
+	Mirror *VaultMirrorConfig `json:"mirror,omitempty"`
+
+	// Routing configures secrets to be stored in other mounts or Vault
+	// namespaces depending on their scope or labels.
+	// +optional
+	Routing *VaultRoutingConfig `json:"routing,omitempty"`
+
+	// KeyMapping configures the keys of connection secrets to be stored under
+	// other names in Vault, e.g. for consumers reading them directly. Keys
+	// are mapped back when secrets are read.
+	// +optional
+	KeyMapping *VaultKeyMapping `json:"keyMapping,omitempty"`
+
+	// Layout configures how the keys of connection secrets are laid out in
+	// the data of Vault secrets.
+	// +optional
+	// +kubebuilder:validation:Enum=Flat;JSON;Nested
+	// +kubebuilder:default=Flat
+	Layout VaultSecretLayout `json:"layout,omitempty"`
+
+	// LayoutKey is the key holding the JSON document of the JSON and Nested
+	// layouts.
+	// +optional
+	// +kubebuilder:default=connection
+	LayoutKey string `json:"layoutKey,omitempty"`
+
+	// RateLimit configures the rate and concurrency of the requests the
+	// plugin serves with this config, so that bursts of requests, e.g. after
+	// a restart of Crossplane, do not exceed the rate limit quotas of Vault.
+	// +optional
+	RateLimit *VaultRateLimit `json:"rateLimit,omitempty"`
+}
+
+// VaultServerState represents the state of a Vault server, as reported by its
+// health endpoint.
+// https://developer.hashicorp.com/vault/api-docs/system/health
+type VaultServerState string
+
+const (
+	// VaultServerActive indicates that the server is the active node of its
+	// cluster.
+	VaultServerActive VaultServerState = "Active"
+
+	// VaultServerStandby indicates that the server is a standby node, which
+	// forwards requests to the active node.
+	VaultServerStandby VaultServerState = "Standby"
+
+	// VaultServerSealed indicates that the server is sealed.
+	VaultServerSealed VaultServerState = "Sealed"
+
+	// VaultServerUnavailable indicates that the server cannot serve requests,
+	// e.g. because it is not initialized or a disaster recovery secondary.
+	VaultServerUnavailable VaultServerState = "Unavailable"
+
+	// VaultServerUnreachable indicates that the server could not be reached.
+	VaultServerUnreachable VaultServerState = "Unreachable"
+)
+
+// VaultServerStatus represents the observed state of a Vault server.
+type VaultServerStatus struct {
+	// Address of the server.
+	Address string `json:"address"`
+
+	// State of the server.
+	State VaultServerState `json:"state"`
+
+	// LastTransitionTime is the last time the state changed.
+	// +optional
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+}
+
+// VaultConfigStatus represents the observed state of a Vault config.
+type VaultConfigStatus struct {
+	// Server is the url of the server the plugin currently uses, if the
+	// config has multiple servers.
+	// +optional
+	Server string `json:"server,omitempty"`
+
+	// Servers is the observed state of the servers of the config.
+	// +optional
+	Servers []VaultServerStatus `json:"servers,omitempty"`
+}
+
+// VaultDeletionMode represents how a secret is deleted from a KV Secrets
+// Engine Version 2.
+type VaultDeletionMode string
+
+const (
+	// VaultDeletionDestroy indicates that the metadata and all versions of a
+	// secret are permanently deleted.
+	// https://developer.hashicorp.com/vault/api-docs/secret/kv/kv-v2#delete-metadata-and-all-versions
+	VaultDeletionDestroy VaultDeletionMode = "Destroy"
+
+	// VaultDeletionSoftDelete indicates that only the latest version of a
+	// secret is deleted, keeping its history so that it can be undeleted.
+	// https://developer.hashicorp.com/vault/api-docs/secret/kv/kv-v2#delete-latest-version-of-secret
+	VaultDeletionSoftDelete VaultDeletionMode = "SoftDelete"
+
+	// VaultDeletionDestroyAfter indicates that the latest version of a secret
+	// is soft deleted, and that the metadata and all versions of the secret
+	// are permanently deleted by the plugin once the configured retention
+	// period elapsed, unless the secret is written again in the meantime.
+	VaultDeletionDestroyAfter VaultDeletionMode = "DestroyAfter"
+)
+
+// VaultDeletionPolicy configures how secrets are deleted from Vault.
+// +kubebuilder:validation:XValidation:rule="self.mode != 'DestroyAfter' || has(self.destroyAfter)",message="destroyAfter is required for DestroyAfter mode"
+type VaultDeletionPolicy struct {
+	// Mode of the deletion.
+	// +kubebuilder:validation:Enum=Destroy;SoftDelete;DestroyAfter
+	// +kubebuilder:default=Destroy
+	Mode VaultDeletionMode `json:"mode"`
+
+	// DestroyAfter is the retention period after which a deleted secret is
+	// permanently deleted, e.g. "720h". Required if mode is DestroyAfter.
+	// +optional
+	DestroyAfter *metav1.Duration `json:"destroyAfter,omitempty"`
 }
 
 // VaultAuthMethod represent a Vault authentication method.
@@ -72,6 +254,10 @@ const (
 	// authenticate to Vault.
 	// https://developer.hashicorp.com/vault/docs/auth/kubernetes
 	VaultAuthKubernetes VaultAuthMethod = "Kubernetes"
+	// VaultAuthAgent indicates that a Vault Agent or Vault Proxy will
+	// authenticate requests, typically with its auto-auth token.
+	// https://developer.hashicorp.com/vault/docs/agent-and-proxy/autoauth
+	VaultAuthAgent VaultAuthMethod = "Agent"
 )
 
 // VaultAuthTokenConfig represents configuration for Vault Token Auth Method.
@@ -116,9 +302,21 @@ type VaultAuthKubernetesConfig struct {
 	ServiceAccountTokenSource *ServiceAccountTokenSourceConfig `json:"serviceAccountTokenSource,omitempty"`
 }
 
+// VaultAuthAgentConfig represents configuration for authenticating through a
+// Vault Agent or Vault Proxy.
+type VaultAuthAgentConfig struct {
+	// TokenPath is the path of a file sink of the agent's auto-auth token,
+	// which is sent with every request. If empty, requests are sent without a
+	// token, and the agent must be configured to use its auto-auth token,
+	// i.e. with use_auto_auth_token.
+	// +optional
+	TokenPath string `json:"tokenPath,omitempty"`
+}
+
 // VaultAuthConfig required to authenticate to a Vault API.
 type VaultAuthConfig struct {
 	// Method configures which auth method will be used.
+	// +kubebuilder:validation:Enum=Token;Kubernetes;Agent
 	Method VaultAuthMethod `json:"method"`
 	// Token configures Token Auth for Vault.
 	// +optional
@@ -126,6 +324,9 @@ type VaultAuthConfig struct {
 	// Kubernetes configes Kubernetes Auth for Vault
 	// +optional
 	Kubernetes *VaultAuthKubernetesConfig `json:"kubernetes,omitempty"`
+	// Agent configures authenticating through a Vault Agent or Vault Proxy.
+	// +optional
+	Agent *VaultAuthAgentConfig `json:"agent,omitempty"`
 }
 
 // VaultCABundleConfig represents configuration for configuring a CA bundle.
@@ -139,6 +340,308 @@ type VaultCABundleConfig struct {
 	v1.CommonCredentialSelectors `json:",inline"`
 }
 
+// VaultSecretMetadataSettings represents metadata settings of a secret in a
+// KV Secrets Engine Version 2. Unset fields fall back to the configuration of
+// the KV mount.
+// https://developer.hashicorp.com/vault/api-docs/secret/kv/kv-v2#create-update-metadata
+type VaultSecretMetadataSettings struct {
+	// MaxVersions is the number of versions to keep per secret.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MaxVersions *int `json:"maxVersions,omitempty"`
+
+	// CASRequired requires the "cas" parameter for all writes to the secret.
+	// +optional
+	CASRequired *bool `json:"casRequired,omitempty"`
+
+	// DeleteVersionAfter is the duration after which new versions of the
+	// secret are deleted, e.g. "720h".
+	// +optional
+	DeleteVersionAfter *metav1.Duration `json:"deleteVersionAfter,omitempty"`
+}
+
+// VaultScopedSecretMetadataSettings represents metadata settings applied to
+// secrets in a given scope.
+type VaultScopedSecretMetadataSettings struct {
+	// Scope of the secrets these settings apply to, e.g. "crossplane-system".
+	Scope string `json:"scope"`
+
+	// VaultSecretMetadataSettings overrides the default settings for the
+	// secrets in this scope.
+	VaultSecretMetadataSettings `json:",inline"`
+}
+
+// VaultSecretMetadataConfig represents configuration for the metadata of
+// secrets written to a KV Secrets Engine Version 2.
+type VaultSecretMetadataConfig struct {
+	// VaultSecretMetadataSettings are the default settings applied to all
+	// secrets.
+	VaultSecretMetadataSettings `json:",inline"`
+
+	// Scopes overrides the default settings for secrets in given scopes. The
+	// first matching scope wins. Cannot be combined with routes with a
+	// PathTemplate.
+	// +optional
+	Scopes []VaultScopedSecretMetadataSettings `json:"scopes,omitempty"`
+}
+
+// VaultWriteStrategy represents configuration for writing secrets to a KV
+// Secrets Engine Version 2.
+type VaultWriteStrategy struct {
+	// Patch configures existing secrets to be updated with JSON merge patches,
+	// which only send the changed keys and hence do not conflict with
+	// concurrent writers. Requires Vault 1.9+ and the "patch" capability,
+	// otherwise check-and-set writes are used.
+	// https://developer.hashicorp.com/vault/api-docs/secret/kv/kv-v2#patch-secret
+	// +optional
+	Patch bool `json:"patch,omitempty"`
+
+	// MaxCASRetries is the number of times a write rejected because of a
+	// check-and-set conflict with a concurrent writer is retried.
+	// +optional
+	// +kubebuilder:default=3
+	// +kubebuilder:validation:Minimum=0
+	MaxCASRetries *int `json:"maxCASRetries,omitempty"`
+}
+
+// VaultRateLimit represents configuration for limiting the requests served
+// with a config. Requests exceeding the limits are queued until they can be
+// served or their queue timeout passes.
+type VaultRateLimit struct {
+	// RequestsPerSecond is the sustained number of requests per second. Zero
+	// does not limit the rate.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	RequestsPerSecond int `json:"requestsPerSecond,omitempty"`
+
+	// Burst is the number of requests that may be served at once above the
+	// sustained rate. Defaults to RequestsPerSecond.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	Burst int `json:"burst,omitempty"`
+
+	// MaxInFlight is the number of requests that may be served concurrently.
+	// Zero does not limit concurrency. Requests in flight when MaxInFlight
+	// changes are not counted against the new limit.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MaxInFlight int `json:"maxInFlight,omitempty"`
+
+	// QueueTimeout is the longest time a request is queued, e.g. "10s".
+	// Requests are also not queued beyond their own deadline.
+	// +optional
+	// +kubebuilder:default="10s"
+	QueueTimeout *metav1.Duration `json:"queueTimeout,omitempty"`
+}
+
+// VaultResponseWrappingConfig represents configuration for reading secrets as
+// response-wrapped tokens.
+type VaultResponseWrappingConfig struct {
+	// TTL of the wrapping token, e.g. "5m".
+	// +optional
+	// +kubebuilder:default="5m"
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+
+	// Key under which the wrapping token is returned instead of the secret
+	// values.
+	// +optional
+	// +kubebuilder:default=wrappingToken
+	Key string `json:"key,omitempty"`
+}
+
+// VaultTransitContext represents the context used to derive the encryption
+// key of a secret.
+type VaultTransitContext string
+
+const (
+	// VaultTransitContextNone indicates that no context is used, i.e. the
+	// encryption key is not a derived key.
+	VaultTransitContextNone VaultTransitContext = "None"
+
+	// VaultTransitContextScopedName indicates that the scope and name of a
+	// secret is used as the context to derive its encryption key.
+	VaultTransitContextScopedName VaultTransitContext = "ScopedName"
+)
+
+// VaultTransitConfig represents configuration for encrypting secret values
+// with the Transit Secrets Engine.
+type VaultTransitConfig struct {
+	// MountPath of the Transit Secrets Engine.
+	// +optional
+	// +kubebuilder:default=transit
+	MountPath string `json:"mountPath,omitempty"`
+
+	// Key is the name of the encryption key.
+	Key string `json:"key"`
+
+	// Context used to derive the encryption key. ScopedName requires the
+	// key to be created with derivation enabled.
+	// +optional
+	// +kubebuilder:validation:Enum=None;ScopedName
+	// +kubebuilder:default=None
+	Context VaultTransitContext `json:"context,omitempty"`
+}
+
+// VaultMirrorPolicy represents how failures to mirror a write or deletion are
+// handled.
+type VaultMirrorPolicy string
+
+const (
+	// VaultMirrorBestEffort indicates that failures to mirror are logged and
+	// counted, but do not fail the write or deletion.
+	VaultMirrorBestEffort VaultMirrorPolicy = "BestEffort"
+
+	// VaultMirrorStrict indicates that failures to mirror fail the write or
+	// deletion, after it was applied to the primary config.
+	VaultMirrorStrict VaultMirrorPolicy = "Strict"
+)
+
+// VaultMirrorConfig represents configuration for mirroring secrets to the
+// secrets engine of another config.
+type VaultMirrorConfig struct {
+	// Name of the config to mirror to. A VaultConfig mirrors to another
+	// VaultConfig, and a VaultNamespacedConfig to another VaultNamespacedConfig
+	// in its namespace. The mirror of the mirror, if any, is ignored.
+	Name string `json:"name"`
+
+	// Policy configures how failures to mirror are handled.
+	// +optional
+	// +kubebuilder:validation:Enum=BestEffort;Strict
+	// +kubebuilder:default=BestEffort
+	Policy VaultMirrorPolicy `json:"policy,omitempty"`
+
+	// ReadFallback configures secrets to be read from the mirror if they do
+	// not exist in the primary config, or if its server is unavailable.
+	// +optional
+	ReadFallback bool `json:"readFallback,omitempty"`
+}
+
+// VaultRoutingDefault represents where secrets not matched by any route are
+// stored.
+type VaultRoutingDefault string
+
+const (
+	// VaultRoutingDefaultConfig indicates that secrets not matched by any
+	// route are stored in the mount and namespace of the config.
+	VaultRoutingDefaultConfig VaultRoutingDefault = "Config"
+
+	// VaultRoutingDefaultReject indicates that requests for secrets not
+	// matched by any route fail.
+	VaultRoutingDefaultReject VaultRoutingDefault = "Reject"
+)
+
+// VaultRoutingConfig represents configuration for routing secrets to other
+// mounts or Vault namespaces.
+type VaultRoutingConfig struct {
+	// Routes are matched against secrets in order, and the first matching
+	// route is used.
+	// +kubebuilder:validation:MinItems=1
+	Routes []VaultRoute `json:"routes"`
+
+	// Default configures where secrets not matched by any route are stored.
+	// +optional
+	// +kubebuilder:validation:Enum=Config;Reject
+	// +kubebuilder:default=Config
+	Default VaultRoutingDefault `json:"default,omitempty"`
+}
+
+// VaultRoute represents a route of secrets to a mount or Vault namespace.
+type VaultRoute struct {
+	// Scope is a glob pattern matched against the scope of secrets, e.g.
+	// "team-*". All scopes match if empty.
+	// +optional
+	Scope string `json:"scope,omitempty"`
+
+	// MatchLabels are matched against the labels of secrets being written.
+	// Reads and deletions carry no labels, so they look a secret up in every
+	// route matching its scope, in order, until the first route without
+	// labels.
+	// +optional
+	MatchLabels map[string]string `json:"matchLabels,omitempty"`
+
+	// MountPath of the KV Secrets Engine. Defaults to the mountPath of the
+	// config. The mount must be of the same version.
+	// +optional
+	MountPath string `json:"mountPath,omitempty"`
+
+	// Namespace of Vault. Defaults to the namespace of the config.
+	// +optional
+	Namespace *string `json:"namespace,omitempty"`
+
+	// PathTemplate is a Go template of the path of secrets in the mount,
+	// with the fields .Scope and .Name, e.g. "crossplane/{{ .Scope }}/{{ .Name }}".
+	// Defaults to "{{ .Scope }}/{{ .Name }}".
+	// +optional
+	PathTemplate string `json:"pathTemplate,omitempty"`
+}
+
+// VaultSecretLayout represents how the keys of connection secrets are laid
+// out in the data of Vault secrets.
+type VaultSecretLayout string
+
+const (
+	// VaultSecretLayoutFlat indicates that every key is stored as a key of
+	// the Vault secret.
+	VaultSecretLayoutFlat VaultSecretLayout = "Flat"
+
+	// VaultSecretLayoutJSON indicates that all keys are stored in a JSON
+	// object under a single key of the Vault secret.
+	VaultSecretLayoutJSON VaultSecretLayout = "JSON"
+
+	// VaultSecretLayoutNested indicates that all keys are stored in a JSON
+	// object under a single key of the Vault secret, with dotted keys split
+	// into nested objects, e.g. "attribute.id" into {"attribute": {"id": ""}}.
+	VaultSecretLayoutNested VaultSecretLayout = "Nested"
+)
+
+// VaultKeyCase represents a case conversion of keys.
+type VaultKeyCase string
+
+const (
+	// VaultKeyCaseNone indicates that keys are not converted.
+	VaultKeyCaseNone VaultKeyCase = "None"
+
+	// VaultKeyCaseUpper indicates that keys are converted to upper case, and
+	// back to lower case when read.
+	VaultKeyCaseUpper VaultKeyCase = "Upper"
+
+	// VaultKeyCaseLower indicates that keys are converted to lower case, and
+	// back to upper case when read.
+	VaultKeyCaseLower VaultKeyCase = "Lower"
+)
+
+// VaultKeyMapping represents how the keys of connection secrets are named in
+// Vault. Mappings must be reversible, so writing a key whose mapped name does
+// not map back to it fails, e.g. "Password" with the Upper case, and keys in
+// Vault that do not map back to a key are ignored when reading.
+type VaultKeyMapping struct {
+	// Rename maps keys to the names they are stored under, e.g.
+	// "password: DB_PASSWORD". Renamed keys are neither converted nor
+	// prefixed.
+	// +optional
+	Rename map[string]string `json:"rename,omitempty"`
+
+	// Case converts the keys that are not renamed.
+	// +optional
+	// +kubebuilder:validation:Enum=None;Upper;Lower
+	// +kubebuilder:default=None
+	Case VaultKeyCase `json:"case,omitempty"`
+
+	// Prefix is prepended to the keys that are not renamed, after
+	// converting their case.
+	// +optional
+	Prefix string `json:"prefix,omitempty"`
+
+	// Include are glob patterns of the keys to store, e.g. "password". All
+	// keys are stored if empty.
+	// +optional
+	Include []string `json:"include,omitempty"`
+
+	// Exclude are glob patterns of the keys not to store, even if included.
+	// +optional
+	Exclude []string `json:"exclude,omitempty"`
+}
+
 // VaultKVVersion represent API version of the Vault KV engine
 // https://www.vaultproject.io/docs/secrets/kv
 type VaultKVVersion string
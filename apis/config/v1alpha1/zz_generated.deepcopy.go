@@ -22,6 +22,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -41,6 +42,21 @@ func (in *ServiceAccountTokenSourceConfig) DeepCopy() *ServiceAccountTokenSource
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultAuthAgentConfig) DeepCopyInto(out *VaultAuthAgentConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultAuthAgentConfig.
+func (in *VaultAuthAgentConfig) DeepCopy() *VaultAuthAgentConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultAuthAgentConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *VaultAuthConfig) DeepCopyInto(out *VaultAuthConfig) {
 	*out = *in
@@ -54,6 +70,11 @@ func (in *VaultAuthConfig) DeepCopyInto(out *VaultAuthConfig) {
 		*out = new(VaultAuthKubernetesConfig)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Agent != nil {
+		in, out := &in.Agent, &out.Agent
+		*out = new(VaultAuthAgentConfig)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultAuthConfig.
@@ -128,6 +149,7 @@ func (in *VaultConfig) DeepCopyInto(out *VaultConfig) {
 		*out = new(VaultConfigSpec)
 		(*in).DeepCopyInto(*out)
 	}
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultConfig.
@@ -183,6 +205,11 @@ func (in *VaultConfigList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *VaultConfigSpec) DeepCopyInto(out *VaultConfigSpec) {
 	*out = *in
+	if in.Servers != nil {
+		in, out := &in.Servers, &out.Servers
+		*out = make([]VaultServerURL, len(*in))
+		copy(*out, *in)
+	}
 	if in.Namespace != nil {
 		in, out := &in.Namespace, &out.Namespace
 		*out = new(string)
@@ -199,6 +226,51 @@ func (in *VaultConfigSpec) DeepCopyInto(out *VaultConfigSpec) {
 		(*in).DeepCopyInto(*out)
 	}
 	in.Auth.DeepCopyInto(&out.Auth)
+	if in.DeletionPolicy != nil {
+		in, out := &in.DeletionPolicy, &out.DeletionPolicy
+		*out = new(VaultDeletionPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SecretMetadata != nil {
+		in, out := &in.SecretMetadata, &out.SecretMetadata
+		*out = new(VaultSecretMetadataConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.WriteStrategy != nil {
+		in, out := &in.WriteStrategy, &out.WriteStrategy
+		*out = new(VaultWriteStrategy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ResponseWrapping != nil {
+		in, out := &in.ResponseWrapping, &out.ResponseWrapping
+		*out = new(VaultResponseWrappingConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Transit != nil {
+		in, out := &in.Transit, &out.Transit
+		*out = new(VaultTransitConfig)
+		**out = **in
+	}
+	if in.Mirror != nil {
+		in, out := &in.Mirror, &out.Mirror
+		*out = new(VaultMirrorConfig)
+		**out = **in
+	}
+	if in.Routing != nil {
+		in, out := &in.Routing, &out.Routing
+		*out = new(VaultRoutingConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.KeyMapping != nil {
+		in, out := &in.KeyMapping, &out.KeyMapping
+		*out = new(VaultKeyMapping)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RateLimit != nil {
+		in, out := &in.RateLimit, &out.RateLimit
+		*out = new(VaultRateLimit)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultConfigSpec.
@@ -210,3 +282,364 @@ func (in *VaultConfigSpec) DeepCopy() *VaultConfigSpec {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultConfigStatus) DeepCopyInto(out *VaultConfigStatus) {
+	*out = *in
+	if in.Servers != nil {
+		in, out := &in.Servers, &out.Servers
+		*out = make([]VaultServerStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultConfigStatus.
+func (in *VaultConfigStatus) DeepCopy() *VaultConfigStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultConfigStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultDeletionPolicy) DeepCopyInto(out *VaultDeletionPolicy) {
+	*out = *in
+	if in.DestroyAfter != nil {
+		in, out := &in.DestroyAfter, &out.DestroyAfter
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultDeletionPolicy.
+func (in *VaultDeletionPolicy) DeepCopy() *VaultDeletionPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultDeletionPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultKeyMapping) DeepCopyInto(out *VaultKeyMapping) {
+	*out = *in
+	if in.Rename != nil {
+		in, out := &in.Rename, &out.Rename
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Include != nil {
+		in, out := &in.Include, &out.Include
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Exclude != nil {
+		in, out := &in.Exclude, &out.Exclude
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultKeyMapping.
+func (in *VaultKeyMapping) DeepCopy() *VaultKeyMapping {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultKeyMapping)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultMirrorConfig) DeepCopyInto(out *VaultMirrorConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultMirrorConfig.
+func (in *VaultMirrorConfig) DeepCopy() *VaultMirrorConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultMirrorConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultNamespacedConfig) DeepCopyInto(out *VaultNamespacedConfig) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	if in.Spec != nil {
+		in, out := &in.Spec, &out.Spec
+		*out = new(VaultConfigSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultNamespacedConfig.
+func (in *VaultNamespacedConfig) DeepCopy() *VaultNamespacedConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultNamespacedConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VaultNamespacedConfig) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultNamespacedConfigList) DeepCopyInto(out *VaultNamespacedConfigList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]VaultNamespacedConfig, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultNamespacedConfigList.
+func (in *VaultNamespacedConfigList) DeepCopy() *VaultNamespacedConfigList {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultNamespacedConfigList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VaultNamespacedConfigList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultRateLimit) DeepCopyInto(out *VaultRateLimit) {
+	*out = *in
+	if in.QueueTimeout != nil {
+		in, out := &in.QueueTimeout, &out.QueueTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultRateLimit.
+func (in *VaultRateLimit) DeepCopy() *VaultRateLimit {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultRateLimit)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultResponseWrappingConfig) DeepCopyInto(out *VaultResponseWrappingConfig) {
+	*out = *in
+	if in.TTL != nil {
+		in, out := &in.TTL, &out.TTL
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultResponseWrappingConfig.
+func (in *VaultResponseWrappingConfig) DeepCopy() *VaultResponseWrappingConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultResponseWrappingConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultRoute) DeepCopyInto(out *VaultRoute) {
+	*out = *in
+	if in.MatchLabels != nil {
+		in, out := &in.MatchLabels, &out.MatchLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Namespace != nil {
+		in, out := &in.Namespace, &out.Namespace
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultRoute.
+func (in *VaultRoute) DeepCopy() *VaultRoute {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultRoute)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultRoutingConfig) DeepCopyInto(out *VaultRoutingConfig) {
+	*out = *in
+	if in.Routes != nil {
+		in, out := &in.Routes, &out.Routes
+		*out = make([]VaultRoute, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultRoutingConfig.
+func (in *VaultRoutingConfig) DeepCopy() *VaultRoutingConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultRoutingConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultScopedSecretMetadataSettings) DeepCopyInto(out *VaultScopedSecretMetadataSettings) {
+	*out = *in
+	in.VaultSecretMetadataSettings.DeepCopyInto(&out.VaultSecretMetadataSettings)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultScopedSecretMetadataSettings.
+func (in *VaultScopedSecretMetadataSettings) DeepCopy() *VaultScopedSecretMetadataSettings {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultScopedSecretMetadataSettings)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultSecretMetadataConfig) DeepCopyInto(out *VaultSecretMetadataConfig) {
+	*out = *in
+	in.VaultSecretMetadataSettings.DeepCopyInto(&out.VaultSecretMetadataSettings)
+	if in.Scopes != nil {
+		in, out := &in.Scopes, &out.Scopes
+		*out = make([]VaultScopedSecretMetadataSettings, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultSecretMetadataConfig.
+func (in *VaultSecretMetadataConfig) DeepCopy() *VaultSecretMetadataConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultSecretMetadataConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultSecretMetadataSettings) DeepCopyInto(out *VaultSecretMetadataSettings) {
+	*out = *in
+	if in.MaxVersions != nil {
+		in, out := &in.MaxVersions, &out.MaxVersions
+		*out = new(int)
+		**out = **in
+	}
+	if in.CASRequired != nil {
+		in, out := &in.CASRequired, &out.CASRequired
+		*out = new(bool)
+		**out = **in
+	}
+	if in.DeleteVersionAfter != nil {
+		in, out := &in.DeleteVersionAfter, &out.DeleteVersionAfter
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultSecretMetadataSettings.
+func (in *VaultSecretMetadataSettings) DeepCopy() *VaultSecretMetadataSettings {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultSecretMetadataSettings)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultServerStatus) DeepCopyInto(out *VaultServerStatus) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultServerStatus.
+func (in *VaultServerStatus) DeepCopy() *VaultServerStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultServerStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultTransitConfig) DeepCopyInto(out *VaultTransitConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultTransitConfig.
+func (in *VaultTransitConfig) DeepCopy() *VaultTransitConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultTransitConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VaultWriteStrategy) DeepCopyInto(out *VaultWriteStrategy) {
+	*out = *in
+	if in.MaxCASRetries != nil {
+		in, out := &in.MaxCASRetries, &out.MaxCASRetries
+		*out = new(int)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VaultWriteStrategy.
+func (in *VaultWriteStrategy) DeepCopy() *VaultWriteStrategy {
+	if in == nil {
+		return nil
+	}
+	out := new(VaultWriteStrategy)
+	in.DeepCopyInto(out)
+	return out
+}
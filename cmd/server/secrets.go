@@ -0,0 +1,425 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/alecthomas/kong"
+	v1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	ess "github.com/crossplane/crossplane-runtime/apis/proto/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/connection/store"
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/apis/config/v1alpha1"
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/plugin"
+	vault "github.com/crossplane-contrib/ess-plugin-vault/pkg/vault"
+)
+
+// storeFlags select the config of the SecretStore used by a command.
+type storeFlags struct {
+	Config     string `required:"" help:"Name of the VaultConfig to use, or <namespace>/<name> of a VaultNamespacedConfig."`
+	ConfigFile string `type:"existingfile" help:"Path to a YAML file holding VaultConfigs. If set, the config is read from the file instead of the Kubernetes API."`
+}
+
+// store returns the SecretStore of the selected config.
+func (f *storeFlags) store(ctx context.Context) (*vault.SecretStore, error) {
+	return newStore(ctx, f.Config, f.ConfigFile)
+}
+
+// newStore returns the SecretStore of the supplied config, exactly as the
+// plugin server would create it. The config is read from the supplied file,
+// if any, or from the Kubernetes API.
+func newStore(ctx context.Context, config, configFile string) (*vault.SecretStore, error) {
+	var kube client.Client
+	var configs plugin.ConfigGetter
+	if configFile != "" {
+		fc, err := plugin.NewFileConfigs(configFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot load config file")
+		}
+		configs = fc
+	} else {
+		s := runtime.NewScheme()
+		if err := v1alpha1.AddToScheme(s); err != nil {
+			return nil, errors.Wrap(err, "cannot add apis to scheme")
+		}
+		if err := corev1.AddToScheme(s); err != nil {
+			return nil, errors.Wrap(err, "cannot add coreapis to scheme")
+		}
+		cfg, err := ctrl.GetConfig()
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot get config")
+		}
+		if kube, err = client.New(cfg, client.Options{Scheme: s}); err != nil {
+			return nil, errors.Wrap(err, "cannot create client")
+		}
+		configs = plugin.NewKubeConfigGetter(kube)
+	}
+
+	cfg, err := configs.GetConfig(ctx, &ess.ConfigReference{Name: config})
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get config")
+	}
+	ss, err := plugin.NewStore(ctx, kube, configs, cfg)
+	return ss, errors.Wrap(err, "could not create new Vault Store")
+}
+
+// secretFlags select the secret a command operates on.
+type secretFlags struct {
+	Scope string `help:"Scope of the secret, i.e. the namespace of the claim or composite it belongs to."`
+	Name  string `required:"" help:"Name of the secret."`
+}
+
+func (f *secretFlags) scopedName() store.ScopedName {
+	return store.ScopedName{Scope: f.Scope, Name: f.Name}
+}
+
+// secretOutput is the output of a secret.
+type secretOutput struct {
+	Scope    string            `json:"scope,omitempty"`
+	Name     string            `json:"name"`
+	Data     map[string]string `json:"data,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// getCmd prints a secret.
+type getCmd struct {
+	storeFlags
+	secretFlags
+
+	Base64 bool `help:"Print values base64 encoded, e.g. if they are binary."`
+}
+
+// Run prints the secret as JSON.
+func (c *getCmd) Run(ctx *kong.Context) error {
+	ss, err := c.store(context.Background())
+	if err != nil {
+		return err
+	}
+	s := &store.Secret{}
+	if err := ss.ReadKeyValues(context.Background(), c.scopedName(), s); err != nil {
+		return errors.Wrap(err, "could not read key values")
+	}
+
+	out := secretOutput{Scope: c.Scope, Name: c.Name, Data: make(map[string]string, len(s.Data))}
+	for k, v := range s.Data {
+		out.Data[k] = string(v)
+		if c.Base64 {
+			out.Data[k] = base64.StdEncoding.EncodeToString(v)
+		}
+	}
+	if s.Metadata != nil {
+		out.Metadata = s.Metadata.Labels
+	}
+	e := json.NewEncoder(ctx.Stdout)
+	e.SetIndent("", "  ")
+	return errors.Wrap(e.Encode(out), "cannot print secret")
+}
+
+// applyCmd writes a secret.
+type applyCmd struct {
+	storeFlags
+	secretFlags
+
+	Data     map[string]string `help:"Key value pairs of the secret, e.g. --data=username=admin --data=password=secret."`
+	DataFile map[string]string `help:"Key value pairs of the secret read from files, e.g. --data-file=ca.crt=./ca.crt."`
+	Label    map[string]string `help:"Labels of the secret, which are stored as its metadata."`
+}
+
+// Run writes the secret and reports whether it changed.
+func (c *applyCmd) Run(ctx *kong.Context) error {
+	s := &store.Secret{ScopedName: c.scopedName(), Data: store.KeyValues{}}
+	for k, v := range c.Data {
+		s.Data[k] = []byte(v)
+	}
+	for k, p := range c.DataFile {
+		v, err := os.ReadFile(filepath.Clean(p))
+		if err != nil {
+			return errors.Wrapf(err, "cannot read value of key %q", k)
+		}
+		s.Data[k] = v
+	}
+	if len(c.Label) != 0 {
+		s.Metadata = &v1.ConnectionSecretMetadata{Labels: c.Label}
+	}
+
+	ss, err := c.store(context.Background())
+	if err != nil {
+		return err
+	}
+	changed, err := ss.WriteKeyValues(context.Background(), s)
+	if err != nil {
+		return errors.Wrap(err, "failed to write key values")
+	}
+	ctx.Printf("Applied secret %q, changed: %t", ss.Path(c.scopedName()), changed)
+	return nil
+}
+
+// deleteCmd deletes a secret, or some of its keys.
+type deleteCmd struct {
+	storeFlags
+	secretFlags
+
+	Key []string `help:"Keys to delete. The whole secret is deleted if none are given, or if no keys are left."`
+}
+
+// Run deletes the secret or its keys.
+func (c *deleteCmd) Run(ctx *kong.Context) error {
+	s := &store.Secret{ScopedName: c.scopedName()}
+	if len(c.Key) != 0 {
+		s.Data = make(store.KeyValues, len(c.Key))
+		for _, k := range c.Key {
+			s.Data[k] = nil
+		}
+	}
+
+	ss, err := c.store(context.Background())
+	if err != nil {
+		return err
+	}
+	if err := ss.DeleteKeyValues(context.Background(), s); err != nil {
+		return errors.Wrap(err, "failed to delete key values")
+	}
+	ctx.Printf("Deleted secret %q", ss.Path(c.scopedName()))
+	return nil
+}
+
+// checkConfigCmd checks a config.
+type checkConfigCmd struct {
+	storeFlags
+}
+
+// Run authenticates with the config, prints the status of its token and
+// mount, and fails if the mount cannot be used as configured.
+func (c *checkConfigCmd) Run(ctx *kong.Context) error {
+	ss, err := c.store(context.Background())
+	if err != nil {
+		return err
+	}
+	st, err := ss.Check(context.Background())
+	if err != nil {
+		return errors.Wrap(err, "cannot check config")
+	}
+	e := json.NewEncoder(ctx.Stdout)
+	e.SetIndent("", "  ")
+	if err := e.Encode(st); err != nil {
+		return errors.Wrap(err, "cannot print status")
+	}
+	return st.Err()
+}
+
+// migrateCmd migrates secrets between configs.
+type migrateCmd struct {
+	From       string `required:"" help:"Name of the VaultConfig to migrate secrets from, or <namespace>/<name> of a VaultNamespacedConfig."`
+	To         string `required:"" help:"Name of the VaultConfig to migrate secrets to, or <namespace>/<name> of a VaultNamespacedConfig."`
+	ConfigFile string `type:"existingfile" help:"Path to a YAML file holding VaultConfigs. If set, the configs are read from the file instead of the Kubernetes API."`
+
+	Prefix       string `help:"Only migrate secrets under this path, relative to the mount path, e.g. a scope."`
+	DryRun       bool   `help:"Only print the secrets that would be migrated."`
+	DeleteSource bool   `help:"Delete every source secret once its copy is verified."`
+	Checkpoint   string `type:"path" help:"Path to a file recording the migrated secrets. If the migration is interrupted, running it again with the same file resumes it."`
+}
+
+// Run migrates the secrets.
+func (c *migrateCmd) Run(ctx *kong.Context, logger logging.Logger) error {
+	src, err := newStore(context.Background(), c.From, c.ConfigFile)
+	if err != nil {
+		return errors.Wrap(err, "cannot create source store")
+	}
+	dst, err := newStore(context.Background(), c.To, c.ConfigFile)
+	if err != nil {
+		return errors.Wrap(err, "cannot create target store")
+	}
+
+	opts := []vault.MigratorOption{vault.WithMigrationLogger(logger)}
+	if c.DryRun {
+		opts = append(opts, vault.WithDryRun())
+	}
+	if c.DeleteSource {
+		opts = append(opts, vault.WithDeleteSource())
+	}
+	if c.Checkpoint != "" && !c.DryRun {
+		cp, err := vault.NewFileCheckpoint(c.Checkpoint)
+		if err != nil {
+			return err
+		}
+		defer cp.Close() //nolint:errcheck // Every checkpoint is synced when added.
+		opts = append(opts, vault.WithCheckpoint(cp))
+	}
+
+	res, err := vault.NewMigrator(src, dst, opts...).Migrate(context.Background(), c.Prefix)
+	switch {
+	case res == nil:
+	case c.DryRun:
+		ctx.Printf("Would migrate %d secrets", len(res.Migrated))
+	default:
+		ctx.Printf("Migrated %d secrets, skipped %d already migrated secrets", len(res.Migrated), len(res.Skipped))
+	}
+	return errors.Wrap(err, "cannot migrate secrets")
+}
+
+// gcCmd collects orphaned secrets once.
+type gcCmd struct {
+	storeFlags
+
+	Prefix string `help:"Only collect secrets under this path, relative to the mount path, e.g. a scope."`
+	Policy string `default:"Report" enum:"Report,Delete" help:"What happens to orphaned secrets, one of Report or Delete."`
+	DryRun bool   `help:"Only report orphaned secrets, regardless of the policy."`
+
+	OwnerGroups []string `help:"API groups of the managed resources, composite resources and claims that own connection secrets. Owners of all API groups are listed if empty."`
+}
+
+// Run collects the orphaned secrets of the config. Owners are always looked
+// up with the current kubeconfig.
+func (c *gcCmd) Run(ctx *kong.Context, logger logging.Logger) error {
+	ss, err := c.store(context.Background())
+	if err != nil {
+		return err
+	}
+	cfg, err := ctrl.GetConfig()
+	if err != nil {
+		return errors.Wrap(err, "cannot get config")
+	}
+	owners, err := plugin.NewKubeOwnerLister(cfg, c.OwnerGroups...)
+	if err != nil {
+		return err
+	}
+
+	policy := vault.GCPolicy(c.Policy)
+	if c.DryRun {
+		policy = vault.GCPolicyReport
+	}
+	res, err := vault.NewCollector(owners, vault.WithGCPolicy(policy), vault.WithGCLogger(logger)).Collect(context.Background(), ss, c.Prefix)
+	if err != nil {
+		return errors.Wrap(err, "cannot collect orphaned secrets")
+	}
+	for _, o := range res.Orphans {
+		ctx.Printf("Orphaned secret %q of owner %s", o.Path, o.OwnerUID)
+	}
+	ctx.Printf("Found %d orphaned of %d owned secrets, deleted %d", len(res.Orphans), res.Owned, len(res.Deleted))
+	return nil
+}
+
+// rewrapCmd rewraps the secrets of a config with Transit encryption.
+type rewrapCmd struct {
+	storeFlags
+
+	Prefix     string `help:"Only rewrap secrets under this path, relative to the mount path, e.g. a scope."`
+	MinVersion int    `help:"Only rewrap secrets with values encrypted with an older version of the Transit key, e.g. the latest version after rotating it. All secrets are rewrapped if 0."`
+}
+
+// Run rewraps the secrets of the config.
+func (c *rewrapCmd) Run(ctx *kong.Context) error {
+	ss, err := c.store(context.Background())
+	if err != nil {
+		return err
+	}
+	rewrapped, err := ss.Rewrap(context.Background(), c.Prefix, c.MinVersion)
+	for _, p := range rewrapped {
+		ctx.Printf("Rewrapped secret %q", p)
+	}
+	ctx.Printf("Rewrapped %d secrets", len(rewrapped))
+	return errors.Wrap(err, "cannot rewrap secrets")
+}
+
+// exportCmd exports secrets to an encrypted archive.
+type exportCmd struct {
+	storeFlags
+
+	Prefix  string `help:"Only export secrets under this path, relative to the mount path, e.g. a scope."`
+	Output  string `required:"" type:"path" help:"Path to write the archive to."`
+	KeyFile string `required:"" type:"existingfile" help:"Path to a file holding the 32 base64 encoded random bytes the archive is encrypted with, e.g. generated with 'head -c 32 /dev/urandom | base64'."`
+}
+
+// Run exports the secrets of the config.
+func (c *exportCmd) Run(ctx *kong.Context) error {
+	key, err := vault.ReadKeyFile(c.KeyFile)
+	if err != nil {
+		return err
+	}
+	ss, err := c.store(context.Background())
+	if err != nil {
+		return err
+	}
+	a, err := ss.Export(context.Background(), c.Prefix)
+	if err != nil {
+		return errors.Wrap(err, "cannot export secrets")
+	}
+
+	f, err := os.OpenFile(filepath.Clean(c.Output), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrap(err, "cannot create archive")
+	}
+	if err := vault.WriteArchive(f, a, key); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "cannot write archive")
+	}
+	ctx.Printf("Exported %d secrets of %s %s mount %q", a.Count, a.KVVersion, a.Config, a.MountPath)
+	return nil
+}
+
+// importCmd imports secrets from an encrypted archive.
+type importCmd struct {
+	storeFlags
+
+	Input   string `required:"" type:"existingfile" help:"Path to the archive to import."`
+	KeyFile string `required:"" type:"existingfile" help:"Path to the file holding the key the archive was encrypted with."`
+}
+
+// Run verifies the archive and imports its secrets into the config.
+func (c *importCmd) Run(ctx *kong.Context) error {
+	key, err := vault.ReadKeyFile(c.KeyFile)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(filepath.Clean(c.Input))
+	if err != nil {
+		return errors.Wrap(err, "cannot open archive")
+	}
+	defer f.Close() //nolint:errcheck // Only read.
+	a, err := vault.ReadArchive(f, key)
+	if err != nil {
+		return err
+	}
+
+	ss, err := c.store(context.Background())
+	if err != nil {
+		return err
+	}
+	res, err := ss.Import(context.Background(), a)
+	if res != nil {
+		for _, p := range res.Written {
+			ctx.Printf("Wrote secret %q", p)
+		}
+		ctx.Printf("Imported %d of %d secrets exported from %s %s mount %q at %s, %d of them were unchanged", len(res.Written)+len(res.Unchanged), a.Count, a.KVVersion, a.Config, a.MountPath, a.CreatedAt.Format(time.RFC3339), len(res.Unchanged))
+	}
+	return errors.Wrap(err, "cannot import secrets")
+}
@@ -0,0 +1,270 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/crossplane/crossplane-runtime/pkg/certificates"
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"github.com/crossplane/crossplane-runtime/pkg/event"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/reflection"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	ctrlwebhook "sigs.k8s.io/controller-runtime/pkg/webhook"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/apis/config/v1alpha1"
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/audit"
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/plugin"
+	vault "github.com/crossplane-contrib/ess-plugin-vault/pkg/vault"
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/webhook"
+	proto "github.com/crossplane/crossplane-runtime/apis/proto/v1alpha1"
+)
+
+// serveCmd runs the plugin server.
+type serveCmd struct {
+	// Port is the port number that the plugin will listen on.
+	Port int `default:"4040" help:"Port number that the plugin will listen on."`
+	// CertsPath is the path to the directory where the certificates are stored.
+	CertsPath string `default:"/certs" help:"Path to directory where the certificates are stored."`
+	// MetricsPort is the port number that the metrics server will listen on.
+	MetricsPort int `default:"8080" help:"Port number that the metrics server will listen on. Set to 0 to disable."`
+	// StoreCacheTTL is the duration Vault clients are reused for.
+	StoreCacheTTL time.Duration `help:"Duration authenticated Vault clients are reused for, unless their config or credentials change, their token expires or is rejected. Set to 0 to disable."`
+	// ReadCacheTTL is the duration secrets read from Vault are cached for.
+	ReadCacheTTL time.Duration `help:"Duration secrets read from Vault are cached for in memory, unless they are written or deleted through this replica. Secrets written by other replicas may be read stale for up to this duration. Set to 0 to disable."`
+	// ReadCacheMaxSize is the maximum number of cached secrets.
+	ReadCacheMaxSize int `default:"1000" help:"Maximum number of secrets cached in memory."`
+	// EnableWebhook enables the validating admission webhooks.
+	EnableWebhook bool `help:"Serve validating admission webhooks for Vault configs, using the certificates of the plugin."`
+	// WebhookPort is the port number that the webhook server will listen on.
+	WebhookPort int `default:"9443" help:"Port number that the webhook server will listen on."`
+	// ConfigFile is the path to a YAML file holding VaultConfigs.
+	ConfigFile string `help:"Path to a YAML file holding one or more VaultConfigs, which is reloaded on change. If set, configs are read from the file instead of the Kubernetes API, credentials can only be sourced from the environment or the filesystem, and no Kubernetes client is created."`
+	// GCInterval is the interval orphaned secrets are collected at.
+	GCInterval time.Duration `name:"gc-interval" help:"Interval at which secrets of all VaultConfigs whose owner no longer exists are collected. Set to 0 to disable."`
+	// GCPolicy determines what happens to orphaned secrets.
+	GCPolicy string `name:"gc-policy" default:"Report" enum:"Report,Delete" help:"What happens to orphaned secrets, one of Report or Delete."`
+	// GCOwnerGroups are the API groups listed to find the owners of secrets.
+	GCOwnerGroups []string `name:"gc-owner-groups" help:"API groups of the managed resources, composite resources and claims that own connection secrets. Owners of all API groups are listed if empty."`
+	// PurgeInterval is the interval soft deleted secrets are purged at.
+	PurgeInterval time.Duration `name:"purge-interval" default:"1h" help:"Interval at which secrets deleted with the DestroyAfter deletion policy are permanently deleted once their retention period elapsed. Set to 0 to disable."`
+	// AuditLog is where the audit log is written to.
+	AuditLog string `help:"Where to write the audit log of every secret access and mutation, as JSON lines: 'stdout', or the path of a file that is rotated by size. Disabled if empty."`
+	// AuditLogMaxSize is the size in MiB the audit log file is rotated at.
+	AuditLogMaxSize int64 `default:"100" help:"Size in MiB at which the audit log file is rotated."`
+	// AuditLogMaxBackups is the number of rotated audit log files kept.
+	AuditLogMaxBackups int `default:"5" help:"Number of rotated audit log files to keep."`
+	// CredentialsSelector is the label selector of the credential Secrets.
+	CredentialsSelector string `help:"Label selector of the Secrets holding Vault credentials. If set, only matching Secrets are cached and can be used as credentials, and their changes are watched. Otherwise, Secrets are read from the API server."`
+	// ServerCheckInterval is the interval the health of servers is checked at.
+	ServerCheckInterval time.Duration `default:"30s" help:"Interval at which the health of the servers of configs with multiple servers is checked."`
+	// EventInterval is the minimum interval between repeated Warning events.
+	EventInterval time.Duration `default:"5m" help:"Minimum interval between Warning events of the same reason on a config. Set to 0 to disable events."`
+}
+
+// Run runs the plugin server until it is shut down.
+func (c *serveCmd) Run(ctx *kong.Context, logger logging.Logger) error {
+	logger.Info("Starting Crossplane External Secrets Store Plugin for Vault")
+
+	s := runtime.NewScheme()
+	err := v1alpha1.AddToScheme(s)
+	ctx.FatalIfErrorf(err, "cannot add apis to scheme")
+
+	err = corev1.AddToScheme(s)
+	ctx.FatalIfErrorf(err, "cannot add coreapis to scheme")
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", c.Port))
+	ctx.FatalIfErrorf(err, "cannot listen on port %d", c.Port)
+
+	shutdown := make(chan os.Signal, 1)
+	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
+	serverErrors := make(chan error, 1)
+
+	tlsConfig, err := certificates.LoadMTLSConfig(filepath.Join(c.CertsPath, "ca.crt"), filepath.Join(c.CertsPath, "tls.crt"), filepath.Join(c.CertsPath, "tls.key"), true)
+	ctx.FatalIfErrorf(err, "cannot load certificates")
+
+	grpcServer := grpc.NewServer(grpc.Creds(credentials.NewTLS(tlsConfig)), grpc.UnaryInterceptor(plugin.StatusInterceptor))
+	reflection.Register(grpcServer)
+
+	opts := []plugin.ESSVaultOption{plugin.WithLogger(logger), plugin.WithServerCheckInterval(c.ServerCheckInterval)}
+	if c.StoreCacheTTL > 0 {
+		opts = append(opts, plugin.WithStoreCache(c.StoreCacheTTL))
+	}
+	if c.ReadCacheTTL > 0 {
+		opts = append(opts, plugin.WithReadCache(c.ReadCacheTTL, c.ReadCacheMaxSize))
+	}
+
+	switch c.AuditLog {
+	case "":
+	case "stdout":
+		opts = append(opts, plugin.WithAuditLogger(audit.NewJSONLogger(os.Stdout)))
+	default:
+		f, err := audit.NewRotatingFile(c.AuditLog, c.AuditLogMaxSize<<20, c.AuditLogMaxBackups)
+		ctx.FatalIfErrorf(err, "cannot open audit log")
+		defer f.Close() //nolint:errcheck // Every entry is written when it is logged.
+		opts = append(opts, plugin.WithAuditLogger(audit.NewJSONLogger(f)))
+	}
+
+	var cfg *rest.Config
+	var kube client.Client
+	var ca cache.Cache
+	var fc *plugin.FileConfigs
+	if c.ConfigFile != "" {
+		if c.EnableWebhook {
+			ctx.Fatalf("webhooks cannot be enabled with a config file")
+		}
+		if c.GCInterval > 0 {
+			ctx.Fatalf("garbage collection cannot be enabled with a config file")
+		}
+		fc, err = plugin.NewFileConfigs(c.ConfigFile)
+		ctx.FatalIfErrorf(err, "cannot load config file")
+		opts = append(opts, plugin.WithConfigGetter(fc))
+	} else {
+		cfg, err = ctrl.GetConfig()
+		ctx.FatalIfErrorf(errors.Wrap(err, "cannot get config"))
+		kube, ca, err = newKubeClient(cfg, s, c.CredentialsSelector)
+		ctx.FatalIfErrorf(err, "cannot create kubernetes client")
+		if c.EventInterval > 0 {
+			cs, err := kubernetes.NewForConfig(cfg)
+			ctx.FatalIfErrorf(err, "cannot create kubernetes clientset")
+			broadcaster := record.NewBroadcaster()
+			defer broadcaster.Shutdown()
+			broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: cs.CoreV1().Events("")})
+			rec := broadcaster.NewRecorder(s, corev1.EventSource{Component: "ess-plugin-vault"})
+			opts = append(opts, plugin.WithEventRecorder(event.NewAPIRecorder(rec), c.EventInterval))
+		}
+	}
+
+	essServer, err := plugin.NewESSVault(kube, listener, grpcServer, opts...)
+	ctx.FatalIfErrorf(err, "cannot create server")
+
+	cacheCtx, stopCache := context.WithCancel(context.Background())
+	defer stopCache()
+	if fc != nil {
+		err = essServer.InvalidateOnFileChange(cacheCtx, fc)
+		ctx.FatalIfErrorf(err, "cannot watch config file")
+	} else {
+		err = essServer.InvalidateOnChange(cacheCtx, ca, c.CredentialsSelector != "")
+		ctx.FatalIfErrorf(err, "cannot watch for changes")
+		go func() {
+			if err := ca.Start(cacheCtx); err != nil {
+				serverErrors <- errors.Wrap(err, "cannot start cache")
+			}
+		}()
+		if !ca.WaitForCacheSync(cacheCtx) {
+			ctx.Fatalf("cannot sync cache")
+		}
+	}
+
+	proto.RegisterExternalSecretStorePluginServiceServer(grpcServer, essServer)
+	go essServer.MonitorServers(cacheCtx)
+
+	go func() {
+		logger.Info("GRPC server listening on port", "port", c.Port)
+		serverErrors <- essServer.Serve()
+	}()
+
+	if c.GCInterval > 0 {
+		owners, err := plugin.NewKubeOwnerLister(cfg, c.GCOwnerGroups...)
+		ctx.FatalIfErrorf(err, "cannot create garbage collector")
+		gc := vault.NewCollector(owners, vault.WithGCPolicy(vault.GCPolicy(c.GCPolicy)), vault.WithGCLogger(logger))
+		go essServer.CollectGarbage(cacheCtx, gc, c.GCInterval)
+	}
+
+	if c.PurgeInterval > 0 {
+		go essServer.PurgeDeleted(cacheCtx, c.PurgeInterval)
+	}
+
+	if c.EnableWebhook {
+		ws := &ctrlwebhook.Server{Port: c.WebhookPort, CertDir: c.CertsPath}
+		webhook.Setup(ws)
+		go func() {
+			if err := ws.StartStandalone(cacheCtx, s); err != nil {
+				serverErrors <- errors.Wrap(err, "cannot serve webhooks")
+			}
+		}()
+	}
+
+	if c.MetricsPort != 0 {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{}))
+		ms := &http.Server{Addr: fmt.Sprintf(":%d", c.MetricsPort), Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			logger.Info("Metrics server listening on port", "port", c.MetricsPort)
+			serverErrors <- errors.Wrap(ms.ListenAndServe(), "cannot serve metrics")
+		}()
+	}
+
+	select {
+	case err := <-serverErrors:
+		return errors.Wrap(err, "cannot start server")
+	case <-shutdown:
+		logger.Info("Shutting down the External Secrets Store Vault Plugin")
+		essServer.GracefulStop()
+	}
+	return nil
+}
+
+// newKubeClient returns a client that reads configs, and credential Secrets
+// matching the credentials selector, from the returned cache.
+func newKubeClient(cfg *rest.Config, s *runtime.Scheme, credentialsSelector string) (client.Client, cache.Cache, error) {
+	cacheOpts := cache.Options{Scheme: s}
+	uncached := []client.Object{&corev1.Secret{}}
+	if credentialsSelector != "" {
+		sel, err := labels.Parse(credentialsSelector)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "cannot parse credentials selector")
+		}
+		cacheOpts.SelectorsByObject = cache.SelectorsByObject{&corev1.Secret{}: {Label: sel}}
+		uncached = nil
+	}
+	ca, err := cache.New(cfg, cacheOpts)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot create cache")
+	}
+
+	c, err := client.New(cfg, client.Options{Scheme: s})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot create client")
+	}
+
+	kube, err := client.NewDelegatingClient(client.NewDelegatingClientInput{CacheReader: ca, Client: c, UncachedObjects: uncached})
+	return kube, ca, errors.Wrap(err, "cannot create cached client")
+}
@@ -0,0 +1,127 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+// Package audit records accesses and mutations of secrets by the plugin.
+package audit
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// Results of audited operations.
+const (
+	ResultSuccess = "Success"
+	ResultFailure = "Failure"
+)
+
+// An Entry is an audited operation. It never holds secret values.
+type Entry struct {
+	// Time the operation started.
+	Time time.Time `json:"time"`
+	// Peer is the identity of the client, from its TLS certificate.
+	Peer string `json:"peer,omitempty"`
+	// Config is the name of the referenced config.
+	Config string `json:"config,omitempty"`
+	// ScopedName is the scoped name of the secret.
+	ScopedName string `json:"scopedName,omitempty"`
+	// Operation is the name of the RPC.
+	Operation string `json:"operation"`
+	// Keys are the keys of the secret that were read or written. They are
+	// omitted if the whole secret was deleted.
+	Keys []string `json:"keys,omitempty"`
+	// Result is Success or Failure.
+	Result string `json:"result"`
+	// Error of a failed operation.
+	Error string `json:"error,omitempty"`
+	// Latency of the operation.
+	Latency time.Duration `json:"latency"`
+}
+
+// A Logger records audit entries.
+type Logger interface {
+	Log(e Entry)
+}
+
+// A NopLogger does not record anything.
+type NopLogger struct{}
+
+// Log does nothing.
+func (NopLogger) Log(_ Entry) {}
+
+// A JSONLogger writes every entry as a line of JSON.
+type JSONLogger struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONLogger returns a JSONLogger writing to the supplied writer.
+func NewJSONLogger(w io.Writer) *JSONLogger {
+	return &JSONLogger{w: w}
+}
+
+// Log writes the supplied entry. Entries that cannot be written are dropped,
+// since failing the audited operation would not undo it.
+func (l *JSONLogger) Log(e Entry) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = l.w.Write(append(b, '\n'))
+}
+
+// PeerIdentity returns the identity of the gRPC client of the supplied
+// context, i.e. the common name of its verified TLS certificate, or its first
+// DNS name if it has no common name. It falls back to the address of the
+// client, e.g. if mTLS is not used.
+func PeerIdentity(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	if ti, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+		if id := certIdentity(ti.State.VerifiedChains); id != "" {
+			return id
+		}
+	}
+	if p.Addr != nil {
+		return p.Addr.String()
+	}
+	return ""
+}
+
+func certIdentity(chains [][]*x509.Certificate) string {
+	if len(chains) == 0 || len(chains[0]) == 0 {
+		return ""
+	}
+	c := chains[0][0]
+	if c.Subject.CommonName != "" {
+		return c.Subject.CommonName
+	}
+	if len(c.DNSNames) != 0 {
+		return c.DNSNames[0]
+	}
+	return ""
+}
@@ -0,0 +1,168 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package audit
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestJSONLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := NewJSONLogger(buf)
+	want := Entry{
+		Time:       time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC),
+		Peer:       "crossplane",
+		Config:     "vault",
+		ScopedName: "ns/db",
+		Operation:  "ApplySecret",
+		Keys:       []string{"password"},
+		Result:     ResultSuccess,
+		Latency:    time.Millisecond,
+	}
+	l.Log(want)
+	l.Log(want)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("l.Log(...): want 2 lines, got %d", len(lines))
+	}
+	got := Entry{}
+	if err := json.Unmarshal([]byte(lines[0]), &got); err != nil {
+		t.Fatalf("json.Unmarshal(...): %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("l.Log(...): -want, +got:\n%s", diff)
+	}
+}
+
+func TestCertIdentity(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		chains [][]*x509.Certificate
+		want   string
+	}{
+		"NoChains": {
+			reason: "Should return no identity without a verified chain.",
+		},
+		"CommonName": {
+			reason: "Should prefer the common name of the leaf certificate.",
+			chains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "crossplane"}, DNSNames: []string{"crossplane.crossplane-system"}}}},
+			want:   "crossplane",
+		},
+		"DNSName": {
+			reason: "Should fall back to the first DNS name of the leaf certificate.",
+			chains: [][]*x509.Certificate{{{DNSNames: []string{"crossplane.crossplane-system"}}}},
+			want:   "crossplane.crossplane-system",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, certIdentity(tc.chains)); diff != "" {
+				t.Errorf("\n%s\ncertIdentity(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	f, err := NewRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatalf("NewRotatingFile(...): %v", err)
+	}
+	for _, l := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := f.Write([]byte(l)); err != nil {
+			t.Fatalf("f.Write(...): %v", err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("f.Close(): %v", err)
+	}
+
+	want := map[string]string{
+		path:        "fourth\n",
+		path + ".1": "third\n",
+		path + ".2": "second\n",
+	}
+	for p, content := range want {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatalf("os.ReadFile(%q): %v", p, err)
+		}
+		if diff := cmp.Diff(content, string(b)); diff != "" {
+			t.Errorf("%s: -want, +got:\n%s", p, diff)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("os.Stat(%q): want the oldest file to be removed", path+".3")
+	}
+}
+
+func TestRotatingFileRotateFailed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	// The file cannot be renamed to its first backup, which is a directory
+	// that is not empty.
+	if err := os.MkdirAll(filepath.Join(path+".1", "blocked"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewRotatingFile(path, 10, 1)
+	if err != nil {
+		t.Fatalf("NewRotatingFile(...): %v", err)
+	}
+	if _, err := f.Write([]byte("first\n")); err != nil {
+		t.Fatalf("f.Write(...): %v", err)
+	}
+	if _, err := f.Write([]byte("second\n")); err == nil {
+		t.Errorf("f.Write(...): want error rotating the file")
+	}
+
+	// Rotating is retried by the next write, which succeeds once the backup
+	// can be written.
+	if err := os.RemoveAll(path + ".1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("third\n")); err != nil {
+		t.Fatalf("f.Write(...): %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("f.Close(): %v", err)
+	}
+
+	want := map[string]string{
+		path:        "third\n",
+		path + ".1": "first\nsecond\n",
+	}
+	for p, content := range want {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatalf("os.ReadFile(%q): %v", p, err)
+		}
+		if diff := cmp.Diff(content, string(b)); diff != "" {
+			t.Errorf("%s: want writes kept in the file that failed to rotate, -want, +got:\n%s", p, diff)
+		}
+	}
+}
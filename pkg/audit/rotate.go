@@ -0,0 +1,136 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package audit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+)
+
+const (
+	errOpenFile   = "cannot open audit log file"
+	errRotateFile = "cannot rotate audit log file"
+)
+
+// A RotatingFile is a file that is rotated once it would exceed a maximum
+// size. Rotated files are suffixed with .1, .2 and so on, .1 being the most
+// recent, and the oldest are removed.
+type RotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// NewRotatingFile opens the supplied file for appending, and rotates it once
+// it would exceed maxSize bytes, keeping maxBackups rotated files.
+func NewRotatingFile(path string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	r := &RotatingFile{path: filepath.Clean(path), maxSize: maxSize, maxBackups: maxBackups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return errors.Wrap(err, errOpenFile)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return errors.Wrap(err, errOpenFile)
+	}
+	r.f, r.size = f, fi.Size()
+	return nil
+}
+
+// Write writes to the file, rotating it first if the write would exceed its
+// maximum size. If the file cannot be rotated, the write is appended to it
+// regardless, and the error of rotating it is returned.
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var rerr error
+	if r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		rerr = r.rotate()
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	if err != nil {
+		return n, err
+	}
+	return n, rerr
+}
+
+// rotate rotates the file. If it cannot be moved aside, the file is opened
+// again for appending, so that rotating it is retried by the next write.
+func (r *RotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return errors.Wrap(r.reopen(err), errRotateFile)
+	}
+	if err := r.shift(); err != nil {
+		return errors.Wrap(r.reopen(err), errRotateFile)
+	}
+	return r.open()
+}
+
+// shift moves the file to the first backup, after moving every backup to the
+// next one and removing the oldest. Without backups, the file is removed.
+func (r *RotatingFile) shift() error {
+	if r.maxBackups < 1 {
+		if err := os.Remove(r.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	_ = os.Remove(r.backup(r.maxBackups))
+	for i := r.maxBackups - 1; i > 0; i-- {
+		if err := os.Rename(r.backup(i), r.backup(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(r.path, r.backup(1))
+}
+
+// reopen opens the file again after rotating it failed with the supplied
+// error, which it returns.
+func (r *RotatingFile) reopen(err error) error {
+	if oerr := r.open(); oerr != nil {
+		return errors.Errorf("%s, and %s", err, oerr)
+	}
+	return err
+}
+
+func (r *RotatingFile) backup(i int) string {
+	return fmt.Sprintf("%s.%d", r.path, i)
+}
+
+// Close closes the file.
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.Close()
+}
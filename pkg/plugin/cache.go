@@ -0,0 +1,271 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/apis/config/v1alpha1"
+	vault "github.com/crossplane-contrib/ess-plugin-vault/pkg/vault"
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/vault/kv"
+)
+
+const errGetInformer = "cannot get informer"
+
+// tokenExpiryMargin is how long before their token expires cached stores are
+// dropped, so that requests in flight do not use an expired token.
+const tokenExpiryMargin = 30 * time.Second
+
+// A storeCache caches Vault stores per config, so that their clients and
+// tokens are reused across requests until the config or its credentials
+// change, or the entry expires.
+type storeCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]storeCacheEntry
+
+	// generation is incremented by every invalidation, which records it as
+	// the generation the config or Secret key was last invalidated at while
+	// stores are being built. A store built from a config read before its
+	// config, mirror config or credentials were invalidated is not cached,
+	// since it may be built from stale ones.
+	generation        uint64
+	building          int
+	configGenerations map[string]uint64
+	secretGenerations map[string]uint64
+}
+
+type storeCacheEntry struct {
+	store   *vault.SecretStore
+	secrets map[string]bool
+	configs map[string]bool
+	expires time.Time
+}
+
+func newStoreCache(ttl time.Duration) *storeCache {
+	return &storeCache{
+		ttl:               ttl,
+		entries:           map[string]storeCacheEntry{},
+		configGenerations: map[string]uint64{},
+		secretGenerations: map[string]uint64{},
+	}
+}
+
+// begin returns the current generation, which must be read before reading
+// the config of a store to be added, and a function to call once the store
+// was added or could not be built.
+func (c *storeCache) begin() (uint64, func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.building++
+	return c.generation, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.building--; c.building == 0 {
+			// Invalidations only matter to stores being built.
+			c.configGenerations = map[string]uint64{}
+			c.secretGenerations = map[string]uint64{}
+		}
+	}
+}
+
+// get returns the cached store of the supplied config key, if any.
+func (c *storeCache) get(key string) *vault.SecretStore {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(e.expires) {
+		delete(c.entries, key)
+		return nil
+	}
+	return e.store
+}
+
+// add caches the supplied store of the supplied config key, which uses the
+// credentials of the supplied Secret keys, and the other supplied config keys,
+// e.g. of its mirror. The store is cached until the TTL passes or its token
+// is about to expire, whichever is earlier. It is not cached if any of these
+// keys was invalidated since the supplied generation.
+func (c *storeCache) add(key string, since uint64, s *vault.SecretStore, secrets []string, configs ...string) {
+	e := storeCacheEntry{store: s, secrets: make(map[string]bool, len(secrets)), configs: make(map[string]bool, len(configs)), expires: time.Now().Add(c.ttl)}
+	if t := s.TokenExpiry(); !t.IsZero() && t.Add(-tokenExpiryMargin).Before(e.expires) {
+		e.expires = t.Add(-tokenExpiryMargin)
+	}
+	for _, k := range secrets {
+		e.secrets[k] = true
+	}
+	for _, k := range configs {
+		e.configs[k] = true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.configGenerations[key] > since {
+		return
+	}
+	for k := range e.configs {
+		if c.configGenerations[k] > since {
+			return
+		}
+	}
+	for k := range e.secrets {
+		if c.secretGenerations[k] > since {
+			return
+		}
+	}
+	c.entries[key] = e
+}
+
+// invalidateConfig drops the cached stores of and using the supplied config
+// key.
+func (c *storeCache) invalidateConfig(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	if c.building > 0 {
+		c.configGenerations[key] = c.generation
+	}
+	delete(c.entries, key)
+	for k, e := range c.entries {
+		if e.configs[key] {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// invalidateSecret drops all cached stores using the credentials of the
+// supplied Secret key.
+func (c *storeCache) invalidateSecret(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	if c.building > 0 {
+		c.secretGenerations[key] = c.generation
+	}
+	for k, e := range c.entries {
+		if e.secrets[key] {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// configKey returns the cache key of a config, which is "<name>" for a
+// VaultConfig and "<namespace>/<name>" for a VaultNamespacedConfig.
+func configKey(o any) string {
+	k, _ := toolscache.DeletionHandlingMetaNamespaceKeyFunc(o)
+	return k
+}
+
+// credentialSecrets returns the keys of the Secrets the credentials of the
+// supplied config are sourced from.
+func credentialSecrets(spec *v1alpha1.VaultConfigSpec) []string {
+	var keys []string
+	for _, c := range credentialSelectors(spec) {
+		if c.selectors.SecretRef != nil {
+			keys = append(keys, c.selectors.SecretRef.Namespace+"/"+c.selectors.SecretRef.Name)
+		}
+	}
+	return keys
+}
+
+// invalidateConfig drops the cached Vault stores and secrets of the supplied
+// config key.
+func (s *ESSVault) invalidateConfig(key string) {
+	if s.stores != nil {
+		s.stores.invalidateConfig(key)
+	}
+	if s.reads != nil {
+		s.reads.InvalidateConfig(key)
+	}
+}
+
+// removeConfig drops the cached Vault stores and secrets, and the rate limiter
+// of the supplied config key, which was deleted.
+func (s *ESSVault) removeConfig(key string) {
+	s.invalidateConfig(key)
+	s.limits.forget(key)
+}
+
+// evictDenied drops the cached store of the supplied config if the supplied
+// error is due to its token being rejected, e.g. because it was revoked, so
+// that the next request logs in again.
+func (s *ESSVault) evictDenied(cfg *v1alpha1.VaultConfig, err error) {
+	if s.stores != nil && kv.ReasonOf(err) == kv.ReasonPermissionDenied {
+		s.stores.invalidateConfig(configKey(cfg))
+	}
+}
+
+// changed returns true if the supplied updated object changed in a way that
+// affects cached stores. Status updates of configs do not change their
+// generation, and Secrets are compared by their data.
+func changed(oldObj, newObj any) bool {
+	if o, ok := oldObj.(*corev1.Secret); ok {
+		n, ok := newObj.(*corev1.Secret)
+		return !ok || !cmp.Equal(o.Data, n.Data) || !cmp.Equal(o.StringData, n.StringData)
+	}
+	o, ok := oldObj.(client.Object)
+	n, nok := newObj.(client.Object)
+	return !ok || !nok || o.GetGeneration() != n.GetGeneration()
+}
+
+// InvalidateOnChange registers event handlers with the supplied informers, so
+// that cached Vault stores and secrets are dropped whenever their config
+// changes, and rate limiters whenever their config is deleted. If secrets is
+// true, cached stores are also dropped whenever a Secret holding their
+// credentials changes, which requires Secrets to be cached.
+func (s *ESSVault) InvalidateOnChange(ctx context.Context, informers cache.Informers, secrets bool) error {
+	type handlers struct {
+		update, remove func(key string)
+	}
+	objs := map[client.Object]handlers{
+		&v1alpha1.VaultConfig{}:           {update: s.invalidateConfig, remove: s.removeConfig},
+		&v1alpha1.VaultNamespacedConfig{}: {update: s.invalidateConfig, remove: s.removeConfig},
+	}
+	if secrets && s.stores != nil {
+		objs[&corev1.Secret{}] = handlers{update: s.stores.invalidateSecret, remove: s.stores.invalidateSecret}
+	}
+	for o, h := range objs {
+		inf, err := informers.GetInformer(ctx, o)
+		if err != nil {
+			return errors.Wrap(err, errGetInformer)
+		}
+		h := h
+		if _, err := inf.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+			UpdateFunc: func(oldObj, obj any) {
+				if changed(oldObj, obj) {
+					h.update(configKey(obj))
+				}
+			},
+			DeleteFunc: func(obj any) { h.remove(configKey(obj)) },
+		}); err != nil {
+			return errors.Wrap(err, errGetInformer)
+		}
+	}
+	return nil
+}
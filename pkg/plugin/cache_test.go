@@ -0,0 +1,237 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/apis/config/v1alpha1"
+	vault "github.com/crossplane-contrib/ess-plugin-vault/pkg/vault"
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/vault/kv"
+)
+
+func TestStoreCache(t *testing.T) {
+	c := newStoreCache(time.Hour)
+	a, b := &vault.SecretStore{}, &vault.SecretStore{}
+	c.add("a", 0, a, []string{"ns/token"})
+	c.add("tenant/b", 0, b, []string{"tenant/ca"})
+
+	if got := c.get("a"); got != a {
+		t.Errorf("c.get(%q): want cached store", "a")
+	}
+
+	c.invalidateSecret("ns/token")
+	if got := c.get("a"); got != nil {
+		t.Errorf("c.get(%q): want no store after its credentials changed", "a")
+	}
+	if got := c.get("tenant/b"); got != b {
+		t.Errorf("c.get(%q): want cached store after unrelated credentials changed", "tenant/b")
+	}
+
+	c.invalidateConfig("tenant/b")
+	if got := c.get("tenant/b"); got != nil {
+		t.Errorf("c.get(%q): want no store after its config changed", "tenant/b")
+	}
+
+	c.add("a", 0, a, nil, "mirror")
+	c.invalidateConfig("mirror")
+	if got := c.get("a"); got != nil {
+		t.Errorf("c.get(%q): want no store after its mirror config changed", "a")
+	}
+
+	c = newStoreCache(-time.Second)
+	c.add("a", 0, a, nil)
+	if got := c.get("a"); got != nil {
+		t.Errorf("c.get(%q): want no store after it expired", "a")
+	}
+}
+
+func TestStoreCacheInvalidatedWhileBuilding(t *testing.T) {
+	a := &vault.SecretStore{}
+	cases := map[string]struct {
+		reason     string
+		invalidate func(c *storeCache)
+		want       *vault.SecretStore
+	}{
+		"Unchanged": {
+			reason:     "Should cache a store whose inputs did not change while it was built.",
+			invalidate: func(c *storeCache) { c.invalidateConfig("other") },
+			want:       a,
+		},
+		"Config": {
+			reason:     "Should not cache a store whose config changed while it was built.",
+			invalidate: func(c *storeCache) { c.invalidateConfig("a") },
+		},
+		"Mirror": {
+			reason:     "Should not cache a store whose mirror config changed while it was built.",
+			invalidate: func(c *storeCache) { c.invalidateConfig("mirror") },
+		},
+		"Credentials": {
+			reason:     "Should not cache a store whose credentials changed while it was built.",
+			invalidate: func(c *storeCache) { c.invalidateSecret("ns/token") },
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := newStoreCache(time.Hour)
+			// A config changed before the store was built does not matter.
+			c.invalidateConfig("a")
+			since, done := c.begin()
+			tc.invalidate(c)
+			c.add("a", since, a, []string{"ns/token"}, "mirror")
+			done()
+			if got := c.get("a"); got != tc.want {
+				t.Errorf("\n%s\nc.get(%q): want %v, got %v", tc.reason, "a", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestStoreCacheTokenExpiry(t *testing.T) {
+	lease := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `{"auth": {"client_token": "s.token", "lease_duration": %d}}`, lease)
+	}))
+	defer srv.Close()
+
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenPath, []byte("jwt"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &v1alpha1.VaultConfig{Spec: &v1alpha1.VaultConfigSpec{
+		Server:    srv.URL,
+		MountPath: "secret",
+		Auth: v1alpha1.VaultAuthConfig{
+			Method: v1alpha1.VaultAuthKubernetes,
+			Kubernetes: &v1alpha1.VaultAuthKubernetesConfig{
+				Role: "crossplane",
+				ServiceAccountTokenSource: &v1alpha1.ServiceAccountTokenSourceConfig{
+					Source:                    xpv1.CredentialsSourceFilesystem,
+					CommonCredentialSelectors: xpv1.CommonCredentialSelectors{Fs: &xpv1.FsSelector{Path: tokenPath}},
+				},
+			},
+		},
+	}}
+
+	cases := map[string]struct {
+		reason string
+		lease  int
+		cached bool
+	}{
+		"LongLived": {
+			reason: "A store whose token outlives the TTL should be cached.",
+			lease:  7200,
+			cached: true,
+		},
+		"ShortLived": {
+			reason: "A store whose token expires sooner than the TTL should not be cached beyond its expiry.",
+			lease:  10,
+		},
+		"NoLease": {
+			reason: "A store whose token does not expire should be cached.",
+			cached: true,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			lease = tc.lease
+			ss, err := vault.NewVaultStore(context.Background(), nil, cfg)
+			if err != nil {
+				t.Fatalf("\n%s\nNewVaultStore(...): %v", tc.reason, err)
+			}
+			c := newStoreCache(time.Hour)
+			c.add("vault", 0, ss, nil)
+			if got := c.get("vault") != nil; got != tc.cached {
+				t.Errorf("\n%s\nc.get(...): want cached %t, got %t", tc.reason, tc.cached, got)
+			}
+		})
+	}
+}
+
+func TestEvictDenied(t *testing.T) {
+	s, _ := NewESSVault(nil, nil, nil, WithStoreCache(time.Hour))
+	cfg := &v1alpha1.VaultConfig{}
+	cfg.SetName("vault")
+	ss := &vault.SecretStore{}
+
+	s.stores.add("vault", 0, ss, nil)
+	s.evictDenied(cfg, errors.New("boom"))
+	if got := s.stores.get("vault"); got != ss {
+		t.Errorf("s.stores.get(...): want cached store after an unrelated error")
+	}
+
+	s.evictDenied(cfg, errors.Wrap(kv.ErrPermissionDenied, "cannot read secret"))
+	if got := s.stores.get("vault"); got != nil {
+		t.Errorf("s.stores.get(...): want no store after its token was rejected")
+	}
+}
+
+func TestChanged(t *testing.T) {
+	cfg := func(generation int64) *v1alpha1.VaultConfig {
+		return &v1alpha1.VaultConfig{ObjectMeta: metav1.ObjectMeta{Generation: generation}}
+	}
+	secret := func(v string) *corev1.Secret {
+		return &corev1.Secret{Data: map[string][]byte{"token": []byte(v)}}
+	}
+	cases := map[string]struct {
+		reason   string
+		old, new any
+		want     bool
+	}{
+		"StatusUpdate": {
+			reason: "A config update that does not change its generation should be ignored.",
+			old:    cfg(1),
+			new:    cfg(1),
+		},
+		"SpecUpdate": {
+			reason: "A config update that changes its generation should be a change.",
+			old:    cfg(1),
+			new:    cfg(2),
+			want:   true,
+		},
+		"SecretResync": {
+			reason: "A Secret update that does not change its data should be ignored.",
+			old:    secret("a"),
+			new:    secret("a"),
+		},
+		"SecretUpdate": {
+			reason: "A Secret update that changes its data should be a change.",
+			old:    secret("a"),
+			new:    secret("b"),
+			want:   true,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := changed(tc.old, tc.new); got != tc.want {
+				t.Errorf("\n%s\nchanged(...): want %t, got %t", tc.reason, tc.want, got)
+			}
+		})
+	}
+}
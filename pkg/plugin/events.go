@@ -0,0 +1,110 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package plugin
+
+import (
+	"sync"
+	"time"
+
+	"github.com/crossplane/crossplane-runtime/pkg/event"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/apis/config/v1alpha1"
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/vault/kv"
+)
+
+// Reasons of the Warning events recorded on configs.
+const (
+	reasonServerUnavailable    event.Reason = "ServerUnavailable"
+	reasonAuthenticationFailed event.Reason = "AuthenticationFailed"
+	reasonPermissionDenied     event.Reason = "PermissionDenied"
+	reasonOperationFailed      event.Reason = "OperationFailed"
+)
+
+// WithEventRecorder configures the ESSVault to record Warning events on the
+// config of a failed request, at most once per interval for every config and
+// reason, so that operators can see them without access to the plugin logs.
+func WithEventRecorder(r event.Recorder, interval time.Duration) ESSVaultOption {
+	return func(e *ESSVault) {
+		e.recorder = r
+		e.events = &eventFilter{interval: interval, last: map[string]time.Time{}}
+	}
+}
+
+// An eventFilter deduplicates events, on top of the aggregation and spam
+// filtering of the API event recorder, which only applies per source and
+// message.
+type eventFilter struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+// allow returns true if no event with the supplied key was allowed within the
+// interval.
+func (f *eventFilter) allow(key string, now time.Time) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if t, ok := f.last[key]; ok && now.Sub(t) < f.interval {
+		return false
+	}
+	f.last[key] = now
+	return true
+}
+
+// recordFailure records a Warning event on the supplied config for the
+// supplied error. If auth is true, the error was returned while creating the
+// store, i.e. while reading credentials or logging in.
+func (s *ESSVault) recordFailure(cfg *v1alpha1.VaultConfig, err error, auth bool) {
+	if s.events == nil {
+		return
+	}
+	reason := failureReason(err, auth)
+	if !s.events.allow(configKey(cfg)+"/"+string(reason), time.Now()) {
+		return
+	}
+	s.recorder.Event(eventTarget(cfg), event.Warning(reason, err))
+}
+
+// failureReason categorizes the supplied error like the gRPC status codes of
+// failed requests.
+func failureReason(err error, auth bool) event.Reason {
+	switch kv.ReasonOf(err) {
+	case kv.ReasonUnavailable:
+		return reasonServerUnavailable
+	case kv.ReasonPermissionDenied:
+		if auth {
+			return reasonAuthenticationFailed
+		}
+		return reasonPermissionDenied
+	}
+	if auth {
+		return reasonAuthenticationFailed
+	}
+	return reasonOperationFailed
+}
+
+// eventTarget returns the object to record events of the supplied config on.
+// VaultNamespacedConfigs are converted to VaultConfigs when they are read, and
+// are the only ones with a namespace.
+func eventTarget(cfg *v1alpha1.VaultConfig) runtime.Object {
+	if cfg.GetNamespace() == "" {
+		return cfg
+	}
+	return &v1alpha1.VaultNamespacedConfig{ObjectMeta: cfg.ObjectMeta}
+}
@@ -0,0 +1,120 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package plugin
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"github.com/crossplane/crossplane-runtime/pkg/event"
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/vault/api"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/apis/config/v1alpha1"
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/vault/kv"
+)
+
+func TestFailureReason(t *testing.T) {
+	errBoom := errors.New("boom")
+	cases := map[string]struct {
+		reason string
+		err    error
+		auth   bool
+		want   event.Reason
+	}{
+		"Unreachable": {
+			reason: "Should categorize network errors as an unavailable server.",
+			err:    errors.Wrap(&url.Error{Op: "Get", URL: "https://vault", Err: errBoom}, "cannot get secret"),
+			want:   reasonServerUnavailable,
+		},
+		"LoginDenied": {
+			reason: "Should categorize a denied login as an authentication failure.",
+			err:    errors.Wrap(&api.ResponseError{StatusCode: 403}, "cannot login"),
+			auth:   true,
+			want:   reasonAuthenticationFailed,
+		},
+		"PermissionDenied": {
+			reason: "Should categorize a denied request as a permission failure.",
+			err:    errors.Wrap(&api.ResponseError{StatusCode: 403}, "cannot write secret"),
+			want:   reasonPermissionDenied,
+		},
+		"ServerError": {
+			reason: "Should categorize 5xx responses as an unavailable server.",
+			err:    &api.ResponseError{StatusCode: 503},
+			want:   reasonServerUnavailable,
+		},
+		"Sealed": {
+			reason: "Should categorize errors converted by the KV client by their reason.",
+			err:    errors.Wrap(&kv.Error{Reason: kv.ReasonUnavailable}, "cannot get secret"),
+			want:   reasonServerUnavailable,
+		},
+		"NotFound": {
+			reason: "Should categorize errors other than denied and unavailable requests as failed operations.",
+			err:    &api.ResponseError{StatusCode: 404},
+			want:   reasonOperationFailed,
+		},
+		"Credentials": {
+			reason: "Should categorize other errors creating the store as authentication failures.",
+			err:    errBoom,
+			auth:   true,
+			want:   reasonAuthenticationFailed,
+		},
+		"Other": {
+			reason: "Should categorize other errors as failed operations.",
+			err:    errBoom,
+			want:   reasonOperationFailed,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, failureReason(tc.err, tc.auth)); diff != "" {
+				t.Errorf("\n%s\nfailureReason(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestEventFilter(t *testing.T) {
+	f := &eventFilter{interval: time.Minute, last: map[string]time.Time{}}
+	now := time.Now()
+	if !f.allow("vault/ServerError", now) {
+		t.Errorf("f.allow(...): want first event allowed")
+	}
+	if f.allow("vault/ServerError", now.Add(time.Second)) {
+		t.Errorf("f.allow(...): want duplicate event within the interval filtered")
+	}
+	if !f.allow("vault/PermissionDenied", now.Add(time.Second)) {
+		t.Errorf("f.allow(...): want event with another reason allowed")
+	}
+	if !f.allow("vault/ServerError", now.Add(time.Minute)) {
+		t.Errorf("f.allow(...): want duplicate event after the interval allowed")
+	}
+}
+
+func TestEventTarget(t *testing.T) {
+	cfg := &v1alpha1.VaultConfig{ObjectMeta: metav1.ObjectMeta{Name: "vault"}}
+	if _, ok := eventTarget(cfg).(*v1alpha1.VaultConfig); !ok {
+		t.Errorf("eventTarget(...): want VaultConfig for a cluster scoped config")
+	}
+	cfg.SetNamespace("tenant")
+	if _, ok := eventTarget(cfg).(*v1alpha1.VaultNamespacedConfig); !ok {
+		t.Errorf("eventTarget(...): want VaultNamespacedConfig for a namespaced config")
+	}
+}
@@ -0,0 +1,234 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	v1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	ess "github.com/crossplane/crossplane-runtime/apis/proto/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"github.com/fsnotify/fsnotify"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/apis/config/v1alpha1"
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/webhook"
+)
+
+const (
+	errReadConfigFile        = "cannot read config file"
+	errDecodeConfigFile      = "cannot decode config file"
+	errWatchConfigFile       = "cannot watch config file"
+	errConfigFileKind        = "document %d of the config file is a %s, not a %s"
+	errConfigFileNoName      = "document %d of the config file has no name"
+	errConfigFileDuplicate   = "config %q is defined more than once"
+	errConfigFileInvalid     = "config %q is invalid"
+	errConfigFileCredentials = "config %q: credentials must be sourced from the environment or the filesystem, not %q"
+	errConfigFileNamespaced  = "config reference %q: namespaced configs are not supported with a config file"
+	errConfigFileNotFound    = "config %q is not defined in the config file"
+)
+
+// FileConfigs gets VaultConfigs from a YAML file, which allows running the
+// plugin without access to the Kubernetes API, e.g. as a sidecar or on a VM
+// next to Crossplane. Since there is no API server to read Secrets from,
+// credentials can only be sourced from the environment or the filesystem.
+type FileConfigs struct {
+	path string
+
+	mu      sync.RWMutex
+	configs map[string]*v1alpha1.VaultConfig
+}
+
+// NewFileConfigs returns the VaultConfigs of the supplied file, which contains
+// one or more YAML documents.
+func NewFileConfigs(path string) (*FileConfigs, error) {
+	configs, err := readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &FileConfigs{path: filepath.Clean(path), configs: configs}, nil
+}
+
+// GetConfig returns the VaultConfig referenced by the supplied reference.
+func (c *FileConfigs) GetConfig(_ context.Context, ref *ess.ConfigReference) (*v1alpha1.VaultConfig, error) {
+	if ref == nil {
+		return nil, errors.New("config reference is nil")
+	}
+	if ref.Kind == v1alpha1.VaultNamespacedConfigKind || strings.Contains(ref.Name, "/") {
+		return nil, errors.Errorf(errConfigFileNamespaced, ref.Name)
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	cfg, ok := c.configs[ref.Name]
+	if !ok {
+		return nil, errors.Errorf(errConfigFileNotFound, ref.Name)
+	}
+	return cfg.DeepCopy(), nil
+}
+
+// ListConfigs returns all VaultConfigs of the file, ordered by name.
+func (c *FileConfigs) ListConfigs(_ context.Context) ([]*v1alpha1.VaultConfig, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	cfgs := make([]*v1alpha1.VaultConfig, 0, len(c.configs))
+	for _, cfg := range c.configs {
+		cfgs = append(cfgs, cfg.DeepCopy())
+	}
+	sort.Slice(cfgs, func(i, j int) bool { return cfgs[i].GetName() < cfgs[j].GetName() })
+	return cfgs, nil
+}
+
+// Watch reloads the configs whenever the file changes, until the supplied
+// context is done. The supplied function is called after every reload with
+// the names of the configs that changed or were removed, or with the error
+// that prevented the reload, in which case the previous configs are kept.
+func (c *FileConfigs) Watch(ctx context.Context, reloaded func(changed []string, err error)) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.Wrap(err, errWatchConfigFile)
+	}
+	// The directory is watched rather than the file, so that the file can be
+	// replaced atomically, like Kubernetes does when updating a mounted
+	// ConfigMap by swapping its ..data symlink.
+	if err := w.Add(filepath.Dir(c.path)); err != nil {
+		_ = w.Close()
+		return errors.Wrap(err, errWatchConfigFile)
+	}
+
+	go func() {
+		defer w.Close() //nolint:errcheck // Nothing to do about it.
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				if n := filepath.Base(ev.Name); ev.Name != c.path && n != "..data" {
+					continue
+				}
+				reloaded(c.reload())
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				reloaded(nil, errors.Wrap(err, errWatchConfigFile))
+			}
+		}
+	}()
+	return nil
+}
+
+// reload reads the file again and returns the names of the configs that
+// changed or were removed.
+func (c *FileConfigs) reload() ([]string, error) {
+	configs, err := readConfigFile(c.path)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var changed []string
+	for n, cfg := range c.configs {
+		if nc, ok := configs[n]; !ok || !equality.Semantic.DeepEqual(cfg.Spec, nc.Spec) {
+			changed = append(changed, n)
+		}
+	}
+	c.configs = configs
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// readConfigFile reads and validates the VaultConfigs of the supplied file.
+func readConfigFile(path string) (map[string]*v1alpha1.VaultConfig, error) {
+	b, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, errors.Wrap(err, errReadConfigFile)
+	}
+	return parseConfigs(b)
+}
+
+// parseConfigs parses and validates the VaultConfigs of the supplied YAML
+// documents. Empty documents are skipped.
+func parseConfigs(b []byte) (map[string]*v1alpha1.VaultConfig, error) {
+	configs := map[string]*v1alpha1.VaultConfig{}
+	d := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(b), 4096)
+	for i := 0; ; i++ {
+		cfg := &v1alpha1.VaultConfig{}
+		err := d.Decode(cfg)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, errDecodeConfigFile)
+		}
+		if cfg.Kind == "" && cfg.Name == "" && cfg.Spec == nil {
+			continue
+		}
+		if gvk := cfg.GroupVersionKind(); gvk != v1alpha1.VaultConfigGroupVersionKind {
+			return nil, errors.Errorf(errConfigFileKind, i, gvk, v1alpha1.VaultConfigGroupVersionKind)
+		}
+		if cfg.Name == "" {
+			return nil, errors.Errorf(errConfigFileNoName, i)
+		}
+		if _, ok := configs[cfg.Name]; ok {
+			return nil, errors.Errorf(errConfigFileDuplicate, cfg.Name)
+		}
+		if errs := webhook.ValidateSpec(cfg.Spec, field.NewPath("spec")); len(errs) != 0 {
+			return nil, errors.Wrapf(errs.ToAggregate(), errConfigFileInvalid, cfg.Name)
+		}
+		for _, c := range credentialSelectors(cfg.Spec) {
+			if c.source != v1.CredentialsSourceEnvironment && c.source != v1.CredentialsSourceFilesystem {
+				return nil, errors.Errorf(errConfigFileCredentials, cfg.Name, c.source)
+			}
+		}
+		configs[cfg.Name] = cfg
+	}
+	return configs, nil
+}
+
+// InvalidateOnFileChange reloads the supplied file configs whenever the file
+// changes, dropping the cached Vault stores and secrets of configs that
+// changed, and the rate limiters of configs that were removed.
+func (s *ESSVault) InvalidateOnFileChange(ctx context.Context, fc *FileConfigs) error {
+	return fc.Watch(ctx, func(changed []string, err error) {
+		if err != nil {
+			s.logger.Info("Cannot reload config file, keeping previous configs", "error", err)
+			return
+		}
+		s.logger.Debug("Reloaded config file", "changed", changed)
+		for _, n := range changed {
+			if _, err := fc.GetConfig(ctx, &ess.ConfigReference{Name: n}); err != nil {
+				s.removeConfig(n)
+				continue
+			}
+			s.invalidateConfig(n)
+		}
+	})
+}
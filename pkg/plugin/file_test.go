@@ -0,0 +1,163 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ess "github.com/crossplane/crossplane-runtime/apis/proto/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+const (
+	fileConfig = `
+apiVersion: secrets.crossplane.io/v1alpha1
+kind: VaultConfig
+metadata:
+  name: vault
+spec:
+  server: https://vault.acme.org
+  mountPath: secret/
+  auth:
+    method: Token
+    token:
+      source: Environment
+      env:
+        name: VAULT_TOKEN
+`
+	secretFileConfig = `
+apiVersion: secrets.crossplane.io/v1alpha1
+kind: VaultConfig
+metadata:
+  name: vault
+spec:
+  server: https://vault.acme.org
+  mountPath: secret/
+  auth:
+    method: Token
+    token:
+      source: Secret
+      secretRef:
+        namespace: default
+        name: token
+        key: token
+`
+)
+
+func TestParseConfigs(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		file   string
+		names  []string
+		err    error
+	}{
+		"MultipleDocuments": {
+			reason: "Should parse all documents, skipping empty ones.",
+			file: "---\n" + fileConfig + "---\n---\n" + `
+apiVersion: secrets.crossplane.io/v1alpha1
+kind: VaultConfig
+metadata:
+  name: other
+spec:
+  server: http://localhost:8200
+  mountPath: kv/
+  auth:
+    method: Kubernetes
+    kubernetes:
+      role: crossplane
+`,
+			names: []string{"other", "vault"},
+		},
+		"WrongKind": {
+			reason: "Should reject documents that are not VaultConfigs.",
+			file:   "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: vault\n",
+			err:    errors.Errorf(errConfigFileKind, 0, "/v1, Kind=ConfigMap", "secrets.crossplane.io/v1alpha1, Kind=VaultConfig"),
+		},
+		"Duplicate": {
+			reason: "Should reject configs defined more than once.",
+			file:   fileConfig + "---\n" + fileConfig,
+			err:    errors.Errorf(errConfigFileDuplicate, "vault"),
+		},
+		"SecretCredentials": {
+			reason: "Should reject credentials sourced from Secrets.",
+			file:   secretFileConfig,
+			err:    errors.Errorf(errConfigFileCredentials, "vault", "Secret"),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			configs, err := parseConfigs([]byte(tc.file))
+			if diff := cmp.Diff(tc.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nparseConfigs(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			var names []string
+			for n := range configs {
+				names = append(names, n)
+			}
+			if diff := cmp.Diff(tc.names, names, cmpopts.SortSlices(func(a, b string) bool { return a < b })); diff != "" {
+				t.Errorf("\n%s\nparseConfigs(...): -want names, +got names:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestFileConfigsReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "configs.yaml")
+	if err := os.WriteFile(path, []byte(fileConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fc, err := NewFileConfigs(path)
+	if err != nil {
+		t.Fatalf("NewFileConfigs(...): %v", err)
+	}
+	if _, err := fc.GetConfig(context.Background(), &ess.ConfigReference{Name: "vault"}); err != nil {
+		t.Errorf("fc.GetConfig(...): %v", err)
+	}
+	if _, err := fc.GetConfig(context.Background(), &ess.ConfigReference{Name: "default/vault"}); err == nil {
+		t.Errorf("fc.GetConfig(...): want error for namespaced config reference")
+	}
+
+	if err := os.WriteFile(path, []byte(secretFileConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fc.reload(); err == nil {
+		t.Errorf("fc.reload(): want error for invalid config file")
+	}
+	if _, err := fc.GetConfig(context.Background(), &ess.ConfigReference{Name: "vault"}); err != nil {
+		t.Errorf("fc.GetConfig(...): want previous config after failed reload: %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("---\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := fc.reload()
+	if err != nil {
+		t.Errorf("fc.reload(): %v", err)
+	}
+	if diff := cmp.Diff([]string{"vault"}, changed); diff != "" {
+		t.Errorf("fc.reload(): -want changed, +got changed:\n%s", diff)
+	}
+	if _, err := fc.GetConfig(context.Background(), &ess.ConfigReference{Name: "vault"}); err == nil {
+		t.Errorf("fc.GetConfig(...): want error for removed config")
+	}
+}
@@ -0,0 +1,200 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"time"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/rest"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/apis/config/v1alpha1"
+	vault "github.com/crossplane-contrib/ess-plugin-vault/pkg/vault"
+)
+
+const (
+	errNewOwnerLister = "cannot create owner lister"
+	errDiscoverOwners = "cannot discover owner types"
+	errListOwnersOf   = "cannot list %s"
+	errListConfigs    = "cannot list configs"
+
+	// ownersPageSize is the number of owners listed per request.
+	ownersPageSize = 500
+)
+
+// ownerCategories are the categories of the Crossplane resources that own
+// connection secrets, i.e. managed resources, composite resources and claims.
+var ownerCategories = map[string]bool{"managed": true, "composite": true, "claim": true}
+
+// A KubeOwnerLister lists the Kubernetes objects that may own connection
+// secrets. It discovers their types by their categories, and only lists their
+// metadata.
+type KubeOwnerLister struct {
+	discovery discovery.DiscoveryInterface
+	metadata  metadata.Interface
+	groups    map[string]bool
+}
+
+// NewKubeOwnerLister returns a KubeOwnerLister for the supplied config. It
+// only lists the owners of the supplied API groups, or of all API groups if
+// none are supplied.
+func NewKubeOwnerLister(cfg *rest.Config, groups ...string) (*KubeOwnerLister, error) {
+	d, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, errNewOwnerLister)
+	}
+	m, err := metadata.NewForConfig(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, errNewOwnerLister)
+	}
+	l := &KubeOwnerLister{discovery: d, metadata: m}
+	if len(groups) > 0 {
+		l.groups = make(map[string]bool, len(groups))
+		for _, g := range groups {
+			l.groups[g] = true
+		}
+	}
+	return l, nil
+}
+
+// OwnerUIDs returns the UIDs of all managed resources, composite resources and
+// claims of the configured API groups. It fails if any of these groups cannot
+// be discovered, since their objects could own secrets.
+func (l *KubeOwnerLister) OwnerUIDs(ctx context.Context) (map[string]bool, error) {
+	lists, err := l.resources()
+	if err != nil {
+		return nil, errors.Wrap(err, errDiscoverOwners)
+	}
+
+	uids := map[string]bool{}
+	for _, list := range lists {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			return nil, errors.Wrap(err, errDiscoverOwners)
+		}
+		for _, r := range list.APIResources {
+			if !isOwner(r) {
+				continue
+			}
+			gvr := gv.WithResource(r.Name)
+			opts := metav1.ListOptions{Limit: ownersPageSize}
+			for {
+				ol, err := l.metadata.Resource(gvr).List(ctx, opts)
+				if err != nil {
+					return nil, errors.Wrapf(err, errListOwnersOf, gvr)
+				}
+				for _, o := range ol.Items {
+					uids[string(o.GetUID())] = true
+				}
+				if opts.Continue = ol.GetContinue(); opts.Continue == "" {
+					break
+				}
+			}
+		}
+	}
+	return uids, nil
+}
+
+// resources returns the preferred resources of the configured API groups.
+// Configured groups the API server does not serve have no resources.
+func (l *KubeOwnerLister) resources() ([]*metav1.APIResourceList, error) {
+	if l.groups == nil {
+		return discovery.ServerPreferredResources(l.discovery)
+	}
+	gl, err := l.discovery.ServerGroups()
+	if err != nil {
+		return nil, err
+	}
+	var lists []*metav1.APIResourceList
+	for _, g := range gl.Groups {
+		if !l.groups[g.Name] {
+			continue
+		}
+		list, err := l.discovery.ServerResourcesForGroupVersion(g.PreferredVersion.GroupVersion)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, list)
+	}
+	return lists, nil
+}
+
+// isOwner returns true if objects of the supplied resource may own connection
+// secrets and can be listed.
+func isOwner(r metav1.APIResource) bool {
+	owner := false
+	for _, c := range r.Categories {
+		owner = owner || ownerCategories[c]
+	}
+	if !owner {
+		return false
+	}
+	for _, v := range r.Verbs {
+		if v == "list" {
+			return true
+		}
+	}
+	return false
+}
+
+// CollectGarbage collects the orphaned secrets of all VaultConfigs with the
+// supplied Collector, every interval until the supplied context is done.
+// VaultNamespacedConfigs are not collected, since their tenants are
+// responsible for their mounts.
+func (s *ESSVault) CollectGarbage(ctx context.Context, c *vault.Collector, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if err := s.collectGarbage(ctx, c); err != nil {
+			s.logger.Info("Cannot collect orphaned secrets", "error", err)
+		}
+	}
+}
+
+func (s *ESSVault) collectGarbage(ctx context.Context, c *vault.Collector) error {
+	since, done := s.beginStore()
+	defer done()
+	l := &v1alpha1.VaultConfigList{}
+	if err := s.kube.List(ctx, l); err != nil {
+		return errors.Wrap(err, errListConfigs)
+	}
+	for i := range l.Items {
+		cfg := &l.Items[i]
+		ss, err := s.store(ctx, cfg, since)
+		if err != nil {
+			s.logger.Info("Cannot collect orphaned secrets", "config", cfg.GetName(), "error", errors.Wrap(err, errVaultStore))
+			continue
+		}
+		res, err := c.Collect(ctx, ss, "")
+		if err != nil {
+			s.logger.Info("Cannot collect orphaned secrets", "config", cfg.GetName(), "error", err)
+			continue
+		}
+		s.logger.Debug("Collected orphaned secrets", "config", cfg.GetName(), "owned", res.Owned, "orphans", len(res.Orphans), "deleted", len(res.Deleted))
+	}
+	return nil
+}
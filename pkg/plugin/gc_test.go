@@ -0,0 +1,111 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	fakemetadata "k8s.io/client-go/metadata/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestOwnerUIDs(t *testing.T) {
+	object := func(apiVersion, kind, namespace, name, uid string) *metav1.PartialObjectMetadata {
+		return &metav1.PartialObjectMetadata{
+			TypeMeta:   metav1.TypeMeta{APIVersion: apiVersion, Kind: kind},
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, UID: types.UID(uid)},
+		}
+	}
+	s := runtime.NewScheme()
+	if err := metav1.AddMetaToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	d := &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{Resources: []*metav1.APIResourceList{
+		{
+			GroupVersion: "database.example.org/v1alpha1",
+			APIResources: []metav1.APIResource{
+				{Name: "instances", Kind: "Instance", Verbs: []string{"get", "list"}, Categories: []string{"crossplane", "managed"}},
+				{Name: "xdatabases", Kind: "XDatabase", Verbs: []string{"get", "list"}, Categories: []string{"composite"}},
+				{Name: "databases", Kind: "Database", Namespaced: true, Verbs: []string{"get", "list"}, Categories: []string{"claim"}},
+				{Name: "settings", Kind: "Setting", Verbs: []string{"get", "list"}, Categories: []string{"crossplane"}},
+			},
+		},
+		{
+			GroupVersion: "cache.example.org/v1alpha1",
+			APIResources: []metav1.APIResource{
+				{Name: "clusters", Kind: "Cluster", Verbs: []string{"get", "list"}, Categories: []string{"managed"}},
+			},
+		},
+	}}}
+	objects := []runtime.Object{
+		object("database.example.org/v1alpha1", "Instance", "", "db", "instance-uid"),
+		object("database.example.org/v1alpha1", "XDatabase", "", "db", "composite-uid"),
+		object("database.example.org/v1alpha1", "Database", "team", "db", "claim-uid"),
+		object("database.example.org/v1alpha1", "Setting", "", "db", "setting-uid"),
+		object("cache.example.org/v1alpha1", "Cluster", "", "cache", "cluster-uid"),
+	}
+
+	cases := map[string]struct {
+		reason    string
+		groups    []string
+		forbidden string
+		want      map[string]bool
+	}{
+		"AllGroups": {
+			reason: "Should list the owners of all groups if no groups are configured.",
+			want:   map[string]bool{"instance-uid": true, "composite-uid": true, "claim-uid": true, "cluster-uid": true},
+		},
+		"ConfiguredGroups": {
+			reason:    "Should only list the owners of the configured groups, so that other groups need not be listable.",
+			groups:    []string{"database.example.org", "absent.example.org"},
+			forbidden: "clusters",
+			want:      map[string]bool{"instance-uid": true, "composite-uid": true, "claim-uid": true},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			m := fakemetadata.NewSimpleMetadataClient(s, objects...)
+			if tc.forbidden != "" {
+				m.PrependReactor("list", tc.forbidden, func(clienttesting.Action) (bool, runtime.Object, error) {
+					return true, nil, kerrors.NewForbidden(schema.GroupResource{Resource: tc.forbidden}, "", nil)
+				})
+			}
+			l := &KubeOwnerLister{discovery: d, metadata: m}
+			if len(tc.groups) > 0 {
+				l.groups = map[string]bool{}
+				for _, g := range tc.groups {
+					l.groups[g] = true
+				}
+			}
+			got, err := l.OwnerUIDs(context.Background())
+			if err != nil {
+				t.Fatalf("\n%s\nl.OwnerUIDs(...): %v", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\nl.OwnerUIDs(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
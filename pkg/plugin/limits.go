@@ -0,0 +1,206 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/apis/config/v1alpha1"
+)
+
+const errRateLimited = "rate limit of config %q exceeded"
+
+// defaultQueueTimeout is the longest time a request is queued if the rate
+// limit of its config does not configure one.
+const defaultQueueTimeout = 10 * time.Second
+
+// limiters holds the limiter of every config with a rate limit.
+type limiters struct {
+	mu      sync.Mutex
+	entries map[string]*limiter
+}
+
+func newLimiters() *limiters {
+	return &limiters{entries: map[string]*limiter{}}
+}
+
+// get returns the limiter of the supplied config, or nil if it has no rate
+// limit. Limiters are replaced when the rate limit of their config changes,
+// see newLimiter.
+func (ls *limiters) get(cfg *v1alpha1.VaultConfig) *limiter {
+	key := configKey(cfg)
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	var rl *v1alpha1.VaultRateLimit
+	if cfg.Spec != nil {
+		rl = cfg.Spec.RateLimit
+	}
+	if rl == nil {
+		delete(ls.entries, key)
+		return nil
+	}
+	prev, ok := ls.entries[key]
+	if ok && cmp.Equal(prev.spec, *rl) {
+		return prev
+	}
+	l := newLimiter(key, *rl, prev)
+	ls.entries[key] = l
+	return l
+}
+
+// forget drops the limiter of the supplied config key, e.g. because the config
+// was deleted.
+func (ls *limiters) forget(key string) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	delete(ls.entries, key)
+}
+
+// A limiter limits the rate and concurrency of the requests served with a
+// config.
+type limiter struct {
+	config string
+	spec   v1alpha1.VaultRateLimit
+
+	rate    *rate.Limiter
+	slots   chan struct{}
+	timeout time.Duration
+}
+
+// newLimiter returns a limiter with the supplied rate limit, which replaces the
+// supplied previous limiter of the config, if any. The rate and slots of the
+// previous limiter are kept where possible, so that changing the rate limit
+// does not admit a burst of requests. Requests in flight keep their slots of
+// the previous limiter though, so if MaxInFlight changed, up to its previous
+// value more requests may be served concurrently until they complete.
+func newLimiter(config string, spec v1alpha1.VaultRateLimit, prev *limiter) *limiter {
+	l := &limiter{config: config, spec: spec, timeout: defaultQueueTimeout}
+	if spec.RequestsPerSecond > 0 {
+		burst := spec.Burst
+		if burst == 0 {
+			burst = spec.RequestsPerSecond
+		}
+		if prev != nil && prev.rate != nil {
+			prev.rate.SetLimit(rate.Limit(spec.RequestsPerSecond))
+			prev.rate.SetBurst(burst)
+			l.rate = prev.rate
+		} else {
+			l.rate = rate.NewLimiter(rate.Limit(spec.RequestsPerSecond), burst)
+		}
+	}
+	if spec.MaxInFlight > 0 {
+		if prev != nil && cap(prev.slots) == spec.MaxInFlight {
+			l.slots = prev.slots
+		} else {
+			l.slots = make(chan struct{}, spec.MaxInFlight)
+		}
+	}
+	if spec.QueueTimeout != nil {
+		l.timeout = spec.QueueTimeout.Duration
+	}
+	return l
+}
+
+// acquire returns once the supplied request may be served, queueing it if
+// needed. The returned function must be called once it was served. Requests
+// that cannot be served before their queue deadline, which is the earlier of
+// the queue timeout and their own deadline, are rejected with
+// ResourceExhausted without waiting for the deadline if possible.
+func (l *limiter) acquire(ctx context.Context) (func(), error) {
+	ctx, cancel := context.WithTimeout(ctx, l.timeout)
+	defer cancel()
+
+	queued := false
+	queue := func() {
+		if !queued {
+			queued = true
+			rateLimitQueued.WithLabelValues(l.config).Inc()
+		}
+	}
+	defer func() {
+		if queued {
+			rateLimitQueued.WithLabelValues(l.config).Dec()
+		}
+	}()
+
+	release := func() {}
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			queue()
+			select {
+			case l.slots <- struct{}{}:
+			case <-ctx.Done():
+				return nil, l.reject(ctx)
+			}
+		}
+		release = func() { <-l.slots }
+	}
+
+	if l.rate != nil {
+		r := l.rate.Reserve()
+		d := r.Delay()
+		if d > 0 {
+			if dl, _ := ctx.Deadline(); time.Now().Add(d).After(dl) {
+				// The request would still be queued at its deadline.
+				r.Cancel()
+				release()
+				return nil, l.reject(ctx)
+			}
+			queue()
+			t := time.NewTimer(d)
+			defer t.Stop()
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				r.Cancel()
+				release()
+				return nil, l.reject(ctx)
+			}
+		}
+	}
+	return release, nil
+}
+
+// reject returns the error of a request that could not be served before its
+// queue deadline. Requests canceled by their client are not counted as
+// rejected.
+func (l *limiter) reject(ctx context.Context) error {
+	if ctx.Err() == context.Canceled {
+		return status.FromContextError(ctx.Err()).Err()
+	}
+	rateLimitRejected.WithLabelValues(l.config).Inc()
+	return status.Errorf(codes.ResourceExhausted, errRateLimited, l.config)
+}
+
+// limit returns once a request with the supplied config may be served. The
+// returned function must be called once it was served.
+func (s *ESSVault) limit(ctx context.Context, cfg *v1alpha1.VaultConfig) (func(), error) {
+	l := s.limits.get(cfg)
+	if l == nil {
+		return func() {}, nil
+	}
+	return l.acquire(ctx)
+}
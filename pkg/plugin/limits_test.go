@@ -0,0 +1,132 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/apis/config/v1alpha1"
+)
+
+func TestLimiterMaxInFlight(t *testing.T) {
+	l := newLimiter("vault", v1alpha1.VaultRateLimit{MaxInFlight: 1, QueueTimeout: &metav1.Duration{Duration: 20 * time.Millisecond}}, nil)
+
+	release, err := l.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("l.acquire(...): %v", err)
+	}
+	if _, err := l.acquire(context.Background()); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("l.acquire(...): want ResourceExhausted while the only slot is in use, got %v", err)
+	}
+
+	done := make(chan error)
+	go func() {
+		r, err := l.acquire(context.Background())
+		if err == nil {
+			r()
+		}
+		done <- err
+	}()
+	release()
+	if err := <-done; err != nil {
+		t.Errorf("l.acquire(...): want queued request to be served once the slot was released, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	release, _ = l.acquire(context.Background())
+	defer release()
+	if _, err := l.acquire(ctx); status.Code(err) != codes.Canceled {
+		t.Errorf("l.acquire(...): want Canceled for a canceled request, got %v", err)
+	}
+}
+
+func TestLimiterRate(t *testing.T) {
+	l := newLimiter("vault", v1alpha1.VaultRateLimit{RequestsPerSecond: 1}, nil)
+
+	if _, err := l.acquire(context.Background()); err != nil {
+		t.Fatalf("l.acquire(...): %v", err)
+	}
+
+	// The next token is available in a second, so a request that must be
+	// served sooner is rejected without waiting.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := l.acquire(ctx); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("l.acquire(...): want ResourceExhausted beyond the request deadline, got %v", err)
+	}
+	if d := time.Since(start); d > 50*time.Millisecond {
+		t.Errorf("l.acquire(...): want immediate rejection, waited %s", d)
+	}
+
+	start = time.Now()
+	if _, err := l.acquire(context.Background()); err != nil {
+		t.Errorf("l.acquire(...): want queued request to be served, got %v", err)
+	}
+	if d := time.Since(start); d < 500*time.Millisecond {
+		t.Errorf("l.acquire(...): want request to be queued for the next token, waited %s", d)
+	}
+}
+
+func TestLimiters(t *testing.T) {
+	ls := newLimiters()
+	cfg := &v1alpha1.VaultConfig{}
+	cfg.SetName("vault")
+
+	if l := ls.get(cfg); l != nil {
+		t.Errorf("ls.get(...): want no limiter without a spec")
+	}
+
+	cfg.Spec = &v1alpha1.VaultConfigSpec{}
+	if l := ls.get(cfg); l != nil {
+		t.Errorf("ls.get(...): want no limiter without a rate limit")
+	}
+
+	cfg.Spec.RateLimit = &v1alpha1.VaultRateLimit{MaxInFlight: 1, QueueTimeout: &metav1.Duration{Duration: time.Second}}
+	l := ls.get(cfg)
+	// Configs are decoded anew for every request.
+	cfg.Spec.RateLimit = &v1alpha1.VaultRateLimit{MaxInFlight: 1, QueueTimeout: &metav1.Duration{Duration: time.Second}}
+	if l == nil || ls.get(cfg) != l {
+		t.Errorf("ls.get(...): want the same limiter while the rate limit is unchanged")
+	}
+
+	release, err := l.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("l.acquire(...): %v", err)
+	}
+	defer release()
+	cfg.Spec.RateLimit = &v1alpha1.VaultRateLimit{MaxInFlight: 1, QueueTimeout: &metav1.Duration{Duration: 20 * time.Millisecond}}
+	got := ls.get(cfg)
+	if got == l {
+		t.Errorf("ls.get(...): want a new limiter after the rate limit changed")
+	}
+	if _, err := got.acquire(context.Background()); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("got.acquire(...): want ResourceExhausted while the request in flight holds the slot, got %v", err)
+	}
+
+	ls.forget(configKey(cfg))
+	if got := ls.get(cfg); got == l || len(got.slots) != 0 {
+		t.Errorf("ls.get(...): want a new, empty limiter after the config was forgotten")
+	}
+}
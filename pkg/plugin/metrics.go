@@ -0,0 +1,42 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package plugin
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const metricsNamespace = "ess_plugin_vault"
+
+var (
+	rateLimitQueued = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "rate_limit_queued_requests",
+		Help:      "Number of requests waiting for the rate or concurrency limit of their config.",
+	}, []string{"config"})
+
+	rateLimitRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "rate_limit_rejected_requests_total",
+		Help:      "Number of requests rejected because the rate or concurrency limit of their config was exceeded until their queue deadline.",
+	}, []string{"config"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(rateLimitQueued, rateLimitRejected)
+}
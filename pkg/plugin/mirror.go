@@ -0,0 +1,87 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	ess "github.com/crossplane/crossplane-runtime/apis/proto/v1alpha1"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/apis/config/v1alpha1"
+	vault "github.com/crossplane-contrib/ess-plugin-vault/pkg/vault"
+)
+
+const (
+	errGetMirror    = "cannot get mirror config"
+	errMirrorStore  = "cannot create Vault store of mirror config %q"
+	errMirrorItself = "config %q cannot mirror to itself"
+)
+
+// NewStore returns the Vault store of the supplied config. If the config has a
+// mirror, the store of the mirror config is created too, getting it from the
+// supplied ConfigGetter.
+func NewStore(ctx context.Context, kube client.Client, configs ConfigGetter, cfg *v1alpha1.VaultConfig, opts ...vault.StoreOption) (*vault.SecretStore, error) {
+	if cfg.Spec != nil && cfg.Spec.Mirror != nil {
+		mcfg, err := mirrorConfig(ctx, configs, cfg)
+		if err != nil {
+			return nil, err
+		}
+		ms, err := vault.NewVaultStore(ctx, kube, mcfg, opts...)
+		if err != nil {
+			return nil, errors.Wrapf(err, errMirrorStore, configKey(mcfg))
+		}
+		opts = append(opts, vault.WithMirror(ms))
+	}
+	return vault.NewVaultStore(ctx, kube, cfg, opts...)
+}
+
+// mirrorConfig returns the mirror config of the supplied config, without its
+// own mirror. The mirror of a VaultNamespacedConfig is a VaultNamespacedConfig
+// in its namespace.
+func mirrorConfig(ctx context.Context, configs ConfigGetter, cfg *v1alpha1.VaultConfig) (*v1alpha1.VaultConfig, error) {
+	ref := &ess.ConfigReference{Kind: v1alpha1.VaultConfigKind, Name: mirrorKey(cfg)}
+	if cfg.GetNamespace() != "" {
+		ref.Kind = v1alpha1.VaultNamespacedConfigKind
+	}
+	if ref.Name == configKey(cfg) {
+		return nil, errors.Errorf(errMirrorItself, ref.Name)
+	}
+	mcfg, err := configs.GetConfig(ctx, ref)
+	if err != nil {
+		return nil, errors.Wrap(err, errGetMirror)
+	}
+	mcfg = mcfg.DeepCopy()
+	if mcfg.Spec != nil {
+		mcfg.Spec.Mirror = nil
+	}
+	return mcfg, nil
+}
+
+// mirrorKey returns the config key of the mirror of the supplied config, if
+// any.
+func mirrorKey(cfg *v1alpha1.VaultConfig) string {
+	if cfg.Spec == nil || cfg.Spec.Mirror == nil {
+		return ""
+	}
+	if ns := cfg.GetNamespace(); ns != "" {
+		return ns + "/" + cfg.Spec.Mirror.Name
+	}
+	return cfg.Spec.Mirror.Name
+}
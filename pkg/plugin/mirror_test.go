@@ -0,0 +1,108 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	ess "github.com/crossplane/crossplane-runtime/apis/proto/v1alpha1"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/apis/config/v1alpha1"
+)
+
+func TestMirrorConfig(t *testing.T) {
+	errBoom := errors.New("boom")
+	mirrored := func(ns, name, mirror string) *v1alpha1.VaultConfig {
+		return &v1alpha1.VaultConfig{
+			ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: name},
+			Spec:       &v1alpha1.VaultConfigSpec{Mirror: &v1alpha1.VaultMirrorConfig{Name: mirror}},
+		}
+	}
+
+	type want struct {
+		ref *ess.ConfigReference
+		cfg *v1alpha1.VaultConfig
+		err error
+	}
+	cases := map[string]struct {
+		reason string
+		cfg    *v1alpha1.VaultConfig
+		getErr error
+		want   want
+	}{
+		"Cluster": {
+			reason: "Should get the VaultConfig named by the mirror of a VaultConfig, without its own mirror.",
+			cfg:    mirrored("", "primary", "secondary"),
+			want: want{
+				ref: &ess.ConfigReference{Kind: v1alpha1.VaultConfigKind, Name: "secondary"},
+				cfg: &v1alpha1.VaultConfig{ObjectMeta: metav1.ObjectMeta{Name: "secondary"}, Spec: &v1alpha1.VaultConfigSpec{}},
+			},
+		},
+		"Namespaced": {
+			reason: "Should get the VaultNamespacedConfig in the namespace of a VaultNamespacedConfig.",
+			cfg:    mirrored("tenant", "primary", "secondary"),
+			want: want{
+				ref: &ess.ConfigReference{Kind: v1alpha1.VaultNamespacedConfigKind, Name: "tenant/secondary"},
+				cfg: &v1alpha1.VaultConfig{ObjectMeta: metav1.ObjectMeta{Name: "secondary"}, Spec: &v1alpha1.VaultConfigSpec{}},
+			},
+		},
+		"Itself": {
+			reason: "Should not allow a config to mirror to itself.",
+			cfg:    mirrored("tenant", "primary", "primary"),
+			want:   want{err: errors.Errorf(errMirrorItself, "tenant/primary")},
+		},
+		"GetError": {
+			reason: "Should return errors getting the mirror config.",
+			cfg:    mirrored("", "primary", "secondary"),
+			getErr: errBoom,
+			want: want{
+				ref: &ess.ConfigReference{Kind: v1alpha1.VaultConfigKind, Name: "secondary"},
+				err: errors.Wrap(errBoom, errGetMirror),
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var ref *ess.ConfigReference
+			configs := configGetterFn(func(_ context.Context, r *ess.ConfigReference) (*v1alpha1.VaultConfig, error) {
+				ref = r
+				if tc.getErr != nil {
+					return nil, tc.getErr
+				}
+				// The mirror has a mirror of its own, which must be ignored.
+				return mirrored("", "secondary", "tertiary"), nil
+			})
+			got, err := mirrorConfig(context.Background(), configs, tc.cfg)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nmirrorConfig(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.ref, ref, protocmp.Transform()); diff != "" {
+				t.Errorf("\n%s\nmirrorConfig(...): -want reference, +got reference:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.cfg, got); diff != "" {
+				t.Errorf("\n%s\nmirrorConfig(...): -want config, +got config:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"time"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/apis/config/v1alpha1"
+)
+
+// PurgeDeleted permanently deletes the soft deleted secrets of all configs with
+// the DestroyAfter deletion policy once their retention period elapsed, every
+// interval until the supplied context is done. Configs can only be listed if
+// the ConfigGetter of the ESSVault is a ConfigLister.
+func (s *ESSVault) PurgeDeleted(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if err := s.purgeDeleted(ctx); err != nil {
+			s.logger.Info("Cannot purge deleted secrets", "error", err)
+		}
+	}
+}
+
+func (s *ESSVault) purgeDeleted(ctx context.Context) error {
+	l, ok := s.configs.(ConfigLister)
+	if !ok {
+		return nil
+	}
+	since, done := s.beginStore()
+	defer done()
+	cfgs, err := l.ListConfigs(ctx)
+	if err != nil {
+		return err
+	}
+	for _, cfg := range cfgs {
+		if !destroysAfter(cfg) {
+			continue
+		}
+		key := configKey(cfg)
+		ss, err := s.store(ctx, cfg, since)
+		if err != nil {
+			s.logger.Info("Cannot purge deleted secrets", "config", key, "error", errors.Wrap(err, errVaultStore))
+			continue
+		}
+		purged, err := ss.Purge(ctx, "")
+		for _, p := range purged {
+			s.logger.Info("Purged deleted secret", "config", key, "path", p)
+		}
+		if err != nil {
+			s.logger.Info("Cannot purge deleted secrets", "config", key, "error", err)
+		}
+	}
+	return nil
+}
+
+// destroysAfter returns true if the supplied config soft deletes secrets and
+// destroys them after a retention period.
+func destroysAfter(cfg *v1alpha1.VaultConfig) bool {
+	return cfg.Spec != nil && cfg.Spec.DeletionPolicy != nil && cfg.Spec.DeletionPolicy.Mode == v1alpha1.VaultDeletionDestroyAfter
+}
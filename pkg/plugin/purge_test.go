@@ -0,0 +1,150 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	ess "github.com/crossplane/crossplane-runtime/apis/proto/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/apis/config/v1alpha1"
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/vault/kv"
+)
+
+// configList is a ConfigLister of the supplied configs.
+type configList []*v1alpha1.VaultConfig
+
+func (l configList) GetConfig(_ context.Context, ref *ess.ConfigReference) (*v1alpha1.VaultConfig, error) {
+	return nil, errors.Errorf("config %q not found", ref.GetName())
+}
+
+func (l configList) ListConfigs(_ context.Context) ([]*v1alpha1.VaultConfig, error) {
+	return l, nil
+}
+
+func TestPurgeDeleted(t *testing.T) {
+	now := time.Now().UTC()
+	deleted := func(at time.Time) string {
+		return fmt.Sprintf(`{"data": {"data": null, "metadata": {"version": 1, "deletion_time": %q, "custom_metadata": {%q: %q}}}}`,
+			at.Format(time.RFC3339Nano), kv.DeletedAtLabel, at.Format(time.RFC3339))
+	}
+	secrets := map[string]string{
+		"/v1/secret/data/ns/expired": deleted(now.Add(-48 * time.Hour)),
+		"/v1/secret/data/ns/recent":  deleted(now.Add(-time.Hour)),
+		"/v1/secret/data/ns/live":    `{"data": {"data": {"k": "v"}, "metadata": {"version": 1}}}`,
+	}
+
+	var mu sync.Mutex
+	var destroyed []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v1/auth/kubernetes/login":
+			_, _ = fmt.Fprint(w, `{"auth": {"client_token": "s.token"}}`)
+		case r.Method == "LIST" || r.URL.Query().Get("list") == "true":
+			switch r.URL.Path {
+			case "/v1/secret/metadata", "/v1/secret/metadata/":
+				_, _ = fmt.Fprint(w, `{"data": {"keys": ["ns/"]}}`)
+			case "/v1/secret/metadata/ns", "/v1/secret/metadata/ns/":
+				_, _ = fmt.Fprint(w, `{"data": {"keys": ["expired", "live", "recent"]}}`)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case r.Method == http.MethodGet:
+			body, ok := secrets[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			var s map[string]any
+			if err := json.Unmarshal([]byte(body), &s); err != nil {
+				t.Fatal(err)
+			}
+			if s["data"].(map[string]any)["data"] == nil {
+				// Vault responds with not found for deleted versions.
+				w.WriteHeader(http.StatusNotFound)
+			}
+			_, _ = fmt.Fprint(w, body)
+		case r.Method == http.MethodDelete:
+			mu.Lock()
+			destroyed = append(destroyed, r.URL.Path)
+			mu.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenPath, []byte("jwt"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config := func(name string, p *v1alpha1.VaultDeletionPolicy) *v1alpha1.VaultConfig {
+		return &v1alpha1.VaultConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: &v1alpha1.VaultConfigSpec{
+				Server:         srv.URL,
+				MountPath:      "secret",
+				DeletionPolicy: p,
+				Auth: v1alpha1.VaultAuthConfig{
+					Method: v1alpha1.VaultAuthKubernetes,
+					Kubernetes: &v1alpha1.VaultAuthKubernetesConfig{
+						Role: "crossplane",
+						ServiceAccountTokenSource: &v1alpha1.ServiceAccountTokenSourceConfig{
+							Source:                    xpv1.CredentialsSourceFilesystem,
+							CommonCredentialSelectors: xpv1.CommonCredentialSelectors{Fs: &xpv1.FsSelector{Path: tokenPath}},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	s, err := NewESSVault(nil, nil, nil, WithConfigGetter(configList{
+		config("destroy-after", &v1alpha1.VaultDeletionPolicy{
+			Mode:         v1alpha1.VaultDeletionDestroyAfter,
+			DestroyAfter: &metav1.Duration{Duration: 24 * time.Hour},
+		}),
+		config("soft-delete", &v1alpha1.VaultDeletionPolicy{Mode: v1alpha1.VaultDeletionSoftDelete}),
+		config("default", nil),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.purgeDeleted(context.Background()); err != nil {
+		t.Errorf("s.purgeDeleted(...): %v", err)
+	}
+	want := []string{"/v1/secret/metadata/ns/expired"}
+	if diff := cmp.Diff(want, destroyed); diff != "" {
+		t.Errorf("s.purgeDeleted(...): -want destroyed, +got destroyed:\n%s", diff)
+	}
+}
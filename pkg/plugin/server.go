@@ -3,23 +3,33 @@ package plugin
 import (
 	"context"
 	"net"
+	"sort"
+	"strings"
+	"time"
 
 	v1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
 	ess "github.com/crossplane/crossplane-runtime/apis/proto/v1alpha1"
 	constore "github.com/crossplane/crossplane-runtime/pkg/connection/store"
 	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"github.com/crossplane/crossplane-runtime/pkg/event"
 	"github.com/crossplane/crossplane-runtime/pkg/logging"
 	"google.golang.org/grpc"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/crossplane-contrib/ess-plugin-vault/apis/config/v1alpha1"
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/audit"
 	vault "github.com/crossplane-contrib/ess-plugin-vault/pkg/vault"
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/webhook"
 )
 
 const (
 	errGetConfig  = "could not get config"
 	errVaultStore = "could not create new Vault Store"
+
+	errNoConfigNamespace = "namespaced config reference %q is not of the form <namespace>/<name>"
+	errNamespacedConfig  = "invalid namespaced config"
 )
 
 // Server defines the available operations for gRPC ESSVault.
@@ -37,33 +47,91 @@ type ESSVault struct {
 	listener   net.Listener
 	grpcServer *grpc.Server
 	kube       client.Client
+	configs    ConfigGetter
 	logger     logging.Logger
+	locker     *vault.PathLocker
+	stores     *storeCache
+	audit      audit.Logger
+	recorder   event.Recorder
+	events     *eventFilter
+	servers    *vault.ServerSelector
+	reads      *vault.ReadCache
+	limits     *limiters
+
+	serverCheckInterval time.Duration
 
 	ess.UnimplementedExternalSecretStorePluginServiceServer
 }
 
 type ESSVaultOption func(*ESSVault)
 
+// A ConfigGetter returns the VaultConfig referenced by a ConfigReference.
+type ConfigGetter interface {
+	GetConfig(ctx context.Context, ref *ess.ConfigReference) (*v1alpha1.VaultConfig, error)
+}
+
 func WithLogger(logger logging.Logger) ESSVaultOption {
 	return func(e *ESSVault) {
 		e.logger = logger
 	}
 }
 
+// WithStoreCache configures the ESSVault to reuse Vault stores, including their
+// authenticated clients, for the supplied duration.
+func WithStoreCache(ttl time.Duration) ESSVaultOption {
+	return func(e *ESSVault) {
+		e.stores = newStoreCache(ttl)
+	}
+}
+
+// WithReadCache configures the ESSVault to cache up to the supplied number of
+// secrets it reads for the supplied duration.
+func WithReadCache(ttl time.Duration, maxSize int) ESSVaultOption {
+	return func(e *ESSVault) {
+		e.reads = vault.NewReadCache(ttl, maxSize)
+	}
+}
+
+// WithAuditLogger configures the ESSVault to record every secret access and
+// mutation with the supplied audit logger.
+func WithAuditLogger(l audit.Logger) ESSVaultOption {
+	return func(e *ESSVault) {
+		e.audit = l
+	}
+}
+
+// WithConfigGetter configures the ESSVault to get configs from the supplied
+// ConfigGetter instead of the Kubernetes API.
+func WithConfigGetter(g ConfigGetter) ESSVaultOption {
+	return func(e *ESSVault) {
+		e.configs = g
+	}
+}
+
 // NewESSVault creates a new gRPC ESSVault and registers it.
 func NewESSVault(kube client.Client, listener net.Listener, gs *grpc.Server, opts ...ESSVaultOption) (*ESSVault, error) {
 	s := &ESSVault{
 		listener:   listener,
 		kube:       kube,
+		configs:    NewKubeConfigGetter(kube),
 		grpcServer: gs,
+		locker:     vault.NewPathLocker(),
+		limits:     newLimiters(),
 
 		logger: logging.NewNopLogger(),
+		audit:  audit.NopLogger{},
 	}
 
 	for _, opt := range opts {
 		opt(s)
 	}
 
+	so := []vault.ServerSelectorOption{vault.WithServerStatusReporter(s.reportServers)}
+	if s.serverCheckInterval > 0 {
+		so = append(so, vault.WithServerCheckInterval(s.serverCheckInterval))
+	}
+	s.servers = vault.NewServerSelector(so...)
+
 	return s, nil
 }
 
@@ -75,38 +143,191 @@ func (s *ESSVault) GracefulStop() {
 	s.grpcServer.GracefulStop()
 }
 
-func getConfig(ctx context.Context, kube client.Client, ref *ess.ConfigReference) (*v1alpha1.VaultConfig, error) {
+// A ConfigLister lists the VaultConfigs a ConfigGetter returns.
+type ConfigLister interface {
+	ListConfigs(ctx context.Context) ([]*v1alpha1.VaultConfig, error)
+}
+
+// kubeConfigs gets configs from the Kubernetes API.
+type kubeConfigs struct {
+	kube client.Client
+}
+
+// NewKubeConfigGetter returns a ConfigGetter that gets VaultConfigs and
+// VaultNamespacedConfigs from the Kubernetes API.
+func NewKubeConfigGetter(kube client.Client) ConfigGetter {
+	return &kubeConfigs{kube: kube}
+}
+
+// GetConfig returns the VaultConfig referenced by the supplied reference. The
+// reference does not have a namespace field, so a VaultNamespacedConfig is
+// referenced by a name of the form "<namespace>/<name>", which is unambiguous
+// since Kubernetes names cannot contain slashes.
+func (c *kubeConfigs) GetConfig(ctx context.Context, ref *ess.ConfigReference) (*v1alpha1.VaultConfig, error) {
 	if ref == nil {
 		return nil, errors.New("config reference is nil")
 	}
 
-	sc := &v1alpha1.VaultConfig{}
-	if err := kube.Get(ctx, types.NamespacedName{Name: ref.Name}, sc); err != nil {
-		return nil, errors.Wrap(err, "could not get config reference")
+	ns, name, namespaced := strings.Cut(ref.Name, "/")
+	if !namespaced {
+		if ref.Kind == v1alpha1.VaultNamespacedConfigKind {
+			return nil, errors.Errorf(errNoConfigNamespace, ref.Name)
+		}
+		sc := &v1alpha1.VaultConfig{}
+		if err := c.kube.Get(ctx, types.NamespacedName{Name: ref.Name}, sc); err != nil {
+			return nil, errors.Wrap(err, "could not get config reference")
+		}
+		return sc, nil
+	}
+
+	nc := &v1alpha1.VaultNamespacedConfig{}
+	if err := c.kube.Get(ctx, types.NamespacedName{Namespace: ns, Name: name}, nc); err != nil {
+		return nil, errors.Wrap(err, "could not get namespaced config reference")
+	}
+	return fromNamespacedConfig(nc)
+}
+
+// ListConfigs returns all VaultConfigs and VaultNamespacedConfigs. Invalid
+// VaultNamespacedConfigs are skipped, since they cannot be used.
+func (c *kubeConfigs) ListConfigs(ctx context.Context) ([]*v1alpha1.VaultConfig, error) {
+	l := &v1alpha1.VaultConfigList{}
+	if err := c.kube.List(ctx, l); err != nil {
+		return nil, errors.Wrap(err, errListConfigs)
+	}
+	nl := &v1alpha1.VaultNamespacedConfigList{}
+	if err := c.kube.List(ctx, nl); err != nil {
+		return nil, errors.Wrap(err, errListConfigs)
+	}
+	cfgs := make([]*v1alpha1.VaultConfig, 0, len(l.Items)+len(nl.Items))
+	for i := range l.Items {
+		cfgs = append(cfgs, &l.Items[i])
+	}
+	for i := range nl.Items {
+		if cfg, err := fromNamespacedConfig(&nl.Items[i]); err == nil {
+			cfgs = append(cfgs, cfg)
+		}
+	}
+	return cfgs, nil
+}
+
+// fromNamespacedConfig returns a VaultConfig equivalent to the supplied
+// VaultNamespacedConfig, with all credentials restricted to Secrets in its
+// namespace. Other sources, like the filesystem or the environment of the
+// plugin, could expose credentials of the plugin itself to the tenant.
+func fromNamespacedConfig(nc *v1alpha1.VaultNamespacedConfig) (*v1alpha1.VaultConfig, error) {
+	cfg := &v1alpha1.VaultConfig{
+		ObjectMeta: *nc.ObjectMeta.DeepCopy(),
+		Spec:       nc.Spec.DeepCopy(),
+	}
+	if cfg.Spec == nil {
+		return cfg, nil
+	}
+
+	if errs := webhook.ValidateNamespacedCredentials(nc.GetNamespace(), cfg.Spec, field.NewPath("spec")); len(errs) > 0 {
+		return nil, errors.Wrap(errs.ToAggregate(), errNamespacedConfig)
+	}
+
+	// Credentials without a namespace are in the namespace of the config.
+	for _, c := range credentialSelectors(cfg.Spec) {
+		if c.selectors.SecretRef.Namespace == "" {
+			c.selectors.SecretRef.Namespace = nc.GetNamespace()
+		}
+	}
+	return cfg, nil
+}
+
+type credentials struct {
+	source    v1.CredentialsSource
+	selectors *v1.CommonCredentialSelectors
+}
+
+// credentialSelectors returns all credentials configured in the supplied spec.
+func credentialSelectors(spec *v1alpha1.VaultConfigSpec) []credentials {
+	var creds []credentials
+	if ca := spec.CABundle; ca != nil {
+		creds = append(creds, credentials{source: ca.Source, selectors: &ca.CommonCredentialSelectors})
+	}
+	if t := spec.Auth.Token; t != nil {
+		creds = append(creds, credentials{source: t.Source, selectors: &t.CommonCredentialSelectors})
+	}
+	if k := spec.Auth.Kubernetes; k != nil && k.ServiceAccountTokenSource != nil {
+		creds = append(creds, credentials{source: k.ServiceAccountTokenSource.Source, selectors: &k.ServiceAccountTokenSource.CommonCredentialSelectors})
+	}
+	return creds
+}
+
+// store returns the Vault store of the supplied config, reusing a cached one
+// if configured. The supplied generation of the cache must have been read
+// before the config, see beginStore.
+func (s *ESSVault) store(ctx context.Context, cfg *v1alpha1.VaultConfig, since uint64) (*vault.SecretStore, error) {
+	key := configKey(cfg)
+	if s.stores != nil {
+		if ss := s.stores.get(key); ss != nil {
+			return ss, nil
+		}
+	}
+	ss, err := NewStore(ctx, s.kube, s.configs, cfg, vault.WithPathLocker(s.locker), vault.WithServerSelector(s.servers), vault.WithReadCache(s.reads), vault.WithStoreLogger(s.logger))
+	if err != nil {
+		return nil, err
+	}
+	if s.stores != nil {
+		secrets := credentialSecrets(cfg.Spec)
+		mirror := mirrorKey(cfg)
+		if mirror != "" {
+			if mcfg, err := mirrorConfig(ctx, s.configs, cfg); err == nil {
+				secrets = append(secrets, credentialSecrets(mcfg.Spec)...)
+			}
+		}
+		s.stores.add(key, since, ss, secrets, mirror)
 	}
+	return ss, nil
+}
 
-	return sc, nil
+// beginStore returns the current generation of the store cache, if any, and a
+// function to call once the stores of configs read afterwards were built.
+func (s *ESSVault) beginStore() (uint64, func()) {
+	if s.stores == nil {
+		return 0, func() {}
+	}
+	return s.stores.begin()
 }
 
-func (s *ESSVault) GetSecret(ctx context.Context, in *ess.GetSecretRequest) (*ess.GetSecretResponse, error) {
+func (s *ESSVault) GetSecret(ctx context.Context, in *ess.GetSecretRequest) (resp *ess.GetSecretResponse, err error) {
 	s.logger.Debug("Getting secret", "name", in.Secret.ScopedName)
+	defer s.auditRPC(ctx, "GetSecret", in.Config, in.Secret, time.Now(), func() []string {
+		if resp == nil {
+			return nil
+		}
+		return sortedKeys(resp.Secret.Data)
+	}, &err)
 
 	secret := new(constore.Secret)
 	sn := new(constore.ScopedName)
 	sn.Name = in.Secret.ScopedName
 
-	cfg, err := getConfig(ctx, s.kube, in.Config)
+	since, done := s.beginStore()
+	defer done()
+	cfg, err := s.configs.GetConfig(ctx, in.Config)
 	if err != nil {
 		return nil, errors.Wrap(err, errGetConfig)
 	}
 
-	store, err := vault.NewVaultStore(ctx, s.kube, cfg)
+	release, err := s.limit(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	store, err := s.store(ctx, cfg, since)
 	if err != nil {
+		s.recordFailure(cfg, err, true)
 		return nil, errors.Wrap(err, errVaultStore)
 	}
 
 	err = store.ReadKeyValues(ctx, *sn, secret)
 	if err != nil {
+		s.recordFailure(cfg, err, false)
+		s.evictDenied(cfg, err)
 		return nil, errors.Wrap(err, "could not read key values")
 	}
 
@@ -125,14 +346,17 @@ func (s *ESSVault) GetSecret(ctx context.Context, in *ess.GetSecretRequest) (*es
 
 	essSecret.ScopedName = in.Secret.ScopedName
 
-	resp := new(ess.GetSecretResponse)
+	resp = new(ess.GetSecretResponse)
 	resp.Secret = essSecret
 
 	return resp, nil
 }
 
-func (s *ESSVault) ApplySecret(ctx context.Context, in *ess.ApplySecretRequest) (*ess.ApplySecretResponse, error) {
+func (s *ESSVault) ApplySecret(ctx context.Context, in *ess.ApplySecretRequest) (resp *ess.ApplySecretResponse, err error) {
 	s.logger.Debug("Applying secret", "name", in.Secret.ScopedName)
+	defer s.auditRPC(ctx, "ApplySecret", in.Config, in.Secret, time.Now(), func() []string {
+		return sortedKeys(in.Secret.GetData())
+	}, &err)
 
 	secret := new(constore.Secret)
 	if in.Secret != nil && len(in.Secret.Data) != 0 {
@@ -152,42 +376,101 @@ func (s *ESSVault) ApplySecret(ctx context.Context, in *ess.ApplySecretRequest)
 
 	secret.ScopedName.Name = in.Secret.ScopedName
 
-	cfg, err := getConfig(ctx, s.kube, in.Config)
+	since, done := s.beginStore()
+	defer done()
+	cfg, err := s.configs.GetConfig(ctx, in.Config)
 	if err != nil {
 		return nil, errors.Wrap(err, errGetConfig)
 	}
 
-	store, err := vault.NewVaultStore(ctx, s.kube, cfg)
+	release, err := s.limit(ctx, cfg)
 	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	store, err := s.store(ctx, cfg, since)
+	if err != nil {
+		s.recordFailure(cfg, err, true)
 		return nil, errors.Wrap(err, errVaultStore)
 	}
 
 	isChanged, err := store.WriteKeyValues(ctx, secret)
 	if err != nil {
+		s.recordFailure(cfg, err, false)
+		s.evictDenied(cfg, err)
 		return nil, errors.Wrap(err, "failed to write key values")
 	}
 
-	resp := new(ess.ApplySecretResponse)
+	resp = new(ess.ApplySecretResponse)
 	resp.Changed = isChanged
 
 	return resp, nil
 }
 
-func (s *ESSVault) DeleteKeys(ctx context.Context, in *ess.DeleteKeysRequest) (*ess.DeleteKeysResponse, error) {
+func (s *ESSVault) DeleteKeys(ctx context.Context, in *ess.DeleteKeysRequest) (resp *ess.DeleteKeysResponse, err error) {
 	s.logger.Debug("Deleting keys from secret", "name", in.Secret.ScopedName)
+	// The whole secret is deleted, so there are no keys to record.
+	defer s.auditRPC(ctx, "DeleteKeys", in.Config, in.Secret, time.Now(), nil, &err)
 
-	cfg, err := getConfig(ctx, s.kube, in.Config)
+	since, done := s.beginStore()
+	defer done()
+	cfg, err := s.configs.GetConfig(ctx, in.Config)
 	if err != nil {
 		return nil, errors.Wrap(err, errGetConfig)
 	}
 
-	store, err := vault.NewVaultStore(ctx, s.kube, cfg)
+	release, err := s.limit(ctx, cfg)
 	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	store, err := s.store(ctx, cfg, since)
+	if err != nil {
+		s.recordFailure(cfg, err, true)
 		return nil, errors.Wrap(err, errVaultStore)
 	}
 
 	secret := new(constore.Secret)
 	secret.ScopedName.Name = in.Secret.ScopedName
 
-	return &ess.DeleteKeysResponse{}, store.DeleteKeyValues(ctx, secret)
+	if err = store.DeleteKeyValues(ctx, secret); err != nil {
+		s.recordFailure(cfg, err, false)
+		s.evictDenied(cfg, err)
+		return nil, err
+	}
+	return &ess.DeleteKeysResponse{}, nil
+}
+
+// auditRPC records an RPC with the audit logger. The keys function, if any, is
+// called after the RPC returned, and err points to its error.
+func (s *ESSVault) auditRPC(ctx context.Context, op string, cfg *ess.ConfigReference, secret *ess.Secret, start time.Time, keys func() []string, err *error) {
+	e := audit.Entry{
+		Time:       start,
+		Peer:       audit.PeerIdentity(ctx),
+		Config:     cfg.GetName(),
+		ScopedName: secret.GetScopedName(),
+		Operation:  op,
+		Result:     audit.ResultSuccess,
+		Latency:    time.Since(start),
+	}
+	if keys != nil {
+		e.Keys = keys()
+	}
+	if *err != nil {
+		e.Result = audit.ResultFailure
+		e.Error = (*err).Error()
+	}
+	s.audit.Log(e)
+}
+
+// sortedKeys returns the keys of the supplied map in order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
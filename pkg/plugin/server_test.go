@@ -0,0 +1,247 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"testing"
+
+	v1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	ess "github.com/crossplane/crossplane-runtime/apis/proto/v1alpha1"
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/apis/config/v1alpha1"
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/audit"
+)
+
+type configGetterFn func(ctx context.Context, ref *ess.ConfigReference) (*v1alpha1.VaultConfig, error)
+
+func (fn configGetterFn) GetConfig(ctx context.Context, ref *ess.ConfigReference) (*v1alpha1.VaultConfig, error) {
+	return fn(ctx, ref)
+}
+
+type auditLoggerFn func(e audit.Entry)
+
+func (fn auditLoggerFn) Log(e audit.Entry) { fn(e) }
+
+func TestAudit(t *testing.T) {
+	errBoom := errors.New("boom")
+	var got []audit.Entry
+	s, _ := NewESSVault(nil, nil, nil,
+		WithConfigGetter(configGetterFn(func(_ context.Context, _ *ess.ConfigReference) (*v1alpha1.VaultConfig, error) {
+			return nil, errBoom
+		})),
+		WithAuditLogger(auditLoggerFn(func(e audit.Entry) { got = append(got, e) })),
+	)
+
+	cfg := &ess.ConfigReference{Name: "vault"}
+	_, _ = s.ApplySecret(context.Background(), &ess.ApplySecretRequest{Config: cfg, Secret: &ess.Secret{ScopedName: "ns/db", Data: map[string][]byte{"user": []byte("admin"), "password": []byte("s3cr3t")}}})
+	_, _ = s.DeleteKeys(context.Background(), &ess.DeleteKeysRequest{Config: cfg, Secret: &ess.Secret{ScopedName: "ns/db"}})
+
+	want := []audit.Entry{
+		{Config: "vault", ScopedName: "ns/db", Operation: "ApplySecret", Keys: []string{"password", "user"}, Result: audit.ResultFailure, Error: errors.Wrap(errBoom, errGetConfig).Error()},
+		{Config: "vault", ScopedName: "ns/db", Operation: "DeleteKeys", Result: audit.ResultFailure, Error: errors.Wrap(errBoom, errGetConfig).Error()},
+	}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreFields(audit.Entry{}, "Time", "Latency")); diff != "" {
+		t.Errorf("audit entries: -want, +got:\n%s", diff)
+	}
+}
+
+func TestNoSpec(t *testing.T) {
+	s, _ := NewESSVault(nil, nil, nil,
+		WithConfigGetter(configGetterFn(func(_ context.Context, _ *ess.ConfigReference) (*v1alpha1.VaultConfig, error) {
+			return &v1alpha1.VaultConfig{}, nil
+		})),
+	)
+
+	cfg := &ess.ConfigReference{Name: "vault"}
+	sec := &ess.Secret{ScopedName: "ns/db"}
+	if _, err := s.GetSecret(context.Background(), &ess.GetSecretRequest{Config: cfg, Secret: sec}); err == nil {
+		t.Errorf("s.GetSecret(...): want error for a config without a spec")
+	}
+	if _, err := s.ApplySecret(context.Background(), &ess.ApplySecretRequest{Config: cfg, Secret: sec}); err == nil {
+		t.Errorf("s.ApplySecret(...): want error for a config without a spec")
+	}
+	if _, err := s.DeleteKeys(context.Background(), &ess.DeleteKeysRequest{Config: cfg, Secret: sec}); err == nil {
+		t.Errorf("s.DeleteKeys(...): want error for a config without a spec")
+	}
+}
+
+func TestGetConfig(t *testing.T) {
+	errBoom := errors.New("boom")
+	secretRef := func(ns string) v1.CommonCredentialSelectors {
+		return v1.CommonCredentialSelectors{SecretRef: &v1.SecretKeySelector{SecretReference: v1.SecretReference{Namespace: ns, Name: "vault"}, Key: "token"}}
+	}
+	tokenAuth := func(source v1.CredentialsSource, ns string) v1alpha1.VaultAuthConfig {
+		return v1alpha1.VaultAuthConfig{Method: v1alpha1.VaultAuthToken, Token: &v1alpha1.VaultAuthTokenConfig{Source: source, CommonCredentialSelectors: secretRef(ns)}}
+	}
+	p := field.NewPath("spec")
+	invalid := func(errs ...*field.Error) error {
+		return errors.Wrap(field.ErrorList(errs).ToAggregate(), errNamespacedConfig)
+	}
+
+	type want struct {
+		cfg *v1alpha1.VaultConfig
+		err error
+	}
+	cases := map[string]struct {
+		reason     string
+		ref        *ess.ConfigReference
+		config     *v1alpha1.VaultConfig
+		namespaced *v1alpha1.VaultNamespacedConfig
+		want       want
+	}{
+		"Config": {
+			reason: "A name without a namespace should reference a VaultConfig.",
+			ref:    &ess.ConfigReference{Name: "vault"},
+			config: &v1alpha1.VaultConfig{ObjectMeta: metav1.ObjectMeta{Name: "vault"}, Spec: &v1alpha1.VaultConfigSpec{Auth: tokenAuth(v1.CredentialsSourceEnvironment, "")}},
+			want: want{
+				cfg: &v1alpha1.VaultConfig{ObjectMeta: metav1.ObjectMeta{Name: "vault"}, Spec: &v1alpha1.VaultConfigSpec{Auth: tokenAuth(v1.CredentialsSourceEnvironment, "")}},
+			},
+		},
+		"NamespacedKindWithoutNamespace": {
+			reason: "A reference to a VaultNamespacedConfig should require a namespace.",
+			ref:    &ess.ConfigReference{Kind: v1alpha1.VaultNamespacedConfigKind, Name: "vault"},
+			want: want{
+				err: errors.Errorf(errNoConfigNamespace, "vault"),
+			},
+		},
+		"Namespaced": {
+			reason: "A name of the form <namespace>/<name> should reference a VaultNamespacedConfig, with credentials defaulting to its namespace.",
+			ref:    &ess.ConfigReference{Name: "tenant/vault"},
+			namespaced: &v1alpha1.VaultNamespacedConfig{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "tenant", Name: "vault"},
+				Spec:       &v1alpha1.VaultConfigSpec{Auth: tokenAuth(v1.CredentialsSourceSecret, "")},
+			},
+			want: want{
+				cfg: &v1alpha1.VaultConfig{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "tenant", Name: "vault"},
+					Spec:       &v1alpha1.VaultConfigSpec{Auth: tokenAuth(v1.CredentialsSourceSecret, "tenant")},
+				},
+			},
+		},
+		"NamespacedEnvironment": {
+			reason: "A VaultNamespacedConfig should not source credentials from the environment of the plugin.",
+			ref:    &ess.ConfigReference{Name: "tenant/vault"},
+			namespaced: &v1alpha1.VaultNamespacedConfig{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "tenant", Name: "vault"},
+				Spec:       &v1alpha1.VaultConfigSpec{Auth: tokenAuth(v1.CredentialsSourceEnvironment, "")},
+			},
+			want: want{
+				err: invalid(field.NotSupported(p.Child("auth", "token", "source"), v1.CredentialsSourceEnvironment, []string{string(v1.CredentialsSourceSecret)})),
+			},
+		},
+		"NamespacedFilesystem": {
+			reason: "A VaultNamespacedConfig should not source credentials from the filesystem of the plugin.",
+			ref:    &ess.ConfigReference{Name: "tenant/vault"},
+			namespaced: &v1alpha1.VaultNamespacedConfig{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "tenant", Name: "vault"},
+				Spec: &v1alpha1.VaultConfigSpec{
+					CABundle: &v1alpha1.VaultCABundleConfig{Source: v1.CredentialsSourceFilesystem},
+					Auth:     tokenAuth(v1.CredentialsSourceSecret, "tenant"),
+				},
+			},
+			want: want{
+				err: invalid(field.NotSupported(p.Child("caBundle", "source"), v1.CredentialsSourceFilesystem, []string{string(v1.CredentialsSourceSecret)})),
+			},
+		},
+		"NamespacedOtherNamespace": {
+			reason: "A VaultNamespacedConfig should not source credentials from Secrets of other namespaces.",
+			ref:    &ess.ConfigReference{Name: "tenant/vault"},
+			namespaced: &v1alpha1.VaultNamespacedConfig{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "tenant", Name: "vault"},
+				Spec:       &v1alpha1.VaultConfigSpec{Auth: tokenAuth(v1.CredentialsSourceSecret, "crossplane-system")},
+			},
+			want: want{
+				err: invalid(field.Invalid(p.Child("auth", "token", "secretRef", "namespace"), "crossplane-system", "must be the namespace of the config")),
+			},
+		},
+		"NamespacedKubernetesWithoutTokenSource": {
+			reason: "A VaultNamespacedConfig should not login with the service account token of the plugin.",
+			ref:    &ess.ConfigReference{Name: "tenant/vault"},
+			namespaced: &v1alpha1.VaultNamespacedConfig{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "tenant", Name: "vault"},
+				Spec: &v1alpha1.VaultConfigSpec{Auth: v1alpha1.VaultAuthConfig{
+					Method:     v1alpha1.VaultAuthKubernetes,
+					Kubernetes: &v1alpha1.VaultAuthKubernetesConfig{Role: "tenant"},
+				}},
+			},
+			want: want{
+				err: invalid(field.Required(p.Child("auth", "kubernetes", "serviceAccountTokenSource"), "required for namespaced configs")),
+			},
+		},
+		"NamespacedAgent": {
+			reason: "A VaultNamespacedConfig should not use the Vault Agent of the plugin.",
+			ref:    &ess.ConfigReference{Name: "tenant/vault"},
+			namespaced: &v1alpha1.VaultNamespacedConfig{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "tenant", Name: "vault"},
+				Spec:       &v1alpha1.VaultConfigSpec{Auth: v1alpha1.VaultAuthConfig{Method: v1alpha1.VaultAuthAgent}},
+			},
+			want: want{
+				err: invalid(field.NotSupported(p.Child("auth", "method"), v1alpha1.VaultAuthAgent, []string{string(v1alpha1.VaultAuthToken), string(v1alpha1.VaultAuthKubernetes)})),
+			},
+		},
+		"NamespacedUnixSocket": {
+			reason: "A VaultNamespacedConfig should not connect to a unix socket of the plugin.",
+			ref:    &ess.ConfigReference{Name: "tenant/vault"},
+			namespaced: &v1alpha1.VaultNamespacedConfig{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "tenant", Name: "vault"},
+				Spec: &v1alpha1.VaultConfigSpec{
+					Server: "unix://agent.sock",
+					Auth:   tokenAuth(v1.CredentialsSourceSecret, "tenant"),
+				},
+			},
+			want: want{
+				err: invalid(field.Invalid(p.Child("server"), "unix://agent.sock", "must be an http or https URL for namespaced configs")),
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			kube := &test.MockClient{
+				MockGet: func(_ context.Context, key client.ObjectKey, obj client.Object) error {
+					switch o := obj.(type) {
+					case *v1alpha1.VaultConfig:
+						if tc.config == nil || key.Namespace != "" || key.Name != tc.config.GetName() {
+							return errBoom
+						}
+						tc.config.DeepCopyInto(o)
+					case *v1alpha1.VaultNamespacedConfig:
+						if tc.namespaced == nil || key.Namespace != tc.namespaced.GetNamespace() || key.Name != tc.namespaced.GetName() {
+							return errBoom
+						}
+						tc.namespaced.DeepCopyInto(o)
+					}
+					return nil
+				},
+			}
+			got, err := NewKubeConfigGetter(kube).GetConfig(context.Background(), tc.ref)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nGetConfig(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.cfg, got); diff != "" {
+				t.Errorf("\n%s\nGetConfig(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/apis/config/v1alpha1"
+)
+
+const (
+	errPatchStatus = "cannot patch config status"
+
+	// statusTimeout bounds reporting the status of a config.
+	statusTimeout = 10 * time.Second
+)
+
+// WithServerCheckInterval configures the interval at which the health of the
+// servers of configs with multiple servers is checked.
+func WithServerCheckInterval(d time.Duration) ESSVaultOption {
+	return func(e *ESSVault) {
+		e.serverCheckInterval = d
+	}
+}
+
+// MonitorServers checks the health of the servers of recently used configs
+// with multiple servers periodically, and reports changes of their state in
+// the status of the configs, until the supplied context is done.
+func (s *ESSVault) MonitorServers(ctx context.Context) {
+	s.servers.Run(ctx)
+}
+
+// reportServers reports the state of the servers of the supplied config, and
+// which of them is selected, in its status.
+func (s *ESSVault) reportServers(config string, st v1alpha1.VaultConfigStatus) {
+	s.logger.Debug("Servers changed", "config", config, "server", st.Server)
+	if s.kube == nil {
+		// Configs read from a file have no status.
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), statusTimeout)
+	defer cancel()
+	if err := patchStatus(ctx, s.kube, config, st); err != nil {
+		s.logger.Info("Cannot report servers", "config", config, "error", err)
+	}
+}
+
+// patchStatus replaces the status of the config with the supplied key, which
+// is of the form "<namespace>/<name>" for a VaultNamespacedConfig.
+func patchStatus(ctx context.Context, kube client.Client, config string, st v1alpha1.VaultConfigStatus) error {
+	var obj client.Object = &v1alpha1.VaultConfig{ObjectMeta: metav1.ObjectMeta{Name: config}}
+	if ns, name, ok := strings.Cut(config, "/"); ok {
+		obj = &v1alpha1.VaultNamespacedConfig{ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: name}}
+	}
+	b, err := json.Marshal(map[string]any{"status": st})
+	if err != nil {
+		return errors.Wrap(err, errPatchStatus)
+	}
+	return errors.Wrap(kube.Status().Patch(ctx, obj, client.RawPatch(types.MergePatchType, b)), errPatchStatus)
+}
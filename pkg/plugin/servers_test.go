@@ -0,0 +1,81 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/apis/config/v1alpha1"
+)
+
+func TestPatchStatus(t *testing.T) {
+	st := v1alpha1.VaultConfigStatus{
+		Server: "https://vault-b",
+		Servers: []v1alpha1.VaultServerStatus{
+			{Address: "https://vault-a", State: v1alpha1.VaultServerUnreachable},
+			{Address: "https://vault-b", State: v1alpha1.VaultServerActive},
+		},
+	}
+	patch := `{"status":{"server":"https://vault-b","servers":[{"address":"https://vault-a","state":"Unreachable","lastTransitionTime":null},{"address":"https://vault-b","state":"Active","lastTransitionTime":null}]}}`
+
+	cases := map[string]struct {
+		reason string
+		config string
+		want   client.Object
+	}{
+		"Cluster": {
+			reason: "Should patch the status of a VaultConfig.",
+			config: "vault",
+			want:   &v1alpha1.VaultConfig{ObjectMeta: metav1.ObjectMeta{Name: "vault"}},
+		},
+		"Namespaced": {
+			reason: "Should patch the status of a VaultNamespacedConfig.",
+			config: "tenant/vault",
+			want:   &v1alpha1.VaultNamespacedConfig{ObjectMeta: metav1.ObjectMeta{Namespace: "tenant", Name: "vault"}},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var got client.Object
+			kube := &test.MockClient{
+				MockStatusPatch: func(_ context.Context, obj client.Object, p client.Patch, _ ...client.SubResourcePatchOption) error {
+					got = obj
+					b, err := p.Data(obj)
+					if err != nil {
+						return err
+					}
+					if diff := cmp.Diff(patch, string(b)); diff != "" {
+						t.Errorf("\n%s\npatchStatus(...): -want patch, +got patch:\n%s", tc.reason, diff)
+					}
+					return nil
+				},
+			}
+			if err := patchStatus(context.Background(), kube, tc.config, st); err != nil {
+				t.Fatalf("\n%s\npatchStatus(...): unexpected error: %v", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("\n%s\npatchStatus(...): -want object, +got object:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
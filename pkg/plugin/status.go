@@ -0,0 +1,61 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/vault/kv"
+)
+
+// reasonCodes maps the reasons of Vault errors to gRPC status codes.
+var reasonCodes = map[kv.Reason]codes.Code{
+	kv.ReasonNotFound:         codes.NotFound,
+	kv.ReasonCASConflict:      codes.Aborted,
+	kv.ReasonPermissionDenied: codes.PermissionDenied,
+	kv.ReasonUnavailable:      codes.Unavailable,
+	kv.ReasonInvalidPath:      codes.InvalidArgument,
+}
+
+// StatusInterceptor is a gRPC unary server interceptor that returns the errors
+// of RPCs with the status code of their underlying Vault error, so that
+// clients can tell e.g. missing secrets from unavailable servers.
+func StatusInterceptor(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	resp, err := handler(ctx, req)
+	return resp, statusError(err)
+}
+
+// statusError returns the supplied error as a gRPC status error with the code
+// of its kv.Reason. Errors that cannot be categorized are returned unchanged,
+// which gRPC reports as Unknown.
+func statusError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	c, ok := reasonCodes[kv.ReasonOf(err)]
+	if !ok {
+		return err
+	}
+	return status.Error(c, err.Error())
+}
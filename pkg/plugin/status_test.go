@@ -0,0 +1,91 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package plugin
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/vault/api"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/vault/kv"
+)
+
+func TestStatusError(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		err    error
+		want   codes.Code
+	}{
+		"Nil": {
+			reason: "A nil error should be OK.",
+			want:   codes.OK,
+		},
+		"NotFound": {
+			reason: "A wrapped not found error should be NotFound.",
+			err:    errors.Wrap(errors.Wrap(kv.ErrNotFound, "cannot get secret"), "could not read key values"),
+			want:   codes.NotFound,
+		},
+		"CASConflict": {
+			reason: "A check-and-set conflict should be Aborted.",
+			err:    errors.Wrap(kv.ErrCASConflict, "failed to write key values"),
+			want:   codes.Aborted,
+		},
+		"LoginDenied": {
+			reason: "A denied login, which is not converted by the kv package, should be PermissionDenied.",
+			err:    errors.Wrap(&api.ResponseError{StatusCode: http.StatusForbidden}, errVaultStore),
+			want:   codes.PermissionDenied,
+		},
+		"Sealed": {
+			reason: "A sealed server should be Unavailable.",
+			err:    errors.Wrap(kv.ErrUnavailable, "could not read key values"),
+			want:   codes.Unavailable,
+		},
+		"InvalidPath": {
+			reason: "An invalid path should be InvalidArgument.",
+			err:    kv.ErrInvalidPath,
+			want:   codes.InvalidArgument,
+		},
+		"Status": {
+			reason: "Status errors should be returned unchanged.",
+			err:    status.Error(codes.ResourceExhausted, "boom"),
+			want:   codes.ResourceExhausted,
+		},
+		"Unknown": {
+			reason: "Other errors should be Unknown.",
+			err:    errors.New("boom"),
+			want:   codes.Unknown,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := statusError(tc.err)
+			if diff := cmp.Diff(tc.want, status.Code(err)); diff != "" {
+				t.Errorf("\n%s\nstatusError(...): -want code, +got:\n%s", tc.reason, diff)
+			}
+			if _, ok := status.FromError(tc.err); !ok {
+				if diff := cmp.Diff(tc.err.Error(), status.Convert(err).Message()); diff != "" {
+					t.Errorf("\n%s\nstatusError(...): -want message, +got:\n%s", tc.reason, diff)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+// Package unwrap provides helpers for consumers of connection secrets that the
+// plugin returns as Vault response-wrapped tokens.
+package unwrap
+
+import (
+	"context"
+
+	"github.com/hashicorp/vault/api"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/vault/kv"
+)
+
+// Error strings.
+const (
+	errNoToken   = "no wrapping token found under key %q"
+	errUnwrap    = "cannot unwrap token"
+	errNoSecret  = "wrapped response contains no secret"
+	errParseData = "cannot parse unwrapped secret"
+)
+
+// Secret is an unwrapped connection secret.
+type Secret struct {
+	// Data of the secret.
+	Data map[string][]byte
+	// Metadata of the secret, i.e. its labels.
+	Metadata map[string]string
+}
+
+// Token unwraps the supplied response-wrapping token with the supplied Vault
+// client and returns the wrapped connection secret. A token can only be
+// unwrapped once, subsequent calls will fail.
+func Token(ctx context.Context, c *api.Client, token string) (*Secret, error) {
+	s, err := c.Logical().UnwrapWithContext(ctx, token)
+	if err != nil {
+		return nil, errors.Wrap(err, errUnwrap)
+	}
+	if s == nil {
+		return nil, errors.New(errNoSecret)
+	}
+	kvs, err := kv.SecretFromResponse(s)
+	if err != nil {
+		return nil, errors.Wrap(err, errParseData)
+	}
+
+	// The plugin keeps its own state in these labels, and does not return
+	// them as labels of secrets it reads unwrapped either.
+	delete(kvs.CustomMeta, kv.DeletedAtLabel)
+	delete(kvs.CustomMeta, kv.TransitKeyVersionLabel)
+
+	out := &Secret{
+		Data:     make(map[string][]byte, len(kvs.Data)),
+		Metadata: kvs.CustomMeta,
+	}
+	for k, v := range kvs.Data {
+		out.Data[k] = []byte(v)
+	}
+	return out, nil
+}
+
+// Data unwraps the response-wrapping token stored under the supplied key of
+// the supplied connection secret data, as returned by the plugin.
+func Data(ctx context.Context, c *api.Client, data map[string][]byte, key string) (*Secret, error) {
+	t, ok := data[key]
+	if !ok || len(t) == 0 {
+		return nil, errors.Errorf(errNoToken, key)
+	}
+	return Token(ctx, c, string(t))
+}
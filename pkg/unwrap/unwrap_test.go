@@ -0,0 +1,113 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package unwrap
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/vault/api"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/vault/kv"
+)
+
+func TestData(t *testing.T) {
+	// The server unwraps the token "s.wrapped" once, into a KV v2 secret
+	// carrying the labels the plugin keeps its own state in.
+	unwrapped := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/sys/wrapping/unwrap" || r.Header.Get("X-Vault-Token") != "s.wrapped" || unwrapped {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"errors": ["wrapping token is not valid or does not exist"]}`))
+			return
+		}
+		unwrapped = true
+		_, _ = w.Write([]byte(`{"data": {
+			"data": {"password": "s3cr3t"},
+			"metadata": {"custom_metadata": {
+				"owner": "jdoe",
+				"` + kv.DeletedAtLabel + `": "2023-01-01T00:00:00Z",
+				"` + kv.TransitKeyVersionLabel + `": "1"
+			}}
+		}}`))
+	}))
+	defer srv.Close()
+
+	type want struct {
+		err error
+		out *Secret
+	}
+	cases := map[string]struct {
+		reason string
+		data   map[string][]byte
+		want
+	}{
+		"NoToken": {
+			reason: "Should return an error if there is no token under the key.",
+			data:   map[string][]byte{"password": []byte("s3cr3t")},
+			want: want{
+				err: errors.Errorf(errNoToken, "wrappingToken"),
+			},
+		},
+		"Unwrapped": {
+			reason: "Should return the data and labels of the wrapped secret, without the labels internal to the plugin.",
+			data:   map[string][]byte{"wrappingToken": []byte("s.wrapped")},
+			want: want{
+				out: &Secret{
+					Data:     map[string][]byte{"password": []byte("s3cr3t")},
+					Metadata: map[string]string{"owner": "jdoe"},
+				},
+			},
+		},
+		"AlreadyUnwrapped": {
+			reason: "Should return an error if the token was already unwrapped.",
+			data:   map[string][]byte{"wrappingToken": []byte("s.wrapped")},
+			want: want{
+				err: errors.Wrap(&api.ResponseError{
+					HTTPMethod: http.MethodPut,
+					URL:        srv.URL + "/v1/sys/wrapping/unwrap",
+					StatusCode: http.StatusBadRequest,
+					Errors:     []string{"wrapping token is not valid or does not exist"},
+				}, errUnwrap),
+			},
+		},
+	}
+	// The cases depend on each other, since a token can be unwrapped only once.
+	for _, name := range []string{"NoToken", "Unwrapped", "AlreadyUnwrapped"} {
+		tc := cases[name]
+		t.Run(name, func(t *testing.T) {
+			c, err := api.NewClient(&api.Config{Address: srv.URL})
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.ClearToken()
+			got, err := Data(context.Background(), c, tc.data, "wrappingToken")
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nData(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.out, got); diff != "" {
+				t.Errorf("\n%s\nData(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,303 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package kv
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"github.com/crossplane/crossplane-runtime/pkg/resource"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/apis/config/v1alpha1"
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/vault/kv"
+)
+
+const (
+	errReadKeyFile     = "cannot read key file"
+	errKeyLength       = "key must be %d base64 encoded bytes, not %d"
+	errNewCipher       = "cannot create cipher"
+	errEncodeArchive   = "cannot encode archive"
+	errDecodeArchive   = "cannot decode archive"
+	errWriteArchive    = "cannot write archive"
+	errReadArchive     = "cannot read archive"
+	errNotAnArchive    = "not an archive of this plugin"
+	errDecryptArchive  = "cannot decrypt archive, the key is wrong or the archive was modified"
+	errArchiveChecksum = "checksum of archived secret %q does not match"
+	errArchiveCount    = "archive holds %d secrets, but its header records %d"
+	errGetExported     = "cannot get secret %q"
+	errApplyImported   = "cannot apply secret %q"
+	errVerifyImported  = "imported secret %q does not match the archived secret"
+	errGetImported     = "cannot get imported secret %q"
+)
+
+const (
+	// archiveKeyLength is the length of archive keys, for AES-256.
+	archiveKeyLength = 32
+	// archiveFormatHeader starts every archive, unencrypted but authenticated.
+	archiveFormatHeader = "ess-plugin-vault-archive-v1\n"
+)
+
+// An Archive is a snapshot of the secrets of a store.
+type Archive struct {
+	// Config is the name of the config the secrets were exported from.
+	Config string `json:"config"`
+	// MountPath is the mount path the secrets were exported from.
+	MountPath string `json:"mountPath"`
+	// KVVersion is the KV version of the mount the secrets were exported
+	// from.
+	KVVersion v1alpha1.VaultKVVersion `json:"kvVersion"`
+	// CreatedAt is the time the archive was created.
+	CreatedAt time.Time `json:"createdAt"`
+	// Count is the number of secrets in the archive.
+	Count int `json:"count"`
+	// Secrets are the archived secrets.
+	Secrets []ArchivedSecret `json:"secrets"`
+}
+
+// An ArchivedSecret is a secret of an Archive.
+type ArchivedSecret struct {
+	// Path of the secret, relative to the mount path.
+	Path string `json:"path"`
+	// Data of the secret, as stored.
+	Data map[string]string `json:"data,omitempty"`
+	// CustomMetadata of the secret.
+	CustomMetadata map[string]string `json:"customMetadata,omitempty"`
+	// Checksum is the hex encoded SHA-256 of the path, data and custom
+	// metadata of the secret.
+	Checksum string `json:"checksum"`
+}
+
+func (s ArchivedSecret) checksum() string {
+	// Maps are encoded with sorted keys, so the encoding is stable.
+	b, _ := json.Marshal(ArchivedSecret{Path: s.Path, Data: s.Data, CustomMetadata: s.CustomMetadata})
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// An ImportResult reports the secrets of an import.
+type ImportResult struct {
+	// Written are the paths of the secrets that were written.
+	Written []string
+	// Unchanged are the paths of the secrets that already held the archived
+	// data and custom metadata.
+	Unchanged []string
+}
+
+// Verify returns an error if the archive is incomplete or any archived secret
+// does not match its checksum.
+func (a *Archive) Verify() error {
+	if len(a.Secrets) != a.Count {
+		return errors.Errorf(errArchiveCount, len(a.Secrets), a.Count)
+	}
+	for _, s := range a.Secrets {
+		if s.checksum() != s.Checksum {
+			return errors.Errorf(errArchiveChecksum, s.Path)
+		}
+	}
+	return nil
+}
+
+// Export returns an archive of all secrets under the supplied prefix, which is
+// relative to the mount path. Secrets are archived as stored, so values
+// encrypted with Vault Transit stay encrypted.
+func (ss *SecretStore) Export(_ context.Context, prefix string) (*Archive, error) {
+	paths, err := ss.walk(prefix)
+	if err != nil {
+		return nil, err
+	}
+	a := &Archive{Config: ss.config, MountPath: ss.mountPath, KVVersion: ss.version, CreatedAt: time.Now().UTC()}
+	for _, p := range paths {
+		s := &kv.Secret{}
+		err := ss.client.Get(p, s)
+		if kv.IsNotFound(err) {
+			// Deleted since it was listed.
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, errGetExported, p)
+		}
+		as := ArchivedSecret{Path: p, Data: s.Data, CustomMetadata: s.CustomMeta}
+		as.Checksum = as.checksum()
+		a.Secrets = append(a.Secrets, as)
+	}
+	a.Count = len(a.Secrets)
+	return a, nil
+}
+
+// Import writes all secrets of the supplied archive to the same paths of the
+// store, and verifies every write. The archive is verified before anything is
+// written. Archived keys are merged into existing secrets, whose other keys are
+// kept, while their custom metadata is replaced. The result reports the
+// secrets imported so far if an import fails.
+func (ss *SecretStore) Import(ctx context.Context, a *Archive) (*ImportResult, error) {
+	if err := a.Verify(); err != nil {
+		return nil, err
+	}
+	res := &ImportResult{}
+	for _, as := range a.Secrets {
+		written, err := ss.importSecret(ctx, as)
+		if err != nil {
+			return res, err
+		}
+		if written {
+			res.Written = append(res.Written, as.Path)
+			continue
+		}
+		res.Unchanged = append(res.Unchanged, as.Path)
+	}
+	return res, nil
+}
+
+// importSecret writes the supplied secret unless the store already holds it,
+// and returns whether it was written.
+func (ss *SecretStore) importSecret(ctx context.Context, as ArchivedSecret) (bool, error) {
+	unlock, err := ss.lockPath(ctx, as.Path)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	defer ss.invalidate(as.Path)
+
+	imported := func(s *kv.Secret) bool {
+		return containsMap(s.Data, as.Data) && equalMaps(as.CustomMetadata, s.CustomMeta)
+	}
+	written := true
+	err = ss.client.Apply(as.Path, kv.NewSecret(as.Data, as.CustomMetadata), kv.AllowUpdateIf(func(current, _ *kv.Secret) bool {
+		return !imported(current)
+	}))
+	if resource.IsNotAllowed(err) {
+		// The update was not allowed because it was a no-op.
+		written, err = false, nil
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, errApplyImported, as.Path)
+	}
+	got := &kv.Secret{}
+	if err := ss.client.Get(as.Path, got); err != nil {
+		return false, errors.Wrapf(err, errGetImported, as.Path)
+	}
+	if !imported(got) {
+		return false, errors.Errorf(errVerifyImported, as.Path)
+	}
+	return written, nil
+}
+
+// containsMap returns true if a holds all key value pairs of b.
+func containsMap(a, b map[string]string) bool {
+	for k, v := range b {
+		if av, ok := a[k]; !ok || av != v {
+			return false
+		}
+	}
+	return true
+}
+
+// ReadKeyFile reads an archive key from the supplied file, which holds 32 base64
+// encoded random bytes, e.g. generated with "head -c 32 /dev/urandom | base64".
+func ReadKeyFile(path string) ([]byte, error) {
+	b, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, errors.Wrap(err, errReadKeyFile)
+	}
+	key, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(b)))
+	if err != nil {
+		return nil, errors.Wrap(err, errReadKeyFile)
+	}
+	if len(key) != archiveKeyLength {
+		return nil, errors.Errorf(errKeyLength, archiveKeyLength, len(key))
+	}
+	return key, nil
+}
+
+// WriteArchive writes the supplied archive, gzipped and encrypted with
+// AES-256-GCM using the supplied key, to the supplied writer.
+func WriteArchive(w io.Writer, a *Archive, key []byte) error {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	buf := &bytes.Buffer{}
+	zw := gzip.NewWriter(buf)
+	if err := json.NewEncoder(zw).Encode(a); err != nil {
+		return errors.Wrap(err, errEncodeArchive)
+	}
+	if err := zw.Close(); err != nil {
+		return errors.Wrap(err, errEncodeArchive)
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return errors.Wrap(err, errEncodeArchive)
+	}
+	out := append([]byte(archiveFormatHeader), nonce...)
+	out = gcm.Seal(out, nonce, buf.Bytes(), []byte(archiveFormatHeader))
+	_, err = w.Write(out)
+	return errors.Wrap(err, errWriteArchive)
+}
+
+// ReadArchive reads and verifies an archive written by WriteArchive with the
+// supplied key.
+func ReadArchive(r io.Reader, key []byte) (*Archive, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, errReadArchive)
+	}
+	if !bytes.HasPrefix(b, []byte(archiveFormatHeader)) || len(b) < len(archiveFormatHeader)+gcm.NonceSize() {
+		return nil, errors.New(errNotAnArchive)
+	}
+	b = b[len(archiveFormatHeader):]
+	plain, err := gcm.Open(nil, b[:gcm.NonceSize()], b[gcm.NonceSize():], []byte(archiveFormatHeader))
+	if err != nil {
+		return nil, errors.New(errDecryptArchive)
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(plain))
+	if err != nil {
+		return nil, errors.Wrap(err, errDecodeArchive)
+	}
+	a := &Archive{}
+	if err := json.NewDecoder(zr).Decode(a); err != nil {
+		return nil, errors.Wrap(err, errDecodeArchive)
+	}
+	return a, a.Verify()
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	b, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, errNewCipher)
+	}
+	gcm, err := cipher.NewGCM(b)
+	return gcm, errors.Wrap(err, errNewCipher)
+}
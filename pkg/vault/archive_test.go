@@ -0,0 +1,232 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package kv
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/vault/kv"
+)
+
+func TestArchive(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, archiveKeyLength)
+	src := map[string]*kv.Secret{
+		"ns/db":     kv.NewSecret(map[string]string{"password": "s3cr3t"}, map[string]string{"owner": "db"}),
+		"ns/a/b/c":  kv.NewSecret(map[string]string{"token": "t0k3n"}, nil),
+		"other/one": kv.NewSecret(map[string]string{"key": "value"}, nil),
+	}
+	a, err := (&SecretStore{client: memKV(src), config: "source", mountPath: "secret/"}).Export(context.Background(), "ns")
+	if err != nil {
+		t.Fatalf("Export(...): %v", err)
+	}
+	if diff := cmp.Diff(2, a.Count); diff != "" {
+		t.Errorf("Export(...): -want count, +got count:\n%s", diff)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := WriteArchive(buf, a, key); err != nil {
+		t.Fatalf("WriteArchive(...): %v", err)
+	}
+	archive := buf.Bytes()
+
+	if _, err := ReadArchive(bytes.NewReader(archive), bytes.Repeat([]byte{2}, archiveKeyLength)); err == nil {
+		t.Errorf("ReadArchive(...): want error with the wrong key")
+	}
+	tampered := append([]byte{}, archive...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := ReadArchive(bytes.NewReader(tampered), key); err == nil {
+		t.Errorf("ReadArchive(...): want error for a modified archive")
+	}
+
+	got, err := ReadArchive(bytes.NewReader(archive), key)
+	if err != nil {
+		t.Fatalf("ReadArchive(...): %v", err)
+	}
+	if diff := cmp.Diff(a, got); diff != "" {
+		t.Errorf("ReadArchive(...): -want, +got:\n%s", diff)
+	}
+
+	dst := map[string]*kv.Secret{}
+	res, err := (&SecretStore{client: memKV(dst)}).Import(context.Background(), got)
+	if err != nil {
+		t.Fatalf("Import(...): %v", err)
+	}
+	if diff := cmp.Diff(&ImportResult{Written: []string{"ns/a/b/c", "ns/db"}}, res); diff != "" {
+		t.Errorf("Import(...): -want imported, +got imported:\n%s", diff)
+	}
+	for _, p := range []string{"ns/db", "ns/a/b/c"} {
+		if d, ok := dst[p]; !ok || !equalMaps(src[p].Data, d.Data) || !equalMaps(src[p].CustomMeta, d.CustomMeta) {
+			t.Errorf("Import(...): secret %q was not restored", p)
+		}
+	}
+}
+
+func TestArchiveVerify(t *testing.T) {
+	s := ArchivedSecret{Path: "ns/db", Data: map[string]string{"password": "s3cr3t"}}
+	s.Checksum = s.checksum()
+	modified := s
+	modified.Data = map[string]string{"password": "other"}
+
+	cases := map[string]struct {
+		reason string
+		a      *Archive
+		want   error
+	}{
+		"Valid": {
+			reason: "Should accept a complete archive with matching checksums.",
+			a:      &Archive{Count: 1, Secrets: []ArchivedSecret{s}},
+		},
+		"Incomplete": {
+			reason: "Should reject an archive with missing secrets.",
+			a:      &Archive{Count: 2, Secrets: []ArchivedSecret{s}},
+			want:   errors.Errorf(errArchiveCount, 1, 2),
+		},
+		"Modified": {
+			reason: "Should reject an archive with a modified secret.",
+			a:      &Archive{Count: 1, Secrets: []ArchivedSecret{modified}},
+			want:   errors.Errorf(errArchiveChecksum, "ns/db"),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := tc.a.Verify()
+			if diff := cmp.Diff(tc.want, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\na.Verify(): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestReadKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid")
+	short := filepath.Join(dir, "short")
+	if err := os.WriteFile(valid, []byte(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, archiveKeyLength))+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(short, []byte(base64.StdEncoding.EncodeToString([]byte("short"))), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadKeyFile(valid); err != nil {
+		t.Errorf("ReadKeyFile(...): %v", err)
+	}
+	want := errors.Errorf(errKeyLength, archiveKeyLength, 5)
+	if _, err := ReadKeyFile(short); cmp.Diff(want, err, test.EquateErrors()) != "" {
+		t.Errorf("ReadKeyFile(...): want %v, got %v", want, err)
+	}
+}
+
+func TestImport(t *testing.T) {
+	archived := func(path string, data, meta map[string]string) ArchivedSecret {
+		as := ArchivedSecret{Path: path, Data: data, CustomMetadata: meta}
+		as.Checksum = as.checksum()
+		return as
+	}
+	a := &Archive{Count: 2, Secrets: []ArchivedSecret{
+		archived("ns/db", map[string]string{"password": "s3cr3t"}, map[string]string{"owner": "db"}),
+		archived("ns/cache", map[string]string{"token": "t0k3n"}, nil),
+	}}
+	type want struct {
+		res     *ImportResult
+		secrets map[string]*kv.Secret
+		err     error
+	}
+	cases := map[string]struct {
+		reason  string
+		secrets map[string]*kv.Secret
+		client  func(s map[string]*kv.Secret) KVClient
+		want    want
+	}{
+		"ExtraKeys": {
+			reason: "Should merge the archived keys into existing secrets, keeping their other keys.",
+			secrets: map[string]*kv.Secret{
+				"ns/db": kv.NewSecret(map[string]string{"password": "changed", "username": "admin"}, map[string]string{"owner": "other"}),
+			},
+			want: want{
+				res: &ImportResult{Written: []string{"ns/db", "ns/cache"}},
+				secrets: map[string]*kv.Secret{
+					"ns/db":    kv.NewSecret(map[string]string{"password": "s3cr3t", "username": "admin"}, map[string]string{"owner": "db"}),
+					"ns/cache": kv.NewSecret(map[string]string{"token": "t0k3n"}, nil),
+				},
+			},
+		},
+		"Unchanged": {
+			reason: "Should not write secrets that already hold the archived keys and custom metadata.",
+			secrets: map[string]*kv.Secret{
+				"ns/db": kv.NewSecret(map[string]string{"password": "s3cr3t", "username": "admin"}, map[string]string{"owner": "db"}),
+			},
+			want: want{
+				res: &ImportResult{Written: []string{"ns/cache"}, Unchanged: []string{"ns/db"}},
+				secrets: map[string]*kv.Secret{
+					"ns/db":    kv.NewSecret(map[string]string{"password": "s3cr3t", "username": "admin"}, map[string]string{"owner": "db"}),
+					"ns/cache": kv.NewSecret(map[string]string{"token": "t0k3n"}, nil),
+				},
+			},
+		},
+		"ApplyFailed": {
+			reason:  "Should report the secrets written before an import failed.",
+			secrets: map[string]*kv.Secret{},
+			client: func(s map[string]*kv.Secret) KVClient {
+				c := memKV(s)
+				apply := c.ApplyFn
+				c.ApplyFn = func(path string, secret *kv.Secret, ao ...kv.ApplyOption) error {
+					if path == "ns/cache" {
+						return errBoom
+					}
+					return apply(path, secret, ao...)
+				}
+				return c
+			},
+			want: want{
+				res: &ImportResult{Written: []string{"ns/db"}},
+				secrets: map[string]*kv.Secret{
+					"ns/db": kv.NewSecret(map[string]string{"password": "s3cr3t"}, map[string]string{"owner": "db"}),
+				},
+				err: errors.Wrapf(errBoom, errApplyImported, "ns/cache"),
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var c KVClient = memKV(tc.secrets)
+			if tc.client != nil {
+				c = tc.client(tc.secrets)
+			}
+			res, err := (&SecretStore{client: c}).Import(context.Background(), a)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nss.Import(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.res, res); diff != "" {
+				t.Errorf("\n%s\nss.Import(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.secrets, tc.secrets, cmpopts.IgnoreUnexported(kv.Secret{})); diff != "" {
+				t.Errorf("\n%s\nss.Import(...): -want secrets, +got secrets:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
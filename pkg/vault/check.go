@@ -0,0 +1,119 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package kv
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/apis/config/v1alpha1"
+)
+
+const (
+	errLookupToken = "cannot look up token"
+	errLookupMount = "cannot look up mount"
+	errNoMount     = "mount %q does not exist or is not accessible"
+
+	// mountsPath is the endpoint Vault clients, including the Vault CLI, use
+	// to look up the mount of a path. Unlike sys/mounts, it is accessible to
+	// any token with a capability on the path.
+	mountsPath = "sys/internal/ui/mounts/"
+)
+
+// A ConfigStatus describes what a SecretStore sees of its Vault server.
+type ConfigStatus struct {
+	// Server is the address of the Vault server.
+	Server string `json:"server"`
+	// Servers are the states of the servers of a config with multiple
+	// servers, as of their last health check.
+	Servers []v1alpha1.VaultServerStatus `json:"servers,omitempty"`
+
+	// DisplayName is the display name of the token.
+	DisplayName string `json:"displayName,omitempty"`
+	// Policies are the policies attached to the token.
+	Policies []string `json:"policies,omitempty"`
+	// TTL is the remaining TTL of the token, or zero if it does not expire.
+	TTL time.Duration `json:"ttl"`
+
+	// MountPath is the path of the KV secrets engine.
+	MountPath string `json:"mountPath"`
+	// MountType is the type of the secrets engine mounted at MountPath.
+	MountType string `json:"mountType"`
+	// Version is the KV version of the mount.
+	Version v1alpha1.VaultKVVersion `json:"version"`
+	// ConfiguredVersion is the KV version the store uses.
+	ConfiguredVersion v1alpha1.VaultKVVersion `json:"configuredVersion"`
+}
+
+// Err returns an error if the store cannot use the mount as configured.
+func (s *ConfigStatus) Err() error {
+	if s.MountType != "kv" && s.MountType != "generic" {
+		return errors.Errorf("mount %q is a %s secrets engine, not kv", s.MountPath, s.MountType)
+	}
+	if s.Version != s.ConfiguredVersion {
+		return errors.Errorf("mount %q is kv %s, but the config uses %s", s.MountPath, s.Version, s.ConfiguredVersion)
+	}
+	return nil
+}
+
+// Check looks up the token of the store and the mount it is configured to
+// use, and returns their status.
+func (ss *SecretStore) Check(ctx context.Context) (*ConfigStatus, error) {
+	st := &ConfigStatus{
+		Server:            ss.vault.Address(),
+		MountPath:         ss.mountPath,
+		ConfiguredVersion: ss.version,
+	}
+	if ss.servers != nil {
+		ss.servers.refresh(ctx)
+		s := ss.servers.status()
+		st.Server, st.Servers = s.Server, s.Servers
+	}
+
+	t, err := ss.vault.Auth().Token().LookupSelfWithContext(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, errLookupToken)
+	}
+	if st.Policies, err = t.TokenPolicies(); err != nil {
+		return nil, errors.Wrap(err, errLookupToken)
+	}
+	if st.TTL, err = t.TokenTTL(); err != nil {
+		return nil, errors.Wrap(err, errLookupToken)
+	}
+	if n, ok := t.Data["display_name"].(string); ok {
+		st.DisplayName = n
+	}
+
+	m, err := ss.vault.Logical().ReadWithContext(ctx, mountsPath+strings.Trim(ss.mountPath, "/"))
+	if err != nil {
+		return nil, errors.Wrap(err, errLookupMount)
+	}
+	if m == nil || m.Data == nil {
+		return nil, errors.Errorf(errNoMount, ss.mountPath)
+	}
+	st.MountType, _ = m.Data["type"].(string)
+	// A kv mount without a version option is a v1 mount.
+	st.Version = v1alpha1.VaultKVVersionV1
+	if o, ok := m.Data["options"].(map[string]any); ok && fmt.Sprint(o["version"]) == "2" {
+		st.Version = v1alpha1.VaultKVVersionV2
+	}
+	return st, nil
+}
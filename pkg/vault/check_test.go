@@ -0,0 +1,114 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package kv
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/vault/api"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/apis/config/v1alpha1"
+)
+
+func TestCheck(t *testing.T) {
+	type want struct {
+		status *ConfigStatus
+		err    bool
+	}
+	cases := map[string]struct {
+		reason  string
+		mount   string
+		version v1alpha1.VaultKVVersion
+		want    want
+	}{
+		"KVv2": {
+			reason:  "Should report the token and a kv v2 mount.",
+			mount:   `{"data": {"type": "kv", "options": {"version": "2"}}}`,
+			version: v1alpha1.VaultKVVersionV2,
+			want: want{status: &ConfigStatus{
+				DisplayName:       "token-crossplane",
+				Policies:          []string{"crossplane", "default"},
+				TTL:               time.Hour,
+				MountPath:         "secret/",
+				MountType:         "kv",
+				Version:           v1alpha1.VaultKVVersionV2,
+				ConfiguredVersion: v1alpha1.VaultKVVersionV2,
+			}},
+		},
+		"KVv1": {
+			reason:  "Should report a kv mount without a version option as v1.",
+			mount:   `{"data": {"type": "kv", "options": null}}`,
+			version: v1alpha1.VaultKVVersionV2,
+			want: want{status: &ConfigStatus{
+				DisplayName:       "token-crossplane",
+				Policies:          []string{"crossplane", "default"},
+				TTL:               time.Hour,
+				MountPath:         "secret/",
+				MountType:         "kv",
+				Version:           v1alpha1.VaultKVVersionV1,
+				ConfiguredVersion: v1alpha1.VaultKVVersionV2,
+			}},
+		},
+		"NoMount": {
+			reason: "Should return an error if the mount cannot be looked up.",
+			want:   want{err: true},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/v1/auth/token/lookup-self":
+					_, _ = w.Write([]byte(`{"data": {"display_name": "token-crossplane", "policies": ["crossplane", "default"], "ttl": 3600}}`))
+				case "/v1/" + mountsPath + "secret":
+					if tc.mount == "" {
+						w.WriteHeader(http.StatusNotFound)
+						return
+					}
+					_, _ = w.Write([]byte(tc.mount))
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer srv.Close()
+
+			cfg := api.DefaultConfig()
+			cfg.Address = srv.URL
+			c, err := api.NewClient(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ss := &SecretStore{vault: c, mountPath: "secret/", version: tc.version}
+
+			got, err := ss.Check(context.Background())
+			if (err != nil) != tc.want.err {
+				t.Errorf("\n%s\nss.Check(...): want error %t, got %v", tc.reason, tc.want.err, err)
+			}
+			if tc.want.status != nil {
+				tc.want.status.Server = srv.URL
+			}
+			if diff := cmp.Diff(tc.want.status, got); diff != "" {
+				t.Errorf("\n%s\nss.Check(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
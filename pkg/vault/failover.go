@@ -0,0 +1,535 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package kv
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/apis/config/v1alpha1"
+)
+
+const (
+	errParseServer = "cannot parse server %q"
+	errReadBody    = "cannot read request body"
+
+	// defaultServerCheckInterval is the interval at which the health of
+	// servers is checked if not configured otherwise.
+	defaultServerCheckInterval = 30 * time.Second
+	// serverCheckTimeout bounds the health check of a single server.
+	serverCheckTimeout = 5 * time.Second
+	// serverIdleIntervals is the number of check intervals after which the
+	// servers of a config that is no longer used are forgotten.
+	serverIdleIntervals = 10
+
+	// healthPath is the unauthenticated health endpoint of Vault servers.
+	// https://developer.hashicorp.com/vault/api-docs/system/health
+	healthPath = "/v1/sys/health"
+)
+
+// A ServerSelector selects one of the servers of configs with multiple servers
+// based on their health. It should be shared between all SecretStores of a
+// replica, so that the health of servers is tracked per config rather than per
+// store.
+type ServerSelector struct {
+	interval time.Duration
+	report   func(config string, st v1alpha1.VaultConfigStatus)
+
+	mu    sync.Mutex
+	pools map[string]*serverPool
+
+	// pending holds the latest unreported status of each config. Reports are
+	// delivered by Run, so that requests never wait for them.
+	pendingMu sync.Mutex
+	pending   map[string]v1alpha1.VaultConfigStatus
+	queued    chan struct{}
+}
+
+// A ServerSelectorOption configures a ServerSelector.
+type ServerSelectorOption func(*ServerSelector)
+
+// WithServerCheckInterval configures the interval at which the health of
+// servers is checked.
+func WithServerCheckInterval(d time.Duration) ServerSelectorOption {
+	return func(s *ServerSelector) {
+		s.interval = d
+	}
+}
+
+// WithServerStatusReporter configures the ServerSelector to call the supplied
+// function with the status of a config whenever the state of one of its
+// servers, or the selected server, changes. The function is called by Run, so
+// statuses are only reported while it runs. Only the latest status of a config
+// is reported if it changes again before the previous one was reported.
+func WithServerStatusReporter(fn func(config string, st v1alpha1.VaultConfigStatus)) ServerSelectorOption {
+	return func(s *ServerSelector) {
+		s.report = fn
+	}
+}
+
+// NewServerSelector returns a new ServerSelector.
+func NewServerSelector(opts ...ServerSelectorOption) *ServerSelector {
+	s := &ServerSelector{
+		interval: defaultServerCheckInterval,
+		pools:    map[string]*serverPool{},
+		pending:  map[string]v1alpha1.VaultConfigStatus{},
+		queued:   make(chan struct{}, 1),
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// WithServerSelector configures the SecretStore to select one of the servers
+// of its config with the supplied ServerSelector.
+func WithServerSelector(s *ServerSelector) StoreOption {
+	return func(ss *SecretStore) {
+		ss.selector = s
+	}
+}
+
+// Run checks the health of the servers of all recently used configs at the
+// configured interval, and reports their status, until the supplied context is
+// done. Otherwise, the health is only checked by the first request after the
+// interval elapsed.
+func (s *ServerSelector) Run(ctx context.Context) {
+	t := time.NewTicker(s.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.queued:
+			s.flush()
+		case <-t.C:
+			for _, p := range s.recent(time.Now()) {
+				p.check(ctx)
+			}
+		}
+	}
+}
+
+// enqueue records the status of the supplied config to be reported by Run.
+func (s *ServerSelector) enqueue(config string, st v1alpha1.VaultConfigStatus) {
+	if s.report == nil {
+		return
+	}
+	s.pendingMu.Lock()
+	s.pending[config] = st
+	s.pendingMu.Unlock()
+	select {
+	case s.queued <- struct{}{}:
+	default:
+		// Run has yet to flush an earlier report, and will flush this one too.
+	}
+}
+
+// flush reports the pending statuses.
+func (s *ServerSelector) flush() {
+	s.pendingMu.Lock()
+	pending := s.pending
+	s.pending = map[string]v1alpha1.VaultConfigStatus{}
+	s.pendingMu.Unlock()
+	for config, st := range pending {
+		s.report(config, st)
+	}
+}
+
+// recent returns the server pools of configs used within the last few check
+// intervals, and forgets the others.
+func (s *ServerSelector) recent(now time.Time) []*serverPool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ps := make([]*serverPool, 0, len(s.pools))
+	for config, p := range s.pools {
+		if now.Sub(p.lastUsed()) > serverIdleIntervals*s.interval {
+			delete(s.pools, config)
+			forgetServers(config)
+			continue
+		}
+		ps = append(ps, p)
+	}
+	return ps
+}
+
+// pool returns the server pool of the supplied config, which is replaced if
+// its servers changed. Servers are checked with the supplied transport.
+func (s *ServerSelector) pool(config string, servers []string, rt http.RoundTripper) (*serverPool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p, ok := s.pools[config]; ok && equalStrings(p.servers, servers) {
+		p.setTransport(rt)
+		return p, nil
+	}
+	p, err := newServerPool(config, servers, s.interval, s.enqueue)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := s.pools[config]; ok {
+		forgetServers(config)
+	}
+	p.setTransport(rt)
+	s.pools[config] = p
+	return p, nil
+}
+
+// A serverPool tracks the health of the servers of a config, and which of them
+// is selected.
+type serverPool struct {
+	config   string
+	servers  []string
+	urls     []*url.URL
+	interval time.Duration
+	report   func(config string, st v1alpha1.VaultConfigStatus)
+
+	// checking serializes health checks, and reporting serializes reports so
+	// that the last status queued for reporting is the latest one.
+	checking  sync.Mutex
+	reporting sync.Mutex
+
+	mu       sync.Mutex
+	probe    *http.Client
+	states   []v1alpha1.VaultServerStatus
+	selected int
+	checked  time.Time
+	used     time.Time
+}
+
+func newServerPool(config string, servers []string, interval time.Duration, report func(string, v1alpha1.VaultConfigStatus)) (*serverPool, error) {
+	p := &serverPool{
+		config:   config,
+		servers:  append([]string(nil), servers...),
+		urls:     make([]*url.URL, len(servers)),
+		interval: interval,
+		report:   report,
+		states:   make([]v1alpha1.VaultServerStatus, len(servers)),
+		used:     time.Now(),
+	}
+	for i, s := range servers {
+		u, err := url.Parse(s)
+		if err != nil || u.Host == "" {
+			return nil, errors.Errorf(errParseServer, s)
+		}
+		p.urls[i] = u
+		p.states[i].Address = s
+	}
+	return p, nil
+}
+
+func (p *serverPool) setTransport(rt http.RoundTripper) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.probe = &http.Client{Transport: rt, Timeout: serverCheckTimeout}
+}
+
+func (p *serverPool) lastUsed() time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.used
+}
+
+// server returns the selected server.
+func (p *serverPool) server() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.servers[p.selected]
+}
+
+// status returns the status of the servers.
+func (p *serverPool) status() v1alpha1.VaultConfigStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return v1alpha1.VaultConfigStatus{
+		Server:  p.servers[p.selected],
+		Servers: append([]v1alpha1.VaultServerStatus(nil), p.states...),
+	}
+}
+
+// refresh checks the health of the servers if it was not checked within the
+// check interval.
+func (p *serverPool) refresh(ctx context.Context) {
+	stale := func() bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.used = time.Now()
+		return p.used.Sub(p.checked) >= p.interval
+	}
+	if !stale() {
+		return
+	}
+	p.checking.Lock()
+	defer p.checking.Unlock()
+	// Another request may have checked while we were waiting.
+	if stale() {
+		p.checkServers(ctx)
+	}
+}
+
+// check checks the health of the servers.
+func (p *serverPool) check(ctx context.Context) {
+	p.checking.Lock()
+	defer p.checking.Unlock()
+	p.checkServers(ctx)
+}
+
+func (p *serverPool) checkServers(ctx context.Context) {
+	p.mu.Lock()
+	probe := p.probe
+	p.mu.Unlock()
+
+	states := make([]v1alpha1.VaultServerState, len(p.urls))
+	var wg sync.WaitGroup
+	for i := range p.urls {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			states[i] = checkServer(ctx, probe, p.urls[i])
+		}(i)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		// Canceled checks tell nothing about the servers.
+		return
+	}
+
+	p.mu.Lock()
+	now := time.Now()
+	p.checked = now
+	changed := false
+	for i, st := range states {
+		changed = p.setState(i, st, now) || changed
+	}
+	changed = p.selectServer() || changed
+	p.mu.Unlock()
+
+	p.publish(changed)
+}
+
+// order returns the indices of the servers in the order requests should try
+// them: the selected server, the other healthy servers by preference, and
+// finally the unhealthy ones.
+func (p *serverPool) order() []int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	order := []int{p.selected}
+	for _, st := range []v1alpha1.VaultServerState{v1alpha1.VaultServerActive, v1alpha1.VaultServerStandby} {
+		for i := range p.states {
+			if i != p.selected && p.states[i].State == st {
+				order = append(order, i)
+			}
+		}
+	}
+	for i := range p.states {
+		if i != p.selected && !healthy(p.states[i].State) {
+			order = append(order, i)
+		}
+	}
+	return order
+}
+
+// failed records that a request to the supplied server failed, because it is
+// in the supplied state, and selects another server if possible.
+func (p *serverPool) failed(i int, st v1alpha1.VaultServerState) {
+	p.mu.Lock()
+	changed := p.setState(i, st, time.Now())
+	changed = p.selectServer() || changed
+	p.mu.Unlock()
+	p.publish(changed)
+}
+
+// succeeded records that a request to the supplied server succeeded, and
+// selects it if the selected server is unhealthy.
+func (p *serverPool) succeeded(i int) {
+	p.mu.Lock()
+	changed := false
+	if i != p.selected && !healthy(p.states[p.selected].State) {
+		p.selected = i
+		serverFailovers.WithLabelValues(p.config).Inc()
+		changed = true
+	}
+	p.mu.Unlock()
+	p.publish(changed)
+}
+
+// setState records the state of a server, and returns whether it changed.
+// It must be called with the lock held.
+func (p *serverPool) setState(i int, st v1alpha1.VaultServerState, now time.Time) bool {
+	if p.states[i].State == st {
+		return false
+	}
+	p.states[i].State = st
+	p.states[i].LastTransitionTime = metav1.NewTime(now)
+	return true
+}
+
+// selectServer selects the first active server, or else the first standby,
+// and returns whether the selection changed. If no server is healthy, the
+// selection is kept. It must be called with the lock held.
+func (p *serverPool) selectServer() bool {
+	best := -1
+	for i := range p.states {
+		if !healthy(p.states[i].State) {
+			continue
+		}
+		if best < 0 || p.states[i].State == v1alpha1.VaultServerActive && p.states[best].State != v1alpha1.VaultServerActive {
+			best = i
+		}
+	}
+	if best < 0 || best == p.selected {
+		return false
+	}
+	p.selected = best
+	serverFailovers.WithLabelValues(p.config).Inc()
+	return true
+}
+
+// publish updates the metrics of the servers and, if their state or the
+// selected server changed, queues the status of the config for reporting.
+func (p *serverPool) publish(changed bool) {
+	if !changed {
+		return
+	}
+	p.reporting.Lock()
+	defer p.reporting.Unlock()
+
+	st := p.status()
+	for _, s := range st.Servers {
+		serverUp.WithLabelValues(p.config, s.Address).Set(boolValue(healthy(s.State)))
+		serverSelected.WithLabelValues(p.config, s.Address).Set(boolValue(s.Address == st.Server))
+	}
+	if p.report != nil {
+		p.report(p.config, st)
+	}
+}
+
+// checkServer returns the state of the server at the supplied url.
+func checkServer(ctx context.Context, c *http.Client, u *url.URL) v1alpha1.VaultServerState {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(u.String(), "/")+healthPath, nil)
+	if err != nil {
+		return v1alpha1.VaultServerUnreachable
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return v1alpha1.VaultServerUnreachable
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return v1alpha1.VaultServerActive
+	case http.StatusTooManyRequests, 473:
+		// 429 is returned by standbys, and 473 by performance standbys.
+		return v1alpha1.VaultServerStandby
+	case http.StatusServiceUnavailable:
+		return v1alpha1.VaultServerSealed
+	default:
+		return v1alpha1.VaultServerUnavailable
+	}
+}
+
+func healthy(st v1alpha1.VaultServerState) bool {
+	return st == v1alpha1.VaultServerActive || st == v1alpha1.VaultServerStandby
+}
+
+// failoverTransport sends requests to the selected server of a pool, and fails
+// over to the next server if it is unreachable or sealed.
+type failoverTransport struct {
+	pool *serverPool
+	base http.RoundTripper
+}
+
+func (t *failoverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	t.pool.refresh(ctx)
+
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		b, err := io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, errReadBody)
+		}
+		body = b
+	}
+
+	order := t.pool.order()
+	var resp *http.Response
+	var err error
+	for n, i := range order {
+		r := req.Clone(ctx)
+		r.URL.Scheme, r.URL.Host, r.Host = t.pool.urls[i].Scheme, t.pool.urls[i].Host, ""
+		if body != nil {
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		resp, err = t.base.RoundTrip(r)
+		if ctx.Err() != nil {
+			return resp, err
+		}
+		switch {
+		case err != nil:
+			t.pool.failed(i, v1alpha1.VaultServerUnreachable)
+		case resp.StatusCode == http.StatusServiceUnavailable:
+			t.pool.failed(i, v1alpha1.VaultServerSealed)
+		default:
+			t.pool.succeeded(i)
+			return resp, nil
+		}
+		if resp != nil && n < len(order)-1 {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+	}
+	return resp, err
+}
+
+func forgetServers(config string) {
+	l := prometheus.Labels{"config": config}
+	serverUp.DeletePartialMatch(l)
+	serverSelected.DeletePartialMatch(l)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,178 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package kv
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/apis/config/v1alpha1"
+)
+
+// vaultServer returns a server whose health endpoint responds with the
+// supplied status, and whose other endpoints respond with the supplied status
+// and echo the request body.
+func vaultServer(health, status int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == healthPath {
+			w.WriteHeader(health)
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		w.WriteHeader(status)
+		_, _ = w.Write(b)
+	}))
+}
+
+func TestServerSelection(t *testing.T) {
+	sealed := vaultServer(http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	defer sealed.Close()
+	standby := vaultServer(http.StatusTooManyRequests, http.StatusOK)
+	defer standby.Close()
+	active := vaultServer(http.StatusOK, http.StatusOK)
+	defer active.Close()
+
+	var reported []v1alpha1.VaultConfigStatus
+	s := NewServerSelector(WithServerStatusReporter(func(config string, st v1alpha1.VaultConfigStatus) {
+		if config != "vault" {
+			t.Errorf("report(...): unexpected config %q", config)
+		}
+		reported = append(reported, st)
+	}))
+
+	servers := []string{sealed.URL, standby.URL, active.URL}
+	p, err := s.pool("vault", servers, http.DefaultTransport)
+	if err != nil {
+		t.Fatalf("s.pool(...): unexpected error: %v", err)
+	}
+	p.refresh(context.Background())
+	if len(reported) != 0 {
+		t.Errorf("p.refresh(...): want status reported by Run rather than the check, got %d reports", len(reported))
+	}
+	s.flush()
+
+	want := v1alpha1.VaultConfigStatus{
+		Server: active.URL,
+		Servers: []v1alpha1.VaultServerStatus{
+			{Address: sealed.URL, State: v1alpha1.VaultServerSealed},
+			{Address: standby.URL, State: v1alpha1.VaultServerStandby},
+			{Address: active.URL, State: v1alpha1.VaultServerActive},
+		},
+	}
+	if diff := cmp.Diff([]v1alpha1.VaultConfigStatus{want}, reported, cmpopts.IgnoreTypes(metav1.Time{})); diff != "" {
+		t.Errorf("p.refresh(...): -want reported, +got reported:\n%s", diff)
+	}
+	if diff := cmp.Diff([]int{2, 1, 0}, p.order()); diff != "" {
+		t.Errorf("p.order(): -want, +got:\n%s", diff)
+	}
+
+	// Checks within the interval are skipped, and unchanged states are not
+	// reported again.
+	p.refresh(context.Background())
+	p.check(context.Background())
+	s.flush()
+	if len(reported) != 1 {
+		t.Errorf("p.check(...): want no report of unchanged states, got %d reports", len(reported))
+	}
+
+	if q, _ := s.pool("vault", servers, http.DefaultTransport); q != p {
+		t.Errorf("s.pool(...): want pool reused for unchanged servers")
+	}
+	if q, _ := s.pool("vault", servers[1:], http.DefaultTransport); q == p {
+		t.Errorf("s.pool(...): want new pool for changed servers")
+	}
+}
+
+func TestFailoverTransport(t *testing.T) {
+	primary := vaultServer(http.StatusOK, http.StatusOK)
+	secondary := vaultServer(http.StatusTooManyRequests, http.StatusOK)
+	defer secondary.Close()
+
+	var reported []v1alpha1.VaultConfigStatus
+	s := NewServerSelector(WithServerStatusReporter(func(_ string, st v1alpha1.VaultConfigStatus) {
+		reported = append(reported, st)
+	}))
+	p, err := s.pool("vault", []string{primary.URL, secondary.URL}, http.DefaultTransport)
+	if err != nil {
+		t.Fatalf("s.pool(...): unexpected error: %v", err)
+	}
+	p.refresh(context.Background())
+	if p.server() != primary.URL {
+		t.Fatalf("p.server(): want %q, got %q", primary.URL, p.server())
+	}
+
+	// The primary becomes unreachable after the health check.
+	primary.Close()
+
+	c := &http.Client{Transport: &failoverTransport{pool: p, base: http.DefaultTransport}}
+	resp, err := c.Post(primary.URL+"/v1/secret/data/foo", "application/json", strings.NewReader(`{"data":{}}`))
+	if err != nil {
+		t.Fatalf("c.Post(...): unexpected error: %v", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // Test.
+	b, _ := io.ReadAll(resp.Body)
+	if diff := cmp.Diff(`{"data":{}}`, string(b)); diff != "" {
+		t.Errorf("c.Post(...): want body sent to the secondary, -want, +got:\n%s", diff)
+	}
+	s.flush()
+
+	want := v1alpha1.VaultConfigStatus{
+		Server: secondary.URL,
+		Servers: []v1alpha1.VaultServerStatus{
+			{Address: primary.URL, State: v1alpha1.VaultServerUnreachable},
+			{Address: secondary.URL, State: v1alpha1.VaultServerStandby},
+		},
+	}
+	if len(reported) == 0 {
+		t.Fatalf("c.Post(...): want failover reported")
+	}
+	if diff := cmp.Diff(want, reported[len(reported)-1], cmpopts.IgnoreTypes(metav1.Time{})); diff != "" {
+		t.Errorf("c.Post(...): -want reported, +got reported:\n%s", diff)
+	}
+}
+
+func TestServerSelectorRunReports(t *testing.T) {
+	reported := make(chan string)
+	s := NewServerSelector(WithServerStatusReporter(func(config string, _ v1alpha1.VaultConfigStatus) {
+		reported <- config
+	}))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	// Queueing does not wait for the report.
+	s.enqueue("vault", v1alpha1.VaultConfigStatus{})
+	s.enqueue("vault", v1alpha1.VaultConfigStatus{})
+
+	select {
+	case config := <-reported:
+		if config != "vault" {
+			t.Errorf("s.Run(...): want config %q reported, got %q", "vault", config)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("s.Run(...): want queued status reported")
+	}
+}
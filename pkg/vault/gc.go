@@ -0,0 +1,231 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package kv
+
+import (
+	"context"
+	"path/filepath"
+
+	v1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/crossplane/crossplane-runtime/pkg/connection/store"
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/vault/kv"
+)
+
+const (
+	errListOwners    = "cannot list owners"
+	errGetOwned      = "cannot get secret %q"
+	errDeleteOrphan  = "cannot delete orphaned secret %q"
+	errUnknownPolicy = "unknown garbage collection policy %q"
+)
+
+// A GCPolicy determines what happens to orphaned secrets.
+type GCPolicy string
+
+// Garbage collection policies.
+const (
+	// GCPolicyReport only reports orphaned secrets.
+	GCPolicyReport GCPolicy = "Report"
+	// GCPolicyDelete deletes orphaned secrets, according to the deletion
+	// policy of the config.
+	GCPolicyDelete GCPolicy = "Delete"
+)
+
+// An OwnerLister lists the objects that may own connection secrets.
+type OwnerLister interface {
+	// OwnerUIDs returns the UIDs of all objects that may own connection
+	// secrets. It must return an error rather than an incomplete set, since
+	// secrets of missing owners are considered orphaned.
+	OwnerUIDs(ctx context.Context) (map[string]bool, error)
+}
+
+// An Orphan is a secret whose owner no longer exists.
+type Orphan struct {
+	// Path of the secret, qualified with its mount.
+	Path string
+	// OwnerUID is the UID of the owner of the secret.
+	OwnerUID string
+}
+
+// A GCResult reports the secrets of a garbage collection.
+type GCResult struct {
+	// Owned is the number of secrets that are owned by an object.
+	Owned int
+	// Orphans are the owned secrets whose owner no longer exists.
+	Orphans []Orphan
+	// Deleted are the paths of the orphans that were deleted, qualified with
+	// their mount.
+	Deleted []string
+}
+
+// A Collector collects the secrets of a store whose owner no longer exists,
+// e.g. because it was deleted while the plugin was unreachable. Secrets are
+// owned if their custom metadata has the owner UID label Crossplane sets;
+// secrets without it are never collected.
+type Collector struct {
+	owners OwnerLister
+	policy GCPolicy
+	logger logging.Logger
+}
+
+// A CollectorOption configures a Collector.
+type CollectorOption func(*Collector)
+
+// WithGCPolicy configures what the Collector does with orphaned secrets. They
+// are only reported by default.
+func WithGCPolicy(p GCPolicy) CollectorOption {
+	return func(c *Collector) {
+		c.policy = p
+	}
+}
+
+// WithGCLogger configures the logger of the Collector.
+func WithGCLogger(l logging.Logger) CollectorOption {
+	return func(c *Collector) {
+		c.logger = l
+	}
+}
+
+// NewCollector returns a Collector that considers secrets orphaned whose owner
+// is not listed by the supplied OwnerLister.
+func NewCollector(owners OwnerLister, opts ...CollectorOption) *Collector {
+	c := &Collector{owners: owners, policy: GCPolicyReport, logger: logging.NewNopLogger()}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+// Collect collects the orphaned secrets under the supplied prefix, which is
+// relative to the mount paths. The mounts of all routes are collected.
+func (c *Collector) Collect(ctx context.Context, ss *SecretStore, prefix string) (*GCResult, error) {
+	if c.policy != GCPolicyReport && c.policy != GCPolicyDelete {
+		return nil, errors.Errorf(errUnknownPolicy, c.policy)
+	}
+	var owned []ownedSecret
+	for _, r := range ss.mountRoutes() {
+		paths, err := walkPaths(r.client, prefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range paths {
+			uid, err := ownerUID(r.client, p)
+			if err != nil {
+				return nil, err
+			}
+			if uid != "" {
+				owned = append(owned, ownedSecret{route: r, path: p, uid: uid})
+			}
+		}
+	}
+
+	// Owners are listed after the secrets, so that the owner of a secret that
+	// was written in the meantime is listed too, unless it was deleted.
+	uids, err := c.owners.OwnerUIDs(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, errListOwners)
+	}
+
+	res := &GCResult{Owned: len(owned)}
+	for _, o := range owned {
+		if uids[o.uid] {
+			continue
+		}
+		p := filepath.Join(o.route.mount, o.path)
+		res.Orphans = append(res.Orphans, Orphan{Path: p, OwnerUID: o.uid})
+		log := c.logger.WithValues("config", ss.config, "path", p, "owner-uid", o.uid)
+		if c.policy != GCPolicyDelete {
+			log.Info("Found orphaned secret")
+			continue
+		}
+		deleted, err := c.delete(ctx, ss, o, log)
+		if err != nil {
+			return res, errors.Wrapf(err, errDeleteOrphan, p)
+		}
+		if deleted {
+			log.Info("Deleted orphaned secret")
+			res.Deleted = append(res.Deleted, p)
+		}
+	}
+	gcOrphanedSecrets.WithLabelValues(ss.config).Set(float64(len(res.Orphans) - len(res.Deleted)))
+	gcDeletedSecrets.WithLabelValues(ss.config).Add(float64(len(res.Deleted)))
+	return res, nil
+}
+
+// An ownedSecret is a secret with an owner at a path of a route.
+type ownedSecret struct {
+	route *route
+	path  string
+	uid   string
+}
+
+// delete deletes the supplied secret from its route and the mirror, like
+// DeleteKeyValues, if it is still owned by the same owner, and returns whether
+// it was deleted.
+func (c *Collector) delete(ctx context.Context, ss *SecretStore, o ownedSecret, log logging.Logger) (bool, error) {
+	n, named := o.route.scopedName(o.path)
+	s := &store.Secret{ScopedName: n}
+	deleted, err := c.deleteOwned(ctx, ss, o, s, named)
+	if err != nil || !deleted {
+		return false, err
+	}
+	if !named {
+		if ss.mirror != nil {
+			log.Info("Cannot delete orphaned secret from mirror, since its name cannot be derived from the path template of its route")
+		}
+		return true, nil
+	}
+	return true, ss.mirrorDelete(ctx, s)
+}
+
+// deleteOwned deletes the supplied secret from its route if it is still owned
+// by the same owner, holding the lock of its name if it is known.
+func (c *Collector) deleteOwned(ctx context.Context, ss *SecretStore, o ownedSecret, s *store.Secret, named bool) (bool, error) {
+	key := o.path
+	if named {
+		key = ss.path(s.ScopedName)
+	}
+	unlock, err := ss.lockPath(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	defer ss.invalidate(key)
+
+	// The secret might have been adopted or recreated since it was listed.
+	current, err := ownerUID(o.route.client, o.path)
+	if err != nil || current != o.uid {
+		return false, err
+	}
+	return true, ss.deleteFrom(o.route, o.path, s)
+}
+
+// ownerUID returns the UID of the owner of the secret at the supplied path of
+// the supplied client, or an empty string if it has none or does not exist.
+func ownerUID(c KVClient, path string) (string, error) {
+	s := &kv.Secret{}
+	err := c.Get(path, s)
+	if kv.IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, errGetOwned, path)
+	}
+	return s.CustomMeta[v1.LabelKeyOwnerUID], nil
+}
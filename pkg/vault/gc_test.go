@@ -0,0 +1,165 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package kv
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	v1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/vault/kv"
+)
+
+var (
+	errBoom     = errors.New("boom")
+	sortStrings = cmpopts.SortSlices(func(a, b string) bool { return a < b })
+)
+
+type ownerListerFn func(ctx context.Context) (map[string]bool, error)
+
+func (fn ownerListerFn) OwnerUIDs(ctx context.Context) (map[string]bool, error) { return fn(ctx) }
+
+func TestCollect(t *testing.T) {
+	owned := func(uid string) map[string]string { return map[string]string{v1.LabelKeyOwnerUID: uid} }
+	secrets := func() map[string]*kv.Secret {
+		return map[string]*kv.Secret{
+			"ns/live":      kv.NewSecret(map[string]string{"k": "v"}, owned("live-uid")),
+			"ns/orphan":    kv.NewSecret(map[string]string{"k": "v"}, owned("gone-uid")),
+			"ns/unmanaged": kv.NewSecret(map[string]string{"k": "v"}, nil),
+		}
+	}
+	live := ownerListerFn(func(_ context.Context) (map[string]bool, error) {
+		return map[string]bool{"live-uid": true}, nil
+	})
+	type want struct {
+		res    *GCResult
+		remain []string
+		err    error
+	}
+	cases := map[string]struct {
+		reason string
+		owners OwnerLister
+		opts   []CollectorOption
+		want   want
+	}{
+		"Report": {
+			reason: "Should only report orphaned secrets by default.",
+			owners: live,
+			want: want{
+				res:    &GCResult{Owned: 2, Orphans: []Orphan{{Path: "ns/orphan", OwnerUID: "gone-uid"}}},
+				remain: []string{"ns/live", "ns/orphan", "ns/unmanaged"},
+			},
+		},
+		"Delete": {
+			reason: "Should delete orphaned secrets, but never unmanaged ones.",
+			owners: live,
+			opts:   []CollectorOption{WithGCPolicy(GCPolicyDelete)},
+			want: want{
+				res:    &GCResult{Owned: 2, Orphans: []Orphan{{Path: "ns/orphan", OwnerUID: "gone-uid"}}, Deleted: []string{"ns/orphan"}},
+				remain: []string{"ns/live", "ns/unmanaged"},
+			},
+		},
+		"ListOwnersFailed": {
+			reason: "Should not collect anything if owners cannot be listed.",
+			owners: ownerListerFn(func(_ context.Context) (map[string]bool, error) { return nil, errBoom }),
+			opts:   []CollectorOption{WithGCPolicy(GCPolicyDelete)},
+			want: want{
+				remain: []string{"ns/live", "ns/orphan", "ns/unmanaged"},
+				err:    errors.Wrap(errBoom, errListOwners),
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			s := secrets()
+			c := NewCollector(tc.owners, tc.opts...)
+			res, err := c.Collect(context.Background(), &SecretStore{client: memKV(s)}, "")
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nc.Collect(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.res, res); diff != "" {
+				t.Errorf("\n%s\nc.Collect(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			var remain []string
+			for p := range s {
+				remain = append(remain, p)
+			}
+			if diff := cmp.Diff(tc.want.remain, remain, sortStrings); diff != "" {
+				t.Errorf("\n%s\nc.Collect(...): -want remaining, +got remaining:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestCollectRoutes(t *testing.T) {
+	owned := func(uid string) map[string]string { return map[string]string{v1.LabelKeyOwnerUID: uid} }
+	primary := map[string]*kv.Secret{
+		"ns/orphan": kv.NewSecret(map[string]string{"k": "v"}, owned("gone-uid")),
+	}
+	tenant := map[string]*kv.Secret{
+		"team-a/orphan": kv.NewSecret(map[string]string{"k": "v"}, owned("gone-uid")),
+		"team-a/live":   kv.NewSecret(map[string]string{"k": "v"}, owned("live-uid")),
+	}
+	mirror := map[string]*kv.Secret{
+		"ns/orphan":     kv.NewSecret(map[string]string{"k": "v"}, owned("gone-uid")),
+		"team-a/orphan": kv.NewSecret(map[string]string{"k": "v"}, owned("gone-uid")),
+	}
+	ss := &SecretStore{
+		client: memKV(primary),
+		mount:  "secret",
+		routes: []route{{scope: "team-*", client: memKV(tenant), mount: "tenant"}},
+		mirror: &SecretStore{client: memKV(mirror), config: "mirror"},
+		logger: logging.NewNopLogger(),
+	}
+	live := ownerListerFn(func(_ context.Context) (map[string]bool, error) {
+		return map[string]bool{"live-uid": true}, nil
+	})
+
+	res, err := NewCollector(live, WithGCPolicy(GCPolicyDelete)).Collect(context.Background(), ss, "")
+	if err != nil {
+		t.Fatalf("c.Collect(...): %v", err)
+	}
+	want := &GCResult{
+		Owned: 3,
+		Orphans: []Orphan{
+			{Path: "secret/ns/orphan", OwnerUID: "gone-uid"},
+			{Path: "tenant/team-a/orphan", OwnerUID: "gone-uid"},
+		},
+		Deleted: []string{"secret/ns/orphan", "tenant/team-a/orphan"},
+	}
+	if diff := cmp.Diff(want, res); diff != "" {
+		t.Errorf("c.Collect(...): -want, +got:\n%s", diff)
+	}
+	remain := map[string][]string{}
+	for name, s := range map[string]map[string]*kv.Secret{"primary": primary, "tenant": tenant, "mirror": mirror} {
+		remain[name] = []string{}
+		for p := range s {
+			remain[name] = append(remain[name], p)
+		}
+	}
+	wantRemain := map[string][]string{"primary": {}, "tenant": {"team-a/live"}, "mirror": {}}
+	if diff := cmp.Diff(wantRemain, remain); diff != "" {
+		t.Errorf("c.Collect(...): want orphans deleted from their route and the mirror, -want remaining, +got remaining:\n%s", diff)
+	}
+}
@@ -0,0 +1,177 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package kv
+
+import (
+	"path"
+	"strings"
+
+	"github.com/crossplane/crossplane-runtime/pkg/connection/store"
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/apis/config/v1alpha1"
+)
+
+const (
+	errKeyPattern   = "invalid key pattern %q"
+	errKeyRenamed   = "keys %q and %q are renamed to the same name %q"
+	errKeyNotMapped = "key %q cannot be mapped to a name that maps back to it"
+)
+
+// A keyMapping maps the keys of connection secrets to the names they are
+// stored under in Vault, see v1alpha1.VaultKeyMapping. A nil keyMapping maps
+// keys to themselves.
+type keyMapping struct {
+	rename  map[string]string
+	renamed map[string]string
+	keyCase v1alpha1.VaultKeyCase
+	prefix  string
+	include []string
+	exclude []string
+}
+
+// newKeyMapping returns the keyMapping of the supplied configuration, or nil
+// if it is nil.
+func newKeyMapping(km *v1alpha1.VaultKeyMapping) (*keyMapping, error) {
+	if km == nil {
+		return nil, nil
+	}
+	for _, p := range append(append([]string{}, km.Include...), km.Exclude...) {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, errors.Wrapf(err, errKeyPattern, p)
+		}
+	}
+	m := &keyMapping{
+		rename:  km.Rename,
+		renamed: make(map[string]string, len(km.Rename)),
+		keyCase: km.Case,
+		prefix:  km.Prefix,
+		include: km.Include,
+		exclude: km.Exclude,
+	}
+	for k, n := range km.Rename {
+		if o, ok := m.renamed[n]; ok {
+			// Report the keys in a stable order.
+			if o > k {
+				o, k = k, o
+			}
+			return nil, errors.Errorf(errKeyRenamed, o, k, n)
+		}
+		m.renamed[n] = k
+	}
+	return m, nil
+}
+
+// stored returns true if the supplied key is stored in Vault.
+func (m *keyMapping) stored(key string) bool {
+	if len(m.include) > 0 && !matchAny(m.include, key) {
+		return false
+	}
+	return !matchAny(m.exclude, key)
+}
+
+// toVault returns the name the supplied key is stored under, or false if it
+// is not stored.
+func (m *keyMapping) toVault(key string) (string, bool) {
+	if m == nil {
+		return key, true
+	}
+	if !m.stored(key) {
+		return "", false
+	}
+	if n, ok := m.rename[key]; ok {
+		return n, true
+	}
+	switch m.keyCase {
+	case v1alpha1.VaultKeyCaseUpper:
+		key = strings.ToUpper(key)
+	case v1alpha1.VaultKeyCaseLower:
+		key = strings.ToLower(key)
+	}
+	return m.prefix + key, true
+}
+
+// fromVault returns the key stored under the supplied name, or false if the
+// name does not map back to a key, e.g. because it was written by another
+// client.
+func (m *keyMapping) fromVault(name string) (string, bool) {
+	if m == nil {
+		return name, true
+	}
+	key, ok := m.renamed[name]
+	if !ok {
+		if !strings.HasPrefix(name, m.prefix) {
+			return "", false
+		}
+		key = strings.TrimPrefix(name, m.prefix)
+		switch m.keyCase {
+		case v1alpha1.VaultKeyCaseUpper:
+			key = strings.ToLower(key)
+		case v1alpha1.VaultKeyCaseLower:
+			key = strings.ToUpper(key)
+		}
+	}
+	// Only names a key is actually stored under map back to it, which keeps
+	// the mapping one-to-one.
+	if n, ok := m.toVault(key); !ok || n != name {
+		return "", false
+	}
+	return key, true
+}
+
+func matchAny(patterns []string, key string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func keyValuesFromData(data map[string]string, m *keyMapping) store.KeyValues {
+	if len(data) == 0 {
+		return nil
+	}
+	kv := make(store.KeyValues, len(data))
+	for n, v := range data {
+		if k, ok := m.fromVault(n); ok {
+			kv[k] = []byte(v)
+		}
+	}
+	return kv
+}
+
+func dataFromKeyValues(kv store.KeyValues, m *keyMapping) (map[string]string, error) {
+	if len(kv) == 0 {
+		return nil, nil
+	}
+
+	data := make(map[string]string, len(kv))
+	for k, v := range kv {
+		n, ok := m.toVault(k)
+		if !ok {
+			continue
+		}
+		if bk, ok := m.fromVault(n); !ok || bk != k {
+			return nil, errors.Errorf(errKeyNotMapped, k)
+		}
+		// NOTE(turkenh): vault stores values as strings. So we convert []byte
+		// to string before writing to Vault.
+		data[n] = string(v)
+	}
+	return data, nil
+}
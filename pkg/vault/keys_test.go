@@ -0,0 +1,132 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package kv
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane/crossplane-runtime/pkg/connection/store"
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/apis/config/v1alpha1"
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/vault/kv"
+)
+
+func TestKeyMapping(t *testing.T) {
+	type want struct {
+		err   error
+		vault map[string]string
+		read  store.KeyValues
+	}
+	cases := map[string]struct {
+		reason  string
+		mapping *v1alpha1.VaultKeyMapping
+		stored  map[string]string
+		data    store.KeyValues
+		want    want
+	}{
+		"None": {
+			reason: "Keys should be stored as is without a mapping.",
+			data:   store.KeyValues{"password": []byte("s3cr3t")},
+			want: want{
+				vault: map[string]string{"password": "s3cr3t"},
+				read:  store.KeyValues{"password": []byte("s3cr3t")},
+			},
+		},
+		"PrefixAndCase": {
+			reason: "Keys should be converted and prefixed, and mapped back when read.",
+			mapping: &v1alpha1.VaultKeyMapping{
+				Rename: map[string]string{"endpoint": "DB_HOST"},
+				Case:   v1alpha1.VaultKeyCaseUpper,
+				Prefix: "DB_",
+			},
+			data: store.KeyValues{"password": []byte("s3cr3t"), "endpoint": []byte("db.acme.org")},
+			want: want{
+				vault: map[string]string{"DB_PASSWORD": "s3cr3t", "DB_HOST": "db.acme.org"},
+				read:  store.KeyValues{"password": []byte("s3cr3t"), "endpoint": []byte("db.acme.org")},
+			},
+		},
+		"Filter": {
+			reason: "Excluded keys should not be stored, and keys written by other clients should not be read.",
+			mapping: &v1alpha1.VaultKeyMapping{
+				Include: []string{"pass*", "user*", "attribute.*"},
+				Exclude: []string{"attribute.*"},
+			},
+			stored: map[string]string{"foreign": "value"},
+			data:   store.KeyValues{"password": []byte("s3cr3t"), "username": []byte("admin"), "attribute.id": []byte("42")},
+			want: want{
+				vault: map[string]string{"password": "s3cr3t", "username": "admin", "foreign": "value"},
+				read:  store.KeyValues{"password": []byte("s3cr3t"), "username": []byte("admin")},
+			},
+		},
+		"NotReversible": {
+			reason: "Keys whose mapped name does not map back to them should not be written.",
+			mapping: &v1alpha1.VaultKeyMapping{
+				Case: v1alpha1.VaultKeyCaseUpper,
+			},
+			data: store.KeyValues{"Password": []byte("s3cr3t")},
+			want: want{
+				err: errors.Wrap(errors.Errorf(errKeyNotMapped, "Password"), errApply),
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			m, err := newKeyMapping(tc.mapping)
+			if err != nil {
+				t.Fatal(err)
+			}
+			secrets := map[string]*kv.Secret{}
+			if tc.stored != nil {
+				secrets["ns/conn"] = kv.NewSecret(tc.stored, nil)
+			}
+			ss := &SecretStore{client: memKV(secrets), keys: m}
+			n := store.ScopedName{Scope: "ns", Name: "conn"}
+
+			_, err = ss.WriteKeyValues(context.Background(), &store.Secret{ScopedName: n, Data: tc.data})
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nss.WriteKeyValues(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tc.want.vault, secrets["ns/conn"].Data); diff != "" {
+				t.Errorf("\n%s\nss.WriteKeyValues(...): -want Vault data, +got:\n%s", tc.reason, diff)
+			}
+
+			got := &store.Secret{}
+			if err := ss.ReadKeyValues(context.Background(), n, got); err != nil {
+				t.Fatalf("\n%s\nss.ReadKeyValues(...): %v", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want.read, got.Data); diff != "" {
+				t.Errorf("\n%s\nss.ReadKeyValues(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestNewKeyMapping(t *testing.T) {
+	_, err := newKeyMapping(&v1alpha1.VaultKeyMapping{Rename: map[string]string{"password": "SECRET", "token": "SECRET"}})
+	want := errors.Errorf(errKeyRenamed, "password", "token", "SECRET")
+	if diff := cmp.Diff(want, err, test.EquateErrors()); diff != "" {
+		t.Errorf("newKeyMapping(...): -want error, +got error:\n%s", diff)
+	}
+}
@@ -0,0 +1,216 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package kv
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+)
+
+// A Reason categorizes an Error.
+type Reason string
+
+// Error reasons.
+const (
+	ReasonNotFound         Reason = "NotFound"
+	ReasonCASConflict      Reason = "CASConflict"
+	ReasonPermissionDenied Reason = "PermissionDenied"
+	ReasonUnavailable      Reason = "Unavailable"
+	ReasonInvalidPath      Reason = "InvalidPath"
+)
+
+// Errors that any Error of the same Reason matches with errors.Is, regardless
+// of its status code and request ID, e.g. errors.Is(err, kv.ErrNotFound).
+var (
+	ErrNotFound         = &Error{Reason: ReasonNotFound, err: errors.New("secret not found")}
+	ErrCASConflict      = &Error{Reason: ReasonCASConflict, err: errors.New(errCASMismatch)}
+	ErrPermissionDenied = &Error{Reason: ReasonPermissionDenied, err: errors.New("permission denied")}
+	ErrUnavailable      = &Error{Reason: ReasonUnavailable, err: errors.New("vault is unavailable")}
+	ErrInvalidPath      = &Error{Reason: ReasonInvalidPath, err: errors.New("invalid secret path")}
+)
+
+// An Error is an error of a Vault request, or of a request rejected by a
+// client before it was sent, categorized by its Reason.
+type Error struct {
+	Reason Reason
+
+	// StatusCode is the HTTP status code of the Vault response, if any.
+	StatusCode int
+
+	// RequestID is the ID of the Vault request, if the response carried one.
+	// Vault only returns request IDs in response bodies of secrets and
+	// warnings, not along with errors.
+	RequestID string
+
+	err error
+}
+
+// Error returns the message of the underlying error.
+func (e *Error) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the underlying error, e.g. an *api.ResponseError.
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// Is returns true if the supplied target is an *Error of the same Reason.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Reason == e.Reason
+}
+
+// ReasonOf returns the Reason of the supplied error, or an empty Reason if it
+// cannot be categorized. Errors returned by Vault that were not converted to
+// an *Error, e.g. by a login, are categorized by their status code.
+func ReasonOf(err error) Reason {
+	if err == nil {
+		return ""
+	}
+	e := &Error{}
+	if errors.As(err, &e) {
+		return e.Reason
+	}
+	re := &api.ResponseError{}
+	if errors.As(err, &re) {
+		return responseReason(re)
+	}
+	var ne net.Error
+	ue := &url.Error{}
+	if errors.As(err, &ne) || errors.As(err, &ue) {
+		return ReasonUnavailable
+	}
+	return ""
+}
+
+// responseReason categorizes the supplied error response of Vault.
+func responseReason(re *api.ResponseError) Reason {
+	switch {
+	case re.StatusCode == http.StatusBadRequest && hasError(re, errCASMismatch):
+		return ReasonCASConflict
+	case re.StatusCode == http.StatusUnauthorized || re.StatusCode == http.StatusForbidden:
+		return ReasonPermissionDenied
+	case re.StatusCode == http.StatusNotFound && (hasError(re, "unsupported path") || hasError(re, "no handler for route")):
+		return ReasonInvalidPath
+	case re.StatusCode == http.StatusNotFound:
+		return ReasonNotFound
+	case re.StatusCode == http.StatusMethodNotAllowed:
+		return ReasonInvalidPath
+	// Performance standbys return 412 until they caught up with the active
+	// node, and 429 is returned by standbys and rate limit quotas.
+	case re.StatusCode == http.StatusPreconditionFailed || re.StatusCode == http.StatusTooManyRequests || re.StatusCode >= http.StatusInternalServerError:
+		return ReasonUnavailable
+	}
+	return ""
+}
+
+func hasError(re *api.ResponseError, msg string) bool {
+	for _, e := range re.Errors {
+		if strings.Contains(e, msg) {
+			return true
+		}
+	}
+	return false
+}
+
+// newError returns the supplied error of a Vault request as an *Error if it
+// can be categorized, or unchanged otherwise.
+func newError(err error) error {
+	r := ReasonOf(err)
+	if r == "" {
+		return err
+	}
+	e := &Error{}
+	if errors.As(err, &e) {
+		return err
+	}
+	e = &Error{Reason: r, err: err}
+	re := &api.ResponseError{}
+	if errors.As(err, &re) {
+		e.StatusCode = re.StatusCode
+	}
+	return e
+}
+
+// notFound returns the error of a read whose response does not contain a
+// secret, see isMissing. The Vault client returns no response for 404
+// responses without data or warnings.
+func notFound(s *api.Secret) error {
+	if s == nil {
+		return &Error{Reason: ReasonNotFound, StatusCode: http.StatusNotFound, err: ErrNotFound.err}
+	}
+	// The Vault client returns 404 responses of reads if they contain
+	// warnings, e.g. when reading a path of a KV v2 mount that is neither a
+	// data nor metadata path.
+	return &Error{Reason: ReasonInvalidPath, StatusCode: http.StatusNotFound, RequestID: s.RequestID, err: errors.New(strings.Join(s.Warnings, "; "))}
+}
+
+// isMissing returns true if the supplied response of a read does not contain
+// a secret.
+func isMissing(s *api.Secret) bool {
+	return s == nil || (s.Data == nil && len(s.Warnings) > 0)
+}
+
+// validatePath returns an error if the supplied secret path is empty or would
+// escape the mount path once joined with it.
+func validatePath(path string) error {
+	p := filepath.Clean(path)
+	if path == "" || p == "." || p == ".." || strings.HasPrefix(p, "../") {
+		return &Error{Reason: ReasonInvalidPath, err: errors.Errorf("invalid secret path %q", path)}
+	}
+	return nil
+}
+
+// errorClient is a LogicalClient that returns the errors of Vault requests as
+// an *Error where they can be categorized.
+type errorClient struct {
+	LogicalClient
+}
+
+func (c errorClient) Read(path string) (*api.Secret, error) {
+	s, err := c.LogicalClient.Read(path)
+	return s, newError(err)
+}
+
+func (c errorClient) Write(path string, data map[string]any) (*api.Secret, error) {
+	s, err := c.LogicalClient.Write(path, data)
+	return s, newError(err)
+}
+
+func (c errorClient) Delete(path string) (*api.Secret, error) {
+	s, err := c.LogicalClient.Delete(path)
+	return s, newError(err)
+}
+
+func (c errorClient) List(path string) (*api.Secret, error) {
+	s, err := c.LogicalClient.List(path)
+	return s, newError(err)
+}
+
+func (c errorClient) JSONMergePatch(ctx context.Context, path string, data map[string]any) (*api.Secret, error) {
+	s, err := c.LogicalClient.JSONMergePatch(ctx, path, data)
+	return s, newError(err)
+}
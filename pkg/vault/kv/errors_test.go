@@ -0,0 +1,207 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package kv
+
+import (
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/vault/api"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/vault/kv/fake"
+)
+
+func TestReasonOf(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		err    error
+		want   Reason
+	}{
+		"Nil": {
+			reason: "A nil error has no reason.",
+		},
+		"Unknown": {
+			reason: "Errors other than Vault errors cannot be categorized.",
+			err:    errBoom,
+		},
+		"WrappedError": {
+			reason: "The reason of a wrapped Error should be returned.",
+			err:    errors.Wrap(errors.Wrap(ErrNotFound, errRead), errGet),
+			want:   ReasonNotFound,
+		},
+		"CASConflict": {
+			reason: "A bad request with a check-and-set mismatch is a CAS conflict.",
+			err:    &api.ResponseError{StatusCode: http.StatusBadRequest, Errors: []string{errCASMismatch}},
+			want:   ReasonCASConflict,
+		},
+		"BadRequest": {
+			reason: "Other bad requests cannot be categorized.",
+			err:    &api.ResponseError{StatusCode: http.StatusBadRequest, Errors: []string{"boom"}},
+		},
+		"PermissionDenied": {
+			reason: "A forbidden request is denied.",
+			err:    errors.Wrap(&api.ResponseError{StatusCode: http.StatusForbidden}, "login"),
+			want:   ReasonPermissionDenied,
+		},
+		"NotFound": {
+			reason: "A not found response is a not found error.",
+			err:    &api.ResponseError{StatusCode: http.StatusNotFound},
+			want:   ReasonNotFound,
+		},
+		"UnsupportedPath": {
+			reason: "A not found response of an unsupported path is an invalid path error.",
+			err:    &api.ResponseError{StatusCode: http.StatusNotFound, Errors: []string{"1 error occurred:\n\t* unsupported path\n\n"}},
+			want:   ReasonInvalidPath,
+		},
+		"Sealed": {
+			reason: "A sealed server is unavailable.",
+			err:    &api.ResponseError{StatusCode: http.StatusServiceUnavailable, Errors: []string{"Vault is sealed"}},
+			want:   ReasonUnavailable,
+		},
+		"Unreachable": {
+			reason: "An unreachable server is unavailable.",
+			err:    &net.OpError{Op: "dial", Err: errBoom},
+			want:   ReasonUnavailable,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, ReasonOf(tc.err)); diff != "" {
+				t.Errorf("\n%s\nReasonOf(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestErrorIs(t *testing.T) {
+	re := &api.ResponseError{StatusCode: http.StatusForbidden, Errors: []string{"permission denied"}}
+	err := errors.Wrap(errors.Wrap(newError(re), errRead), errGet)
+
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("errors.Is(err, ErrPermissionDenied): want true, got false")
+	}
+	if errors.Is(err, ErrNotFound) {
+		t.Errorf("errors.Is(err, ErrNotFound): want false, got true")
+	}
+	e := &Error{}
+	if !errors.As(err, &e) {
+		t.Fatalf("errors.As(err, *Error): want true, got false")
+	}
+	if diff := cmp.Diff(http.StatusForbidden, e.StatusCode); diff != "" {
+		t.Errorf("StatusCode: -want, +got:\n%s", diff)
+	}
+	got := &api.ResponseError{}
+	if !errors.As(err, &got) || got != re {
+		t.Errorf("errors.As(err, *api.ResponseError): want the Vault error")
+	}
+	if diff := cmp.Diff("cannot get secret: cannot read secret: "+re.Error(), err.Error()); diff != "" {
+		t.Errorf("Error(): -want, +got:\n%s", diff)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	type want struct {
+		err       error
+		status    int
+		requestID string
+	}
+	cases := map[string]struct {
+		reason string
+		client LogicalClient
+		path   string
+		want   want
+	}{
+		"EscapingPath": {
+			reason: "Paths escaping the mount path should be rejected before sending a request.",
+			path:   "foo/../../sys/policy",
+			want: want{
+				err: ErrInvalidPath,
+			},
+		},
+		"EmptyPath": {
+			reason: "Empty paths should be rejected before sending a request.",
+			want: want{
+				err: ErrInvalidPath,
+			},
+		},
+		"NotFound": {
+			reason: "A missing secret should be a not found error.",
+			client: &fake.LogicalClient{
+				ReadFn: func(_ string) (*api.Secret, error) {
+					return nil, nil
+				},
+			},
+			path: secretName,
+			want: want{
+				err:    ErrNotFound,
+				status: http.StatusNotFound,
+			},
+		},
+		"Warnings": {
+			reason: "A not found response with only warnings should be an invalid path error with its request ID.",
+			client: &fake.LogicalClient{
+				ReadFn: func(_ string) (*api.Secret, error) {
+					return &api.Secret{RequestID: "req-1", Warnings: []string{"Invalid path for a versioned K/V secrets engine."}}, nil
+				},
+			},
+			path: secretName,
+			want: want{
+				err:       ErrInvalidPath,
+				status:    http.StatusNotFound,
+				requestID: "req-1",
+			},
+		},
+		"Sealed": {
+			reason: "Errors of Vault should be categorized.",
+			client: &fake.LogicalClient{
+				ReadFn: func(_ string) (*api.Secret, error) {
+					return nil, &api.ResponseError{StatusCode: http.StatusServiceUnavailable, Errors: []string{"Vault is sealed"}}
+				},
+			},
+			path: secretName,
+			want: want{
+				err:    ErrUnavailable,
+				status: http.StatusServiceUnavailable,
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			for v, c := range map[string]interface{ Get(string, *Secret) error }{
+				"V1": NewV1Client(tc.client, mountPath),
+				"V2": NewV2Client(tc.client, mountPath),
+			} {
+				err := c.Get(tc.path, &Secret{})
+				if !errors.Is(err, tc.want.err) {
+					t.Fatalf("\n%s\n%s.Get(...): want errors.Is(err, %v), got %v", tc.reason, v, tc.want.err, err)
+				}
+				e := &Error{}
+				errors.As(err, &e)
+				if diff := cmp.Diff(tc.want.status, e.StatusCode); diff != "" {
+					t.Errorf("\n%s\n%s.Get(...): -want status code, +got:\n%s", tc.reason, v, diff)
+				}
+				if diff := cmp.Diff(tc.want.requestID, e.RequestID); diff != "" {
+					t.Errorf("\n%s\n%s.Get(...): -want request ID, +got:\n%s", tc.reason, v, diff)
+				}
+			}
+		})
+	}
+}
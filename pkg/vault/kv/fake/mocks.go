@@ -14,30 +14,45 @@
  limitations under the License.
 */
 
+// Package fake is a fake Vault LogicalClient.
 package fake
 
 import (
-	"github.com/crossplane/crossplane-runtime/pkg/connection/store/vault/kv"
+	"context"
+
+	"github.com/hashicorp/vault/api"
 )
 
-// KVClient is a fake KVClient.
-type KVClient struct {
-	GetFn    func(path string, secret *kv.Secret) error
-	ApplyFn  func(path string, secret *kv.Secret, ao ...kv.ApplyOption) error
-	DeleteFn func(path string) error
+// LogicalClient is a fake LogicalClient
+type LogicalClient struct {
+	ReadFn           func(path string) (*api.Secret, error)
+	WriteFn          func(path string, data map[string]any) (*api.Secret, error)
+	DeleteFn         func(path string) (*api.Secret, error)
+	ListFn           func(path string) (*api.Secret, error)
+	JSONMergePatchFn func(ctx context.Context, path string, data map[string]any) (*api.Secret, error)
+}
+
+// Read reads secret at the given path.
+func (l *LogicalClient) Read(path string) (*api.Secret, error) {
+	return l.ReadFn(path)
+}
+
+// Write writes data to the given path.
+func (l *LogicalClient) Write(path string, data map[string]any) (*api.Secret, error) {
+	return l.WriteFn(path, data)
 }
 
-// Get fetches a secret at a given path.
-func (k *KVClient) Get(path string, secret *kv.Secret) error {
-	return k.GetFn(path, secret)
+// Delete deletes secret at the given path.
+func (l *LogicalClient) Delete(path string) (*api.Secret, error) {
+	return l.DeleteFn(path)
 }
 
-// Apply creates or updates a secret at a given path.
-func (k *KVClient) Apply(path string, secret *kv.Secret, ao ...kv.ApplyOption) error {
-	return k.ApplyFn(path, secret, ao...)
+// List lists secrets at the given path.
+func (l *LogicalClient) List(path string) (*api.Secret, error) {
+	return l.ListFn(path)
 }
 
-// Delete deletes a secret at a given path.
-func (k *KVClient) Delete(path string) error {
-	return k.DeleteFn(path)
+// JSONMergePatch patches data at the given path.
+func (l *LogicalClient) JSONMergePatch(ctx context.Context, path string, data map[string]any) (*api.Secret, error) {
+	return l.JSONMergePatchFn(ctx, path, data)
 }
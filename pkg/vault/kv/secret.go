@@ -17,10 +17,13 @@
 package kv
 
 import (
+	"context"
 	"encoding/json"
+	"time"
 
 	"github.com/hashicorp/vault/api"
 
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
 	"github.com/crossplane/crossplane-runtime/pkg/resource"
 )
 
@@ -30,16 +33,22 @@ const (
 	errRead             = "cannot read secret"
 	errWriteData        = "cannot write secret Data"
 	errUpdateNotAllowed = "update not allowed"
-
-	// ErrNotFound is the error returned when secret does not exist.
-	ErrNotFound = "secret not found"
+	errNotWrapped       = "response is not wrapped"
+	errList             = "cannot list secrets"
 )
 
+// TransitKeyVersionLabel is the custom metadata key holding the oldest version
+// of the Transit key the values of a secret are encrypted with. Secrets with an
+// outdated version can be rewrapped after rotating the key.
+const TransitKeyVersionLabel = "transit.secrets.crossplane.io/key-version"
+
 // LogicalClient is a client to perform logical backend operations on Vault.
 type LogicalClient interface {
 	Read(path string) (*api.Secret, error)
 	Write(path string, data map[string]any) (*api.Secret, error)
 	Delete(path string) (*api.Secret, error)
+	List(path string) (*api.Secret, error)
+	JSONMergePatch(ctx context.Context, path string, data map[string]any) (*api.Secret, error)
 }
 
 // Secret is a Vault KV secret.
@@ -47,6 +56,15 @@ type Secret struct {
 	CustomMeta map[string]string
 	Data       map[string]string
 	version    json.Number
+
+	// deletionTime is the time the version of a KV v2 secret is or will be
+	// deleted at, if any.
+	deletionTime time.Time
+}
+
+// deleted returns true if the secret is a deleted version of a KV v2 secret.
+func (kv *Secret) deleted() bool {
+	return !kv.deletionTime.IsZero() && !kv.deletionTime.After(time.Now())
 }
 
 // NewSecret returns a new Secret.
@@ -90,10 +108,54 @@ func AllowUpdateIf(fn func(current, desired *Secret) bool) ApplyOption {
 	}
 }
 
-// IsNotFound returns whether given error is a "Not Found" error or not.
-func IsNotFound(err error) bool {
-	if err == nil {
-		return false
+// SecretFromResponse returns the Secret contained in the supplied response of
+// reading a secret, e.g. an unwrapped response, for either version of the KV
+// Secrets Engine.
+func SecretFromResponse(s *api.Secret) (*Secret, error) {
+	kv := &Secret{}
+	if s == nil {
+		return kv, nil
+	}
+	// kv v2 responses nest data and metadata blocks inside the top level
+	// "Data" field, while kv v1 responses contain the data directly, where a
+	// map would not be a valid connection secret value.
+	if _, ok := s.Data["metadata"].(map[string]any); ok {
+		return kv, (&V2Client{}).parseAsKVSecret(s, kv)
+	}
+	if _, ok := s.Data["data"].(map[string]any); ok {
+		return kv, (&V2Client{}).parseAsKVSecret(s, kv)
+	}
+	return kv, (&V1Client{}).parseAsSecret(s, kv)
+}
+
+func wrapInfo(s *api.Secret) (*api.SecretWrapInfo, error) {
+	if isMissing(s) {
+		return nil, notFound(s)
+	}
+	if s.WrapInfo == nil {
+		return nil, errors.New(errNotWrapped)
+	}
+	return s.WrapInfo, nil
+}
+
+// listKeys returns the keys of a LIST response. Keys ending with a slash are
+// folders, i.e. prefixes of other secrets.
+func listKeys(s *api.Secret) []string {
+	if s == nil {
+		return nil
 	}
-	return err.Error() == ErrNotFound
+	keys, _ := s.Data["keys"].([]any)
+	out := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if ks, ok := k.(string); ok {
+			out = append(out, ks)
+		}
+	}
+	return out
+}
+
+// IsNotFound returns whether given error is a "Not Found" error or not, even
+// if it was wrapped.
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
 }
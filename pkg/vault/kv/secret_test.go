@@ -0,0 +1,75 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package kv
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/hashicorp/vault/api"
+)
+
+func TestSecretFromResponse(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		in     *api.Secret
+		want   *Secret
+	}{
+		"NoResponse": {
+			reason: "Should return an empty secret if there is no response.",
+			want:   &Secret{},
+		},
+		"V1Secret": {
+			reason: "Should parse data and prefixed metadata of a v1 secret.",
+			in: &api.Secret{
+				Data: map[string]any{
+					"foo":          "bar",
+					"metadata:baz": "qux",
+				},
+			},
+			want: NewSecret(map[string]string{"foo": "bar"}, map[string]string{"baz": "qux"}),
+		},
+		"V2Secret": {
+			reason: "Should parse nested data and custom metadata of a v2 secret.",
+			in: &api.Secret{
+				Data: map[string]any{
+					"data": map[string]any{
+						"foo": "bar",
+					},
+					"metadata": map[string]any{
+						"custom_metadata": map[string]any{
+							"baz": "qux",
+						},
+					},
+				},
+			},
+			want: NewSecret(map[string]string{"foo": "bar"}, map[string]string{"baz": "qux"}),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := SecretFromResponse(tc.in)
+			if err != nil {
+				t.Fatalf("\n%s\nSecretFromResponse(...): unexpected error: %v", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want, got, cmpopts.IgnoreUnexported(Secret{})); diff != "" {
+				t.Errorf("\n%s\nSecretFromResponse(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
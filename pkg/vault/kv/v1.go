@@ -42,7 +42,7 @@ type V1Client struct {
 // NewV1Client returns a new V1Client.
 func NewV1Client(logical LogicalClient, mountPath string) *V1Client {
 	kv := &V1Client{
-		client:    logical,
+		client:    errorClient{logical},
 		mountPath: mountPath,
 	}
 
@@ -51,16 +51,32 @@ func NewV1Client(logical LogicalClient, mountPath string) *V1Client {
 
 // Get returns a Secret at a given path.
 func (c *V1Client) Get(path string, secret *Secret) error {
+	if err := validatePath(path); err != nil {
+		return err
+	}
 	s, err := c.client.Read(filepath.Join(c.mountPath, path))
 	if err != nil {
 		return errors.Wrap(err, errRead)
 	}
-	if s == nil {
-		return errors.New(ErrNotFound)
+	if isMissing(s) {
+		return notFound(s)
 	}
 	return c.parseAsSecret(s, secret)
 }
 
+// GetWrapped returns the response-wrapping token of the Secret at a given
+// path. The LogicalClient must be configured to request wrapped responses.
+func (c *V1Client) GetWrapped(path string) (*api.SecretWrapInfo, error) {
+	if err := validatePath(path); err != nil {
+		return nil, err
+	}
+	s, err := c.client.Read(filepath.Join(c.mountPath, path))
+	if err != nil {
+		return nil, errors.Wrap(err, errRead)
+	}
+	return wrapInfo(s)
+}
+
 // Apply applies given Secret at path by patching its Data and setting
 // provided custom metadata.
 func (c *V1Client) Apply(path string, secret *Secret, ao ...ApplyOption) error {
@@ -87,8 +103,18 @@ func (c *V1Client) Apply(path string, secret *Secret, ao ...ApplyOption) error {
 
 }
 
+// List returns the names of the Secrets and folders under the given path.
+// Folder names end with a slash.
+func (c *V1Client) List(path string) ([]string, error) {
+	s, err := c.client.List(filepath.Join(c.mountPath, path))
+	return listKeys(s), errors.Wrap(err, errList)
+}
+
 // Delete deletes Secret at the given path.
 func (c *V1Client) Delete(path string) error {
+	if err := validatePath(path); err != nil {
+		return err
+	}
 	_, err := c.client.Delete(filepath.Join(c.mountPath, path))
 	return errors.Wrap(err, errDelete)
 }
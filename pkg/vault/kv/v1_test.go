@@ -24,10 +24,11 @@ import (
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/hashicorp/vault/api"
 
-	"github.com/crossplane/crossplane-runtime/pkg/connection/store/vault/kv/fake"
 	"github.com/crossplane/crossplane-runtime/pkg/errors"
 	"github.com/crossplane/crossplane-runtime/pkg/resource"
 	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/vault/kv/fake"
 )
 
 func TestV1ClientGet(t *testing.T) {
@@ -72,7 +73,7 @@ func TestV1ClientGet(t *testing.T) {
 				path: secretName,
 			},
 			want: want{
-				err: errors.New(ErrNotFound),
+				err: ErrNotFound,
 				out: NewSecret(nil, nil),
 			},
 		},
@@ -489,3 +490,83 @@ func TestV1ClientDelete(t *testing.T) {
 		})
 	}
 }
+
+func TestV1ClientList(t *testing.T) {
+	type args struct {
+		client LogicalClient
+		path   string
+	}
+	type want struct {
+		keys []string
+		err  error
+	}
+	cases := map[string]struct {
+		reason string
+		args
+		want
+	}{
+		"ErrorWhileListingSecrets": {
+			reason: "Should return a proper error if listing secrets failed.",
+			args: args{
+				client: &fake.LogicalClient{
+					ListFn: func(path string) (*api.Secret, error) {
+						return nil, errBoom
+					},
+				},
+				path: secretName,
+			},
+			want: want{
+				keys: []string{},
+				err:  errors.Wrap(errBoom, errList),
+			},
+		},
+		"NoSecrets": {
+			reason: "Should return no keys if there are no secrets under the path.",
+			args: args{
+				client: &fake.LogicalClient{
+					ListFn: func(path string) (*api.Secret, error) {
+						// Vault logical client returns both error and secret as
+						// nil if there is nothing to list.
+						return nil, nil
+					},
+				},
+				path: secretName,
+			},
+			want: want{},
+		},
+		"SuccessfulList": {
+			reason: "Should return the keys of secrets and folders under the path.",
+			args: args{
+				client: &fake.LogicalClient{
+					ListFn: func(path string) (*api.Secret, error) {
+						if diff := cmp.Diff(filepath.Join(mountPath, secretName), path); diff != "" {
+							t.Errorf("r: -want, +got:\n%s", diff)
+						}
+						return &api.Secret{
+							Data: map[string]any{
+								"keys": []any{"foo", "bar/"},
+							},
+						}, nil
+					},
+				},
+				path: secretName,
+			},
+			want: want{
+				keys: []string{"foo", "bar/"},
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			k := NewV1Client(tc.args.client, mountPath)
+
+			keys, err := k.List(tc.args.path)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nv1Client.List(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.keys, keys, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("\n%s\nv1Client.List(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -17,8 +17,11 @@
 package kv
 
 import (
+	"context"
 	"encoding/json"
+	"net/http"
 	"path/filepath"
+	"time"
 
 	"github.com/crossplane/crossplane-runtime/pkg/fieldpath"
 
@@ -28,8 +31,19 @@ import (
 	"github.com/crossplane/crossplane-runtime/pkg/resource"
 )
 
+// DeletedAtLabel is the custom metadata key holding the time a secret was
+// soft deleted at with the DestroyAfter deletion policy. The secret is purged
+// once its retention period elapsed since then.
+const DeletedAtLabel = "secrets.crossplane.io/deleted-at"
+
 const (
 	errWriteMetadata = "cannot write secret metadata Data"
+	errPatchMetadata = "cannot patch secret metadata Data"
+	errPatchData     = "cannot patch secret Data"
+
+	// errCASMismatch is the error message returned by Vault when the
+	// check-and-set parameter of a write does not match the current version.
+	errCASMismatch = "check-and-set parameter did not match the current version"
 )
 
 // V2Client is a Vault KV V2 Secrets Engine client.
@@ -37,40 +51,154 @@ const (
 type V2Client struct {
 	client    LogicalClient
 	mountPath string
+
+	softDelete       bool
+	destroyAfter     time.Duration
+	metadataSettings func(path string) MetadataSettings
+	patch            bool
+	casRetries       int
+}
+
+// MetadataSettings are the settings of a secret metadata in a KV v2 Secrets
+// Engine. Nil fields are not written, hence fall back to the mount defaults.
+// https://developer.hashicorp.com/vault/api-docs/secret/kv/kv-v2#create-update-metadata
+type MetadataSettings struct {
+	MaxVersions        *int
+	CASRequired        *bool
+	DeleteVersionAfter *time.Duration
+}
+
+func (s MetadataSettings) empty() bool {
+	return s.MaxVersions == nil && s.CASRequired == nil && s.DeleteVersionAfter == nil
+}
+
+// A V2ClientOption configures a V2Client.
+type V2ClientOption func(*V2Client)
+
+// WithSoftDelete configures the V2Client to only delete the latest version of
+// a secret instead of destroying its metadata and all versions.
+func WithSoftDelete() V2ClientOption {
+	return func(c *V2Client) {
+		c.softDelete = true
+	}
+}
+
+// WithDestroyAfter configures the V2Client to soft delete secrets and to
+// record the time they were deleted at, so that Purge permanently deletes them
+// once the supplied retention period elapsed.
+func WithDestroyAfter(d time.Duration) V2ClientOption {
+	return func(c *V2Client) {
+		c.softDelete = true
+		c.destroyAfter = d
+	}
+}
+
+// WithMetadataSettings configures the V2Client to apply the metadata settings
+// returned by the supplied function for a given secret path whenever it writes
+// the metadata of that secret.
+func WithMetadataSettings(fn func(path string) MetadataSettings) V2ClientOption {
+	return func(c *V2Client) {
+		c.metadataSettings = fn
+	}
+}
+
+// WithPatch configures the V2Client to update existing secrets with JSON merge
+// patches where supported by Vault, falling back to check-and-set writes
+// otherwise.
+// https://developer.hashicorp.com/vault/api-docs/secret/kv/kv-v2#patch-secret
+func WithPatch() V2ClientOption {
+	return func(c *V2Client) {
+		c.patch = true
+	}
+}
+
+// WithCASRetries configures the number of times the V2Client retries writes
+// rejected because of a check-and-set conflict.
+func WithCASRetries(n int) V2ClientOption {
+	return func(c *V2Client) {
+		c.casRetries = n
+	}
 }
 
 // NewV2Client returns a new V2Client.
-func NewV2Client(logical LogicalClient, mountPath string) *V2Client {
+func NewV2Client(logical LogicalClient, mountPath string, opts ...V2ClientOption) *V2Client {
 	kv := &V2Client{
-		client:    logical,
+		client:    errorClient{logical},
 		mountPath: mountPath,
 	}
 
+	for _, o := range opts {
+		o(kv)
+	}
+
 	return kv
 }
 
-// Get returns a Secret at a given path.
+// Get returns a Secret at a given path. An error that satisfies IsNotFound is
+// returned if its latest version is deleted.
 func (c *V2Client) Get(path string, secret *Secret) error {
+	s := &Secret{}
+	if err := c.get(path, s); err != nil {
+		return err
+	}
+	if s.deleted() {
+		return notFound(nil)
+	}
+	*secret = *s
+	return nil
+}
+
+// get returns the latest version of the Secret at a given path, even if it is
+// deleted, in which case it has no data but still has its custom metadata.
+// Vault responds to reads of deleted versions with a 404 that has a body.
+func (c *V2Client) get(path string, secret *Secret) error {
+	if err := validatePath(path); err != nil {
+		return err
+	}
 	s, err := c.client.Read(c.dataPath(path))
 	if err != nil {
 		return errors.Wrap(err, errRead)
 	}
-	if s == nil {
-		return errors.New(ErrNotFound)
+	if isMissing(s) {
+		return notFound(s)
 	}
 	return c.parseAsKVSecret(s, secret)
 }
 
+// GetWrapped returns the response-wrapping token of the Secret at a given
+// path. The LogicalClient must be configured to request wrapped responses.
+func (c *V2Client) GetWrapped(path string) (*api.SecretWrapInfo, error) {
+	if err := validatePath(path); err != nil {
+		return nil, err
+	}
+	s, err := c.client.Read(c.dataPath(path))
+	if err != nil {
+		return nil, errors.Wrap(err, errRead)
+	}
+	return wrapInfo(s)
+}
+
 // Apply applies given Secret at path by patching its Data and setting
-// provided custom metadata.
+// provided custom metadata. Writes rejected because of a check-and-set
+// conflict with a concurrent writer are retried up to the configured number
+// of times.
 func (c *V2Client) Apply(path string, secret *Secret, ao ...ApplyOption) error {
+	err := c.apply(path, secret, ao...)
+	for i := 0; i < c.casRetries && isCASConflict(err); i++ {
+		err = c.apply(path, secret, ao...)
+	}
+	return err
+}
+
+func (c *V2Client) apply(path string, secret *Secret, ao ...ApplyOption) error {
 	existing := &Secret{}
-	err := c.Get(path, existing)
+	err := c.get(path, existing)
 
 	if resource.Ignore(IsNotFound, err) != nil {
 		return errors.Wrap(err, errGet)
 	}
-	if !IsNotFound(err) {
+	created := IsNotFound(err)
+	if !created {
 		for _, o := range ao {
 			if err = o(existing, secret); err != nil {
 				return err
@@ -82,26 +210,152 @@ func (c *V2Client) Apply(path string, secret *Secret, ao ...ApplyOption) error {
 	// the secret before writing any data. This is to prevent situations where
 	// secret create with some data but owner not set.
 	mp, changed := metadataPayload(existing.CustomMeta, secret.CustomMeta)
+	if c.metadataSettings != nil {
+		if ms := c.metadataSettings(path); !ms.empty() {
+			if !changed {
+				// Custom metadata is up to date, there is no need to send it.
+				delete(mp, "custom_metadata")
+			}
+			ms.addTo(mp)
+			// Settings are always written when creating the secret, and along
+			// with any other metadata update afterwards.
+			changed = changed || created
+		}
+	}
 	if changed {
-		if _, err := c.client.Write(c.metadataPath(path), mp); err != nil {
-			return errors.Wrap(err, errWriteMetadata)
+		if err := c.writeMetadata(path, existing.CustomMeta, mp, created); err != nil {
+			return err
 		}
 	}
 
 	dp, changed := dataPayload(existing, secret)
 	if changed {
-		if _, err := c.client.Write(c.dataPath(path), dp); err != nil {
-			return errors.Wrap(err, errWriteData)
+		if err := c.writeData(path, existing, secret, dp, created); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
-// Delete deletes Secret at the given path.
+// writeMetadata writes the supplied metadata payload. If configured to patch,
+// existing metadata is updated with a JSON merge patch so that only the
+// changed custom metadata keys are touched.
+func (c *V2Client) writeMetadata(path string, existing map[string]string, payload map[string]any, created bool) error {
+	if c.patch && !created {
+		pp := make(map[string]any, len(payload))
+		for k, v := range payload {
+			pp[k] = v
+		}
+		if cm, ok := payload["custom_metadata"]; ok {
+			desired, _ := cm.(map[string]string)
+			pp["custom_metadata"] = customMetadataPatch(existing, desired)
+		}
+		_, err := c.client.JSONMergePatch(context.Background(), c.metadataPath(path), pp)
+		if !isPatchUnsupported(err) {
+			return errors.Wrap(err, errPatchMetadata)
+		}
+	}
+	_, err := c.client.Write(c.metadataPath(path), payload)
+	return errors.Wrap(err, errWriteMetadata)
+}
+
+// writeData writes the supplied data payload. If configured to patch,
+// existing data is updated with a JSON merge patch containing only the changed
+// keys, which does not conflict with concurrent writers of other keys.
+func (c *V2Client) writeData(path string, existing, new *Secret, payload map[string]any, created bool) error {
+	if c.patch && !created {
+		pp := map[string]any{
+			"data": dataPatch(existing, new),
+		}
+		if c.metadataSettings != nil {
+			if ms := c.metadataSettings(path); ms.CASRequired != nil && *ms.CASRequired {
+				pp["options"] = payload["options"]
+			}
+		}
+		_, err := c.client.JSONMergePatch(context.Background(), c.dataPath(path), pp)
+		if !isPatchUnsupported(err) {
+			return errors.Wrap(err, errPatchData)
+		}
+	}
+	_, err := c.client.Write(c.dataPath(path), payload)
+	return errors.Wrap(err, errWriteData)
+}
+
+// List returns the names of the Secrets and folders under the given path.
+// Folder names end with a slash.
+func (c *V2Client) List(path string) ([]string, error) {
+	s, err := c.client.List(c.metadataPath(path))
+	return listKeys(s), errors.Wrap(err, errList)
+}
+
+// Delete deletes Secret at the given path. Unless configured to soft delete,
+// metadata and all versions of the Secret are permanently deleted.
 func (c *V2Client) Delete(path string) error {
-	// Note(turkenh): With V2Client, we need to delete metadata and all versions:
-	// https://www.vaultproject.io/api-docs/secret/kv/kv-v2#delete-metadata-and-all-versions
+	if err := validatePath(path); err != nil {
+		return err
+	}
+	if !c.softDelete {
+		return c.destroy(path)
+	}
+
+	if c.destroyAfter > 0 {
+		existing := &Secret{}
+		err := c.get(path, existing)
+		if IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, errGet)
+		}
+		// The time of the first deletion is kept, so that deleting the
+		// secret again does not extend its retention period.
+		if _, ok := existing.CustomMeta[DeletedAtLabel]; !ok || !existing.deleted() {
+			cm := make(map[string]string, len(existing.CustomMeta)+1)
+			for k, v := range existing.CustomMeta {
+				cm[k] = v
+			}
+			cm[DeletedAtLabel] = time.Now().UTC().Format(time.RFC3339)
+			if err := c.writeMetadata(path, existing.CustomMeta, map[string]any{"custom_metadata": cm}, false); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Deleting the data path only marks the latest version as deleted, which
+	// keeps the history and allows undeleting it.
+	// https://developer.hashicorp.com/vault/api-docs/secret/kv/kv-v2#delete-latest-version-of-secret
+	_, err := c.client.Delete(c.dataPath(path))
+	return errors.Wrap(err, errDelete)
+}
+
+// Purge permanently deletes the Secret at the given path if it was soft
+// deleted with the DestroyAfter deletion policy and its retention period
+// elapsed since. It returns whether the Secret was purged. Secrets written
+// again since they were deleted are never purged.
+func (c *V2Client) Purge(path string) (bool, error) {
+	if c.destroyAfter <= 0 {
+		return false, nil
+	}
+	s := &Secret{}
+	err := c.get(path, s)
+	if IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, errGet)
+	}
+	at, err := time.Parse(time.RFC3339, s.CustomMeta[DeletedAtLabel])
+	if err != nil || !s.deleted() || time.Since(at) < c.destroyAfter {
+		return false, nil
+	}
+	return true, c.destroy(path)
+}
+
+// destroy permanently deletes the metadata and all versions of the Secret at
+// the given path.
+// https://developer.hashicorp.com/vault/api-docs/secret/kv/kv-v2#delete-metadata-and-all-versions
+func (c *V2Client) destroy(path string) error {
 	_, err := c.client.Delete(c.metadataPath(path))
 	return errors.Wrap(err, errDelete)
 }
@@ -130,6 +384,31 @@ func dataPayload(existing, new *Secret) (map[string]any, bool) {
 	}, changed
 }
 
+func dataPatch(existing, new *Secret) map[string]string {
+	data := make(map[string]string, len(new.Data))
+	for k, v := range new.Data {
+		if ev, ok := existing.Data[k]; !ok || ev != v {
+			data[k] = v
+		}
+	}
+	return data
+}
+
+// customMetadataPatch returns a JSON merge patch turning existing custom
+// metadata into the desired one, i.e. removed keys are set to null.
+func customMetadataPatch(existing, desired map[string]string) map[string]any {
+	patch := make(map[string]any, len(existing)+len(desired))
+	for k := range existing {
+		if _, ok := desired[k]; !ok {
+			patch[k] = nil
+		}
+	}
+	for k, v := range desired {
+		patch[k] = v
+	}
+	return patch
+}
+
 func metadataPayload(existing, new map[string]string) (map[string]any, bool) {
 	payload := map[string]any{
 		"custom_metadata": new,
@@ -145,6 +424,18 @@ func metadataPayload(existing, new map[string]string) (map[string]any, bool) {
 	return payload, false
 }
 
+func (s MetadataSettings) addTo(payload map[string]any) {
+	if s.MaxVersions != nil {
+		payload["max_versions"] = *s.MaxVersions
+	}
+	if s.CASRequired != nil {
+		payload["cas_required"] = *s.CASRequired
+	}
+	if s.DeleteVersionAfter != nil {
+		payload["delete_version_after"] = s.DeleteVersionAfter.String()
+	}
+}
+
 func (c *V2Client) parseAsKVSecret(s *api.Secret, kv *Secret) error {
 	// Note(turkenh): kv v2 secrets contains another "data" and "metadata"
 	// blocks inside the top level generic "Data" field.
@@ -192,6 +483,13 @@ func parseSecretMeta(payload *fieldpath.Paved, kv *Secret) error {
 	if err = pavedMeta.GetValueInto("version", &kv.version); resource.Ignore(fieldpath.IsNotFound, err) != nil {
 		return err
 	}
+	// Versions that are not deleted have an empty deletion time.
+	if dt, _ := pavedMeta.GetString("deletion_time"); dt != "" {
+		kv.deletionTime, _ = time.Parse(time.RFC3339Nano, dt)
+	}
+	if destroyed, _ := pavedMeta.GetBool("destroyed"); destroyed && kv.deletionTime.IsZero() {
+		kv.deletionTime = time.Unix(0, 0)
+	}
 
 	customMeta := map[string]any{}
 	err = pavedMeta.GetValueInto("custom_metadata", &customMeta)
@@ -210,6 +508,23 @@ func parseSecretMeta(payload *fieldpath.Paved, kv *Secret) error {
 	return nil
 }
 
+// isPatchUnsupported returns whether the supplied error indicates that a patch
+// request is not supported by the Vault server, or not permitted by the policy
+// while a regular write may still be.
+func isPatchUnsupported(err error) bool {
+	re := &api.ResponseError{}
+	if !errors.As(err, &re) {
+		return false
+	}
+	return re.StatusCode == http.StatusMethodNotAllowed || re.StatusCode == http.StatusForbidden
+}
+
+// isCASConflict returns whether the supplied error indicates that a write was
+// rejected because its check-and-set parameter was outdated.
+func isCASConflict(err error) bool {
+	return errors.Is(err, ErrCASConflict)
+}
+
 func (c *V2Client) dataPath(secretPath string) string {
 	return filepath.Join(c.mountPath, "data", secretPath)
 }
@@ -17,18 +17,22 @@
 package kv
 
 import (
+	"context"
 	"encoding/json"
+	"net/http"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/hashicorp/vault/api"
 
-	"github.com/crossplane/crossplane-runtime/pkg/connection/store/vault/kv/fake"
 	"github.com/crossplane/crossplane-runtime/pkg/errors"
 	"github.com/crossplane/crossplane-runtime/pkg/resource"
 	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/vault/kv/fake"
 )
 
 const (
@@ -38,7 +42,11 @@ const (
 )
 
 var (
-	errBoom = errors.New("boom")
+	errBoom        = errors.New("boom")
+	errCASConflict = &api.ResponseError{
+		StatusCode: http.StatusBadRequest,
+		Errors:     []string{"check-and-set parameter did not match the current version"},
+	}
 )
 
 func TestV2ClientGet(t *testing.T) {
@@ -83,7 +91,22 @@ func TestV2ClientGet(t *testing.T) {
 				path: secretName,
 			},
 			want: want{
-				err: errors.New(ErrNotFound),
+				err: ErrNotFound,
+				out: NewSecret(nil, nil),
+			},
+		},
+		"SecretDeleted": {
+			reason: "Should return a notFound error if the latest version of the secret is deleted.",
+			args: args{
+				client: &fake.LogicalClient{
+					ReadFn: func(path string) (*api.Secret, error) {
+						return deletedSecret(time.Now().Add(-time.Minute), map[string]any{"owner": "jdoe"}), nil
+					},
+				},
+				path: secretName,
+			},
+			want: want{
+				err: ErrNotFound,
 				out: NewSecret(nil, nil),
 			},
 		},
@@ -206,11 +229,85 @@ func TestV2ClientGet(t *testing.T) {
 	}
 }
 
+func TestV2ClientGetWrapped(t *testing.T) {
+	type want struct {
+		err error
+		out *api.SecretWrapInfo
+	}
+	cases := map[string]struct {
+		reason string
+		client LogicalClient
+		want
+	}{
+		"ErrorWhileReadingSecret": {
+			reason: "Should return a proper error if reading the secret failed.",
+			client: &fake.LogicalClient{
+				ReadFn: func(path string) (*api.Secret, error) {
+					return nil, errBoom
+				},
+			},
+			want: want{
+				err: errors.Wrap(errBoom, errRead),
+			},
+		},
+		"SecretNotFound": {
+			reason: "Should return a notFound error if the secret does not exist.",
+			client: &fake.LogicalClient{
+				ReadFn: func(path string) (*api.Secret, error) {
+					return nil, nil
+				},
+			},
+			want: want{
+				err: ErrNotFound,
+			},
+		},
+		"NotWrapped": {
+			reason: "Should return an error if the response is not wrapped.",
+			client: &fake.LogicalClient{
+				ReadFn: func(path string) (*api.Secret, error) {
+					return &api.Secret{Data: map[string]any{"data": map[string]any{"foo": "bar"}}}, nil
+				},
+			},
+			want: want{
+				err: errors.New(errNotWrapped),
+			},
+		},
+		"Wrapped": {
+			reason: "Should return the wrapping token read from the data path of the secret.",
+			client: &fake.LogicalClient{
+				ReadFn: func(path string) (*api.Secret, error) {
+					if diff := cmp.Diff(filepath.Join(mountPath, "data", secretName), path); diff != "" {
+						t.Errorf("r: -want, +got:\n%s", diff)
+					}
+					return &api.Secret{WrapInfo: &api.SecretWrapInfo{Token: "s.wrapped", TTL: 300}}, nil
+				},
+			},
+			want: want{
+				out: &api.SecretWrapInfo{Token: "s.wrapped", TTL: 300},
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			k := NewV2Client(tc.client, mountPath)
+
+			got, err := k.GetWrapped(secretName)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nv2Client.GetWrapped(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.out, got); diff != "" {
+				t.Errorf("\n%s\nv2Client.GetWrapped(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
 func TestV2ClientApply(t *testing.T) {
 	type args struct {
 		client LogicalClient
 		in     *Secret
 		path   string
+		opts   []V2ClientOption
 
 		ao []ApplyOption
 	}
@@ -597,10 +694,272 @@ func TestV2ClientApply(t *testing.T) {
 				err: nil,
 			},
 		},
+		"SuccessfulCreateWithMetadataSettings": {
+			reason: "Should write metadata settings when creating a v2 secret.",
+			args: args{
+				client: &fake.LogicalClient{
+					ReadFn: func(path string) (*api.Secret, error) {
+						return nil, nil
+					},
+					WriteFn: func(path string, data map[string]any) (*api.Secret, error) {
+						switch path {
+						case filepath.Join(mountPath, "metadata", secretName):
+							if diff := cmp.Diff(map[string]any{
+								"max_versions":         5,
+								"cas_required":         true,
+								"delete_version_after": "1h0m0s",
+							}, data); diff != "" {
+								t.Errorf("r: -want, +got:\n%s", diff)
+							}
+						case filepath.Join(mountPath, "data", secretName):
+						default:
+							t.Errorf("unexpected write to %q", path)
+						}
+						return nil, nil
+					},
+				},
+				path: secretName,
+				opts: []V2ClientOption{WithMetadataSettings(func(path string) MetadataSettings {
+					mv, cas, dva := 5, true, time.Hour
+					return MetadataSettings{MaxVersions: &mv, CASRequired: &cas, DeleteVersionAfter: &dva}
+				})},
+				in: NewSecret(map[string]string{
+					"key1": "val1",
+				}, nil),
+			},
+			want: want{
+				err: nil,
+			},
+		},
+		"NoMetadataSettingsWriteIfUpToDate": {
+			reason: "Should not write metadata settings of an existing v2 secret if its custom metadata is up to date.",
+			args: args{
+				client: &fake.LogicalClient{
+					ReadFn: func(path string) (*api.Secret, error) {
+						return &api.Secret{
+							Data: map[string]any{
+								"data": map[string]any{
+									"key1": "val1",
+								},
+								"metadata": map[string]any{
+									"custom_metadata": map[string]any{
+										"foo": "bar",
+									},
+									"version": json.Number("2"),
+								},
+							},
+						}, nil
+					},
+					WriteFn: func(path string, data map[string]any) (*api.Secret, error) {
+						t.Errorf("unexpected write to %q", path)
+						return nil, nil
+					},
+				},
+				path: secretName,
+				opts: []V2ClientOption{WithMetadataSettings(func(path string) MetadataSettings {
+					mv := 5
+					return MetadataSettings{MaxVersions: &mv}
+				})},
+				in: NewSecret(map[string]string{
+					"key1": "val1",
+				}, map[string]string{
+					"foo": "bar",
+				}),
+			},
+			want: want{
+				err: nil,
+			},
+		},
+		"SuccessfulPatch": {
+			reason: "Should patch only the changed keys of an existing v2 secret if configured to patch.",
+			args: args{
+				client: &fake.LogicalClient{
+					ReadFn: func(path string) (*api.Secret, error) {
+						return &api.Secret{
+							Data: map[string]any{
+								"data": map[string]any{
+									"key1": "val1",
+								},
+								"metadata": map[string]any{
+									"custom_metadata": map[string]any{
+										"old": "meta",
+									},
+									"version": json.Number("2"),
+								},
+							},
+						}, nil
+					},
+					JSONMergePatchFn: func(_ context.Context, path string, data map[string]any) (*api.Secret, error) {
+						switch path {
+						case filepath.Join(mountPath, "metadata", secretName):
+							if diff := cmp.Diff(map[string]any{
+								"custom_metadata": map[string]any{
+									"old": nil,
+									"foo": "bar",
+								},
+							}, data); diff != "" {
+								t.Errorf("r: -want, +got:\n%s", diff)
+							}
+						case filepath.Join(mountPath, "data", secretName):
+							if diff := cmp.Diff(map[string]any{
+								"data": map[string]string{
+									"key2": "val2",
+								},
+							}, data); diff != "" {
+								t.Errorf("r: -want, +got:\n%s", diff)
+							}
+						default:
+							t.Errorf("unexpected patch to %q", path)
+						}
+						return nil, nil
+					},
+				},
+				path: secretName,
+				opts: []V2ClientOption{WithPatch()},
+				in: NewSecret(map[string]string{
+					"key1": "val1",
+					"key2": "val2",
+				}, map[string]string{
+					"foo": "bar",
+				}),
+			},
+			want: want{
+				err: nil,
+			},
+		},
+		"PatchUnsupported": {
+			reason: "Should fall back to a check-and-set write if patching is not supported.",
+			args: args{
+				client: &fake.LogicalClient{
+					ReadFn: func(path string) (*api.Secret, error) {
+						return &api.Secret{
+							Data: map[string]any{
+								"data": map[string]any{
+									"key1": "val1",
+								},
+								"metadata": map[string]any{
+									"custom_metadata": map[string]any{
+										"old": "meta",
+									},
+									"version": json.Number("2"),
+								},
+							},
+						}, nil
+					},
+					JSONMergePatchFn: func(_ context.Context, path string, data map[string]any) (*api.Secret, error) {
+						return nil, &api.ResponseError{StatusCode: http.StatusMethodNotAllowed}
+					},
+					WriteFn: func(path string, data map[string]any) (*api.Secret, error) {
+						if diff := cmp.Diff(filepath.Join(mountPath, "data", secretName), path); diff != "" {
+							t.Errorf("r: -want, +got:\n%s", diff)
+						}
+						if diff := cmp.Diff(map[string]any{
+							"options": map[string]any{
+								"cas": json.Number("2"),
+							},
+							"data": map[string]string{
+								"key1": "val1",
+								"key2": "val2",
+							},
+						}, data); diff != "" {
+							t.Errorf("r: -want, +got:\n%s", diff)
+						}
+						return nil, nil
+					},
+				},
+				path: secretName,
+				opts: []V2ClientOption{WithPatch()},
+				in: NewSecret(map[string]string{
+					"key2": "val2",
+				}, map[string]string{
+					"old": "meta",
+				}),
+			},
+			want: want{
+				err: nil,
+			},
+		},
+		"RetryOnCASConflict": {
+			reason: "Should retry a write rejected because of a check-and-set conflict.",
+			args: args{
+				client: func() LogicalClient {
+					writes := 0
+					return &fake.LogicalClient{
+						ReadFn: func(path string) (*api.Secret, error) {
+							return &api.Secret{
+								Data: map[string]any{
+									"data": map[string]any{
+										"key1": "val1",
+									},
+									"metadata": map[string]any{
+										"custom_metadata": map[string]any{
+											"old": "meta",
+										},
+										"version": json.Number("2"),
+									},
+								},
+							}, nil
+						},
+						WriteFn: func(path string, data map[string]any) (*api.Secret, error) {
+							writes++
+							if writes == 1 {
+								return nil, errCASConflict
+							}
+							return nil, nil
+						},
+					}
+				}(),
+				path: secretName,
+				opts: []V2ClientOption{WithCASRetries(1)},
+				in: NewSecret(map[string]string{
+					"key2": "val2",
+				}, map[string]string{
+					"old": "meta",
+				}),
+			},
+			want: want{
+				err: nil,
+			},
+		},
+		"CASConflictRetriesExhausted": {
+			reason: "Should return a proper error if a write is still conflicting after all retries.",
+			args: args{
+				client: &fake.LogicalClient{
+					ReadFn: func(path string) (*api.Secret, error) {
+						return &api.Secret{
+							Data: map[string]any{
+								"data": map[string]any{
+									"key1": "val1",
+								},
+								"metadata": map[string]any{
+									"custom_metadata": map[string]any{
+										"old": "meta",
+									},
+									"version": json.Number("2"),
+								},
+							},
+						}, nil
+					},
+					WriteFn: func(path string, data map[string]any) (*api.Secret, error) {
+						return nil, errCASConflict
+					},
+				},
+				path: secretName,
+				opts: []V2ClientOption{WithCASRetries(2)},
+				in: NewSecret(map[string]string{
+					"key2": "val2",
+				}, map[string]string{
+					"old": "meta",
+				}),
+			},
+			want: want{
+				err: errors.Wrap(errCASConflict, errWriteData),
+			},
+		},
 	}
 	for name, tc := range cases {
 		t.Run(name, func(t *testing.T) {
-			k := NewV2Client(tc.args.client, mountPath)
+			k := NewV2Client(tc.args.client, mountPath, tc.args.opts...)
 
 			err := k.Apply(tc.args.path, tc.args.in, tc.args.ao...)
 			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
@@ -614,6 +973,7 @@ func TestV2ClientDelete(t *testing.T) {
 	type args struct {
 		client LogicalClient
 		path   string
+		opts   []V2ClientOption
 	}
 	type want struct {
 		err error
@@ -668,10 +1028,93 @@ func TestV2ClientDelete(t *testing.T) {
 			},
 			want: want{},
 		},
+		"SuccessfulSoftDelete": {
+			reason: "Should only delete the latest version if configured to soft delete.",
+			args: args{
+				client: &fake.LogicalClient{
+					DeleteFn: func(path string) (*api.Secret, error) {
+						if diff := cmp.Diff(filepath.Join(mountPath, "data", secretName), path); diff != "" {
+							t.Errorf("r: -want, +got:\n%s", diff)
+						}
+						return nil, nil
+					},
+				},
+				path: secretName,
+				opts: []V2ClientOption{WithSoftDelete()},
+			},
+			want: want{},
+		},
+		"ErrorWhileMarkingDeletion": {
+			reason: "Should return a proper error if recording the deletion time failed.",
+			args: args{
+				client: &fake.LogicalClient{
+					ReadFn: func(path string) (*api.Secret, error) {
+						return liveSecret(map[string]any{"foo": "bar"}), nil
+					},
+					WriteFn: func(path string, data map[string]any) (*api.Secret, error) {
+						return nil, errBoom
+					},
+				},
+				path: secretName,
+				opts: []V2ClientOption{WithDestroyAfter(time.Hour)},
+			},
+			want: want{
+				err: errors.Wrap(errBoom, errWriteMetadata),
+			},
+		},
+		"SuccessfulDestroyAfter": {
+			reason: "Should record the deletion time in the custom metadata and then delete the latest version if configured to destroy after a duration.",
+			args: args{
+				client: &fake.LogicalClient{
+					ReadFn: func(path string) (*api.Secret, error) {
+						return liveSecret(map[string]any{"foo": "bar"}), nil
+					},
+					WriteFn: func(path string, data map[string]any) (*api.Secret, error) {
+						if diff := cmp.Diff(filepath.Join(mountPath, "metadata", secretName), path); diff != "" {
+							t.Errorf("r: -want, +got:\n%s", diff)
+						}
+						want := map[string]any{"custom_metadata": map[string]string{"foo": "bar", DeletedAtLabel: ""}}
+						if diff := cmp.Diff(want, data, cmpopts.IgnoreMapEntries(func(k, _ string) bool { return k == DeletedAtLabel })); diff != "" {
+							t.Errorf("r: -want, +got:\n%s", diff)
+						}
+						cm, _ := data["custom_metadata"].(map[string]string)
+						if _, err := time.Parse(time.RFC3339, cm[DeletedAtLabel]); err != nil {
+							t.Errorf("r: want deletion time, got %q: %v", cm[DeletedAtLabel], err)
+						}
+						return nil, nil
+					},
+					DeleteFn: func(path string) (*api.Secret, error) {
+						if diff := cmp.Diff(filepath.Join(mountPath, "data", secretName), path); diff != "" {
+							t.Errorf("r: -want, +got:\n%s", diff)
+						}
+						return nil, nil
+					},
+				},
+				path: secretName,
+				opts: []V2ClientOption{WithDestroyAfter(time.Hour)},
+			},
+			want: want{},
+		},
+		"DestroyAfterAlreadyDeleted": {
+			reason: "Should keep the time of the first deletion if the secret is deleted again.",
+			args: args{
+				client: &fake.LogicalClient{
+					ReadFn: func(path string) (*api.Secret, error) {
+						return deletedSecret(time.Now().Add(-time.Minute), map[string]any{DeletedAtLabel: "2023-01-01T00:00:00Z"}), nil
+					},
+					DeleteFn: func(path string) (*api.Secret, error) {
+						return nil, nil
+					},
+				},
+				path: secretName,
+				opts: []V2ClientOption{WithDestroyAfter(time.Hour)},
+			},
+			want: want{},
+		},
 	}
 	for name, tc := range cases {
 		t.Run(name, func(t *testing.T) {
-			k := NewV2Client(tc.args.client, mountPath)
+			k := NewV2Client(tc.args.client, mountPath, tc.args.opts...)
 
 			err := k.Delete(tc.args.path)
 			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
@@ -680,3 +1123,222 @@ func TestV2ClientDelete(t *testing.T) {
 		})
 	}
 }
+
+func TestV2ClientList(t *testing.T) {
+	type args struct {
+		client LogicalClient
+		path   string
+	}
+	type want struct {
+		keys []string
+		err  error
+	}
+	cases := map[string]struct {
+		reason string
+		args
+		want
+	}{
+		"ErrorWhileListingSecrets": {
+			reason: "Should return a proper error if listing secrets failed.",
+			args: args{
+				client: &fake.LogicalClient{
+					ListFn: func(path string) (*api.Secret, error) {
+						return nil, errBoom
+					},
+				},
+				path: secretName,
+			},
+			want: want{
+				keys: []string{},
+				err:  errors.Wrap(errBoom, errList),
+			},
+		},
+		"NoSecrets": {
+			reason: "Should return no keys if there are no secrets under the path.",
+			args: args{
+				client: &fake.LogicalClient{
+					ListFn: func(path string) (*api.Secret, error) {
+						// Vault logical client returns both error and secret as
+						// nil if there is nothing to list.
+						return nil, nil
+					},
+				},
+				path: secretName,
+			},
+			want: want{},
+		},
+		"SuccessfulList": {
+			reason: "Should return the keys of secrets and folders under the path.",
+			args: args{
+				client: &fake.LogicalClient{
+					ListFn: func(path string) (*api.Secret, error) {
+						if diff := cmp.Diff(filepath.Join(mountPath, "metadata", secretName), path); diff != "" {
+							t.Errorf("r: -want, +got:\n%s", diff)
+						}
+						return &api.Secret{
+							Data: map[string]any{
+								"keys": []any{"foo", "bar/"},
+							},
+						}, nil
+					},
+				},
+				path: secretName,
+			},
+			want: want{
+				keys: []string{"foo", "bar/"},
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			k := NewV2Client(tc.args.client, mountPath)
+
+			keys, err := k.List(tc.args.path)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nv2Client.List(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.keys, keys, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("\n%s\nv2Client.List(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+// liveSecret returns the response of reading a KV v2 secret that is not
+// deleted.
+func liveSecret(customMeta map[string]any) *api.Secret {
+	return &api.Secret{
+		Data: map[string]any{
+			"data": map[string]any{"key": "value"},
+			"metadata": map[string]any{
+				"custom_metadata": customMeta,
+				"deletion_time":   "",
+				"version":         json.Number("2"),
+			},
+		},
+	}
+}
+
+// deletedSecret returns the response of reading a KV v2 secret whose latest
+// version was deleted at the supplied time.
+func deletedSecret(at time.Time, customMeta map[string]any) *api.Secret {
+	return &api.Secret{
+		Data: map[string]any{
+			"data": nil,
+			"metadata": map[string]any{
+				"custom_metadata": customMeta,
+				"deletion_time":   at.UTC().Format(time.RFC3339Nano),
+				"version":         json.Number("2"),
+			},
+		},
+	}
+}
+
+func TestV2ClientPurge(t *testing.T) {
+	deletedAt := func(d time.Duration) map[string]any {
+		return map[string]any{DeletedAtLabel: time.Now().Add(-d).UTC().Format(time.RFC3339)}
+	}
+	type want struct {
+		purged bool
+		err    error
+	}
+	cases := map[string]struct {
+		reason string
+		opts   []V2ClientOption
+		secret *api.Secret
+		want   want
+	}{
+		"NotDestroyAfter": {
+			reason: "Should not purge secrets unless configured to destroy after a duration.",
+			opts:   []V2ClientOption{WithSoftDelete()},
+			secret: deletedSecret(time.Now().Add(-2*time.Hour), deletedAt(2*time.Hour)),
+		},
+		"NotDeleted": {
+			reason: "Should not purge secrets that were not deleted.",
+			opts:   []V2ClientOption{WithDestroyAfter(time.Hour)},
+			secret: liveSecret(nil),
+		},
+		"Recreated": {
+			reason: "Should not purge secrets that were written again since they were deleted.",
+			opts:   []V2ClientOption{WithDestroyAfter(time.Hour)},
+			secret: liveSecret(deletedAt(2 * time.Hour)),
+		},
+		"RetentionNotElapsed": {
+			reason: "Should not purge secrets before their retention period elapsed.",
+			opts:   []V2ClientOption{WithDestroyAfter(time.Hour)},
+			secret: deletedSecret(time.Now().Add(-time.Minute), deletedAt(time.Minute)),
+		},
+		"RetentionElapsed": {
+			reason: "Should destroy the metadata and all versions of secrets whose retention period elapsed.",
+			opts:   []V2ClientOption{WithDestroyAfter(time.Hour)},
+			secret: deletedSecret(time.Now().Add(-2*time.Hour), deletedAt(2*time.Hour)),
+			want:   want{purged: true},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var destroyed []string
+			k := NewV2Client(&fake.LogicalClient{
+				ReadFn: func(path string) (*api.Secret, error) {
+					return tc.secret, nil
+				},
+				DeleteFn: func(path string) (*api.Secret, error) {
+					destroyed = append(destroyed, path)
+					return nil, nil
+				},
+			}, mountPath, tc.opts...)
+
+			purged, err := k.Purge(secretName)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nv2Client.Purge(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if purged != tc.want.purged {
+				t.Errorf("\n%s\nv2Client.Purge(...): want purged %t, got %t", tc.reason, tc.want.purged, purged)
+			}
+			var want []string
+			if tc.want.purged {
+				want = []string{filepath.Join(mountPath, "metadata", secretName)}
+			}
+			if diff := cmp.Diff(want, destroyed); diff != "" {
+				t.Errorf("\n%s\nv2Client.Purge(...): -want destroyed, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestV2ClientApplyRecreated(t *testing.T) {
+	// The secret was deleted with the DestroyAfter deletion policy.
+	var writes []map[string]any
+	k := NewV2Client(&fake.LogicalClient{
+		ReadFn: func(path string) (*api.Secret, error) {
+			return deletedSecret(time.Now().Add(-time.Minute), map[string]any{"foo": "bar", DeletedAtLabel: "2023-01-01T00:00:00Z"}), nil
+		},
+		WriteFn: func(path string, data map[string]any) (*api.Secret, error) {
+			writes = append(writes, map[string]any{"path": path, "payload": data})
+			return nil, nil
+		},
+	}, mountPath, WithDestroyAfter(time.Hour))
+
+	if err := k.Apply(secretName, NewSecret(map[string]string{"key": "new"}, map[string]string{"foo": "bar"})); err != nil {
+		t.Fatalf("v2Client.Apply(...): %v", err)
+	}
+	want := []map[string]any{
+		{
+			// The deletion time is removed so the secret is not purged.
+			"path": filepath.Join(mountPath, "metadata", secretName),
+			"payload": map[string]any{
+				"custom_metadata": map[string]string{"foo": "bar"},
+			},
+		},
+		{
+			"path": filepath.Join(mountPath, "data", secretName),
+			"payload": map[string]any{
+				"options": map[string]any{"cas": json.Number("2")},
+				"data":    map[string]string{"key": "new"},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, writes); diff != "" {
+		t.Errorf("v2Client.Apply(...): -want writes, +got:\n%s", diff)
+	}
+}
@@ -0,0 +1,180 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package kv
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/crossplane/crossplane-runtime/pkg/connection/store"
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/apis/config/v1alpha1"
+)
+
+const (
+	errLayoutEncode   = "cannot encode secret data as JSON"
+	errLayoutDecode   = "cannot decode secret data from JSON key %q"
+	errLayoutKey      = "key %q cannot be nested"
+	errLayoutConflict = "key %q conflicts with the keys nested under it"
+	errLayoutValue    = "value of nested key %q is neither a string nor an object"
+
+	// defaultLayoutKey is the key holding the JSON document of the JSON and
+	// Nested layouts if not configured otherwise.
+	defaultLayoutKey = "connection"
+)
+
+// A layout lays the data of a secret out in the data of a Vault secret, see
+// v1alpha1.VaultSecretLayout. The zero layout is flat.
+type layout struct {
+	mode v1alpha1.VaultSecretLayout
+	key  string
+}
+
+func newLayout(spec *v1alpha1.VaultConfigSpec) layout {
+	l := layout{mode: spec.Layout, key: spec.LayoutKey}
+	if l.key == "" {
+		l.key = defaultLayoutKey
+	}
+	return l
+}
+
+// packed returns true if the layout stores all keys under a single key.
+func (l layout) packed() bool {
+	return l.mode == v1alpha1.VaultSecretLayoutJSON || l.mode == v1alpha1.VaultSecretLayoutNested
+}
+
+// pack returns the data stored in Vault for the supplied data.
+func (l layout) pack(data map[string]string) (map[string]string, error) {
+	var doc any
+	switch l.mode {
+	case v1alpha1.VaultSecretLayoutJSON:
+		doc = data
+	case v1alpha1.VaultSecretLayoutNested:
+		n, err := nest(data)
+		if err != nil {
+			return nil, err
+		}
+		doc = n
+	default:
+		return data, nil
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	// Objects are encoded with sorted keys, so unchanged data is encoded
+	// identically and does not cause a write.
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return nil, errors.Wrap(err, errLayoutEncode)
+	}
+	return map[string]string{l.key: string(b)}, nil
+}
+
+// unpack returns the data of the supplied data read from Vault. Other keys
+// than the one of the JSON document are ignored.
+func (l layout) unpack(data map[string]string) (map[string]string, error) {
+	if !l.packed() {
+		return data, nil
+	}
+	v, ok := data[l.key]
+	if !ok {
+		return nil, nil
+	}
+	if l.mode == v1alpha1.VaultSecretLayoutJSON {
+		out := map[string]string{}
+		if err := json.Unmarshal([]byte(v), &out); err != nil {
+			return nil, errors.Wrapf(err, errLayoutDecode, l.key)
+		}
+		return out, nil
+	}
+	doc := map[string]any{}
+	if err := json.Unmarshal([]byte(v), &doc); err != nil {
+		return nil, errors.Wrapf(err, errLayoutDecode, l.key)
+	}
+	out := map[string]string{}
+	return out, flatten("", doc, out)
+}
+
+// nest returns the supplied data with dotted keys split into nested objects.
+func nest(data map[string]string) (map[string]any, error) {
+	doc := map[string]any{}
+	for k, v := range data {
+		segments := strings.Split(k, ".")
+		obj := doc
+		for i, s := range segments {
+			if s == "" {
+				return nil, errors.Errorf(errLayoutKey, k)
+			}
+			if i == len(segments)-1 {
+				if _, ok := obj[s]; ok {
+					return nil, errors.Errorf(errLayoutConflict, k)
+				}
+				obj[s] = v
+				break
+			}
+			switch child := obj[s].(type) {
+			case nil:
+				next := map[string]any{}
+				obj[s] = next
+				obj = next
+			case map[string]any:
+				obj = child
+			default:
+				return nil, errors.Errorf(errLayoutConflict, strings.Join(segments[:i+1], "."))
+			}
+		}
+	}
+	return doc, nil
+}
+
+// flatten adds the string values of the supplied nested object to the
+// supplied data, under the dotted keys of their path.
+func flatten(prefix string, obj map[string]any, data map[string]string) error {
+	for k, v := range obj {
+		key := prefix + k
+		switch val := v.(type) {
+		case string:
+			data[key] = val
+		case map[string]any:
+			if err := flatten(key+".", val, data); err != nil {
+				return err
+			}
+		default:
+			return errors.Errorf(errLayoutValue, key)
+		}
+	}
+	return nil
+}
+
+// keyValues returns the KeyValues of the supplied data read from Vault.
+func (ss *SecretStore) keyValues(data map[string]string) (store.KeyValues, error) {
+	d, err := ss.layout.unpack(data)
+	if err != nil {
+		return nil, err
+	}
+	return keyValuesFromData(d, ss.keys), nil
+}
+
+// data returns the data to store in Vault for the supplied KeyValues.
+func (ss *SecretStore) data(kv store.KeyValues) (map[string]string, error) {
+	d, err := dataFromKeyValues(kv, ss.keys)
+	if err != nil {
+		return nil, err
+	}
+	return ss.layout.pack(d)
+}
@@ -0,0 +1,160 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package kv
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane/crossplane-runtime/pkg/connection/store"
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/apis/config/v1alpha1"
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/vault/kv"
+)
+
+func TestLayout(t *testing.T) {
+	type want struct {
+		err     error
+		vault   map[string]string
+		read    store.KeyValues
+		deleted map[string]string
+	}
+	cases := map[string]struct {
+		reason string
+		spec   *v1alpha1.VaultConfigSpec
+		data   store.KeyValues
+		delete store.KeyValues
+		want   want
+	}{
+		"Flat": {
+			reason: "Every key should be stored as a key of the Vault secret by default.",
+			spec:   &v1alpha1.VaultConfigSpec{},
+			data:   store.KeyValues{"password": []byte("s3cr3t"), "attribute.id": []byte("42")},
+			delete: store.KeyValues{"password": nil},
+			want: want{
+				vault:   map[string]string{"password": "s3cr3t", "attribute.id": "42"},
+				read:    store.KeyValues{"password": []byte("s3cr3t"), "attribute.id": []byte("42")},
+				deleted: map[string]string{"attribute.id": "42"},
+			},
+		},
+		"JSON": {
+			reason: "All keys should be stored in a JSON object under a single key, and unpacked when read.",
+			spec:   &v1alpha1.VaultConfigSpec{Layout: v1alpha1.VaultSecretLayoutJSON},
+			data:   store.KeyValues{"password": []byte("s3cr3t"), "attribute.id": []byte("42")},
+			delete: store.KeyValues{"password": nil},
+			want: want{
+				vault:   map[string]string{"connection": `{"attribute.id":"42","password":"s3cr3t"}`},
+				read:    store.KeyValues{"password": []byte("s3cr3t"), "attribute.id": []byte("42")},
+				deleted: map[string]string{"connection": `{"attribute.id":"42"}`},
+			},
+		},
+		"Nested": {
+			reason: "Dotted keys should be split into nested objects under the configured key, and flattened when read.",
+			spec:   &v1alpha1.VaultConfigSpec{Layout: v1alpha1.VaultSecretLayoutNested, LayoutKey: "data"},
+			data:   store.KeyValues{"password": []byte("s3cr3t"), "attribute.id": []byte("42"), "attribute.arn": []byte("arn")},
+			delete: store.KeyValues{"attribute.id": nil},
+			want: want{
+				vault:   map[string]string{"data": `{"attribute":{"arn":"arn","id":"42"},"password":"s3cr3t"}`},
+				read:    store.KeyValues{"password": []byte("s3cr3t"), "attribute.id": []byte("42"), "attribute.arn": []byte("arn")},
+				deleted: map[string]string{"data": `{"attribute":{"arn":"arn"},"password":"s3cr3t"}`},
+			},
+		},
+		"NestedConflict": {
+			reason: "A key that is also the prefix of a dotted key cannot be nested.",
+			spec:   &v1alpha1.VaultConfigSpec{Layout: v1alpha1.VaultSecretLayoutNested},
+			data:   store.KeyValues{"attribute": []byte("x"), "attribute.id": []byte("42")},
+			want: want{
+				err: errors.Wrap(errors.Errorf(errLayoutConflict, "attribute"), errApply),
+			},
+		},
+		"NestedEmptySegment": {
+			reason: "A key with an empty segment cannot be nested.",
+			spec:   &v1alpha1.VaultConfigSpec{Layout: v1alpha1.VaultSecretLayoutNested},
+			data:   store.KeyValues{"attribute..id": []byte("42")},
+			want: want{
+				err: errors.Wrap(errors.Errorf(errLayoutKey, "attribute..id"), errApply),
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			secrets := map[string]*kv.Secret{}
+			ss := &SecretStore{client: memKV(secrets), layout: newLayout(tc.spec)}
+			n := store.ScopedName{Scope: "ns", Name: "conn"}
+
+			_, err := ss.WriteKeyValues(context.Background(), &store.Secret{ScopedName: n, Data: tc.data})
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nss.WriteKeyValues(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tc.want.vault, secrets["ns/conn"].Data); diff != "" {
+				t.Errorf("\n%s\nss.WriteKeyValues(...): -want Vault data, +got:\n%s", tc.reason, diff)
+			}
+
+			got := &store.Secret{}
+			if err := ss.ReadKeyValues(context.Background(), n, got); err != nil {
+				t.Fatalf("\n%s\nss.ReadKeyValues(...): %v", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want.read, got.Data); diff != "" {
+				t.Errorf("\n%s\nss.ReadKeyValues(...): -want, +got:\n%s", tc.reason, diff)
+			}
+
+			if err := ss.DeleteKeyValues(context.Background(), &store.Secret{ScopedName: n, Data: tc.delete}); err != nil {
+				t.Fatalf("\n%s\nss.DeleteKeyValues(...): %v", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want.deleted, secrets["ns/conn"].Data); diff != "" {
+				t.Errorf("\n%s\nss.DeleteKeyValues(...): -want Vault data, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestLayoutUnpack(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		layout layout
+		data   map[string]string
+		want   error
+	}{
+		"NotJSON": {
+			reason: "A value that is not a JSON object should not be decoded.",
+			layout: layout{mode: v1alpha1.VaultSecretLayoutJSON, key: defaultLayoutKey},
+			data:   map[string]string{defaultLayoutKey: "s3cr3t"},
+			want:   errors.Wrapf(errors.New("invalid character 's' looking for beginning of value"), errLayoutDecode, defaultLayoutKey),
+		},
+		"NotString": {
+			reason: "Nested values that are neither strings nor objects should not be flattened.",
+			layout: layout{mode: v1alpha1.VaultSecretLayoutNested, key: defaultLayoutKey},
+			data:   map[string]string{defaultLayoutKey: `{"attribute":{"port":5432}}`},
+			want:   errors.Errorf(errLayoutValue, "attribute.port"),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := tc.layout.unpack(tc.data)
+			if diff := cmp.Diff(tc.want, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nl.unpack(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
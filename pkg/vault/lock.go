@@ -0,0 +1,89 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package kv
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+)
+
+const errLockPath = "cannot lock secret path"
+
+// A PathLocker serializes mutations of the same secret path of a VaultConfig
+// within a replica of the plugin.
+type PathLocker struct {
+	mu    sync.Mutex
+	locks map[string]*pathLock
+}
+
+type pathLock struct {
+	// ch holds a token while the lock is held, which allows waiting for the
+	// lock to be released or the context to be done, whichever comes first.
+	ch   chan struct{}
+	refs int
+}
+
+// NewPathLocker returns a new PathLocker.
+func NewPathLocker() *PathLocker {
+	return &PathLocker{locks: map[string]*pathLock{}}
+}
+
+// Lock blocks until the supplied path of the supplied config is locked or the
+// context is done. The returned function must be called to unlock the path.
+func (l *PathLocker) Lock(ctx context.Context, config, path string) (unlock func(), err error) {
+	key := config + "/" + path
+
+	l.mu.Lock()
+	pl, ok := l.locks[key]
+	if !ok {
+		pl = &pathLock{ch: make(chan struct{}, 1)}
+		l.locks[key] = pl
+	}
+	pl.refs++
+	l.mu.Unlock()
+
+	select {
+	case pl.ch <- struct{}{}:
+	default:
+		pathLockContended.WithLabelValues(config).Inc()
+		start := time.Now()
+		select {
+		case pl.ch <- struct{}{}:
+			pathLockWaitSeconds.WithLabelValues(config).Observe(time.Since(start).Seconds())
+		case <-ctx.Done():
+			l.release(key, pl)
+			return nil, errors.Wrap(ctx.Err(), errLockPath)
+		}
+	}
+
+	return func() {
+		<-pl.ch
+		l.release(key, pl)
+	}, nil
+}
+
+func (l *PathLocker) release(key string, pl *pathLock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	pl.refs--
+	if pl.refs == 0 {
+		delete(l.locks, key)
+	}
+}
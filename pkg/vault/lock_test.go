@@ -0,0 +1,67 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package kv
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPathLocker(t *testing.T) {
+	l := NewPathLocker()
+
+	unlock, err := l.Lock(context.Background(), "cfg", "scope/name")
+	if err != nil {
+		t.Fatalf("l.Lock(...): unexpected error: %v", err)
+	}
+
+	// A different path of the same config must not be blocked.
+	other, err := l.Lock(context.Background(), "cfg", "scope/other")
+	if err != nil {
+		t.Fatalf("l.Lock(...): unexpected error locking a different path: %v", err)
+	}
+	other()
+
+	// The same path must be blocked until the context is done.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := l.Lock(ctx, "cfg", "scope/name"); err == nil {
+		t.Fatal("l.Lock(...): expected an error locking a locked path")
+	}
+
+	// The same path must be acquired once unlocked.
+	acquired := make(chan func())
+	go func() {
+		u, err := l.Lock(context.Background(), "cfg", "scope/name")
+		if err != nil {
+			t.Errorf("l.Lock(...): unexpected error: %v", err)
+		}
+		acquired <- u
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("l.Lock(...): acquired a locked path")
+	case <-time.After(10 * time.Millisecond):
+	}
+	unlock()
+	(<-acquired)()
+
+	if len(l.locks) != 0 {
+		t.Errorf("l.locks: want no locks left, got %d", len(l.locks))
+	}
+}
@@ -0,0 +1,99 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package kv
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const metricsNamespace = "ess_plugin_vault"
+
+var (
+	pathLockContended = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "path_lock_contended_total",
+		Help:      "Number of secret mutations that had to wait for another mutation of the same path.",
+	}, []string{"config"})
+
+	pathLockWaitSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "path_lock_wait_seconds",
+		Help:      "Time secret mutations spent waiting for another mutation of the same path.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 12),
+	}, []string{"config"})
+
+	gcOrphanedSecrets = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "gc_orphaned_secrets",
+		Help:      "Number of orphaned secrets left after the last garbage collection.",
+	}, []string{"config"})
+
+	gcDeletedSecrets = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "gc_deleted_secrets_total",
+		Help:      "Number of orphaned secrets deleted by garbage collection.",
+	}, []string{"config"})
+
+	purgedSecrets = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "purged_secrets_total",
+		Help:      "Number of soft deleted secrets permanently deleted after their retention period.",
+	}, []string{"config"})
+
+	serverUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "server_up",
+		Help:      "Whether a server of a config with multiple servers is active or a standby, as of its last health check or request.",
+	}, []string{"config", "server"})
+
+	serverSelected = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "server_selected",
+		Help:      "Whether a server of a config with multiple servers is the one requests are sent to.",
+	}, []string{"config", "server"})
+
+	serverFailovers = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "server_failovers_total",
+		Help:      "Number of times the selected server of a config with multiple servers changed.",
+	}, []string{"config"})
+
+	mirrorFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "mirror_failures_total",
+		Help:      "Number of writes and deletions that could not be mirrored to the mirror of a config.",
+	}, []string{"config", "operation"})
+
+	mirrorReadFallbacks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "mirror_read_fallbacks_total",
+		Help:      "Number of reads that fell back to the mirror of a config.",
+	}, []string{"config"})
+
+	readCacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "read_cache_requests_total",
+		Help:      "Number of secret reads through the read cache, by whether they were a hit, a miss, or coalesced with a concurrent miss.",
+	}, []string{"config", "result"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(pathLockContended, pathLockWaitSeconds, gcOrphanedSecrets, gcDeletedSecrets, purgedSecrets,
+		serverUp, serverSelected, serverFailovers, mirrorFailures, mirrorReadFallbacks,
+		readCacheRequests)
+}
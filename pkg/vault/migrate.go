@@ -0,0 +1,275 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package kv
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/vault/kv"
+)
+
+const (
+	errGetSource       = "cannot get source secret %q"
+	errApplyTarget     = "cannot apply target secret %q"
+	errGetTarget       = "cannot get target secret %q"
+	errVerifyTarget    = "target secret %q does not match the source secret"
+	errDeleteSource    = "cannot delete source secret %q"
+	errCheckpoint      = "cannot record checkpoint of secret %q"
+	errOpenCheckpoint  = "cannot open checkpoint file"
+	errReadCheckpoint  = "cannot read checkpoint file"
+	errWriteCheckpoint = "cannot write checkpoint file"
+)
+
+// A Checkpoint records the secrets that were migrated, so that an interrupted
+// migration can be resumed. Secrets are recorded by a key that identifies
+// their path as well as the source and target config of the migration, so
+// that a checkpoint cannot skip secrets of another migration.
+type Checkpoint interface {
+	// Done returns true if the secret with the supplied key was migrated.
+	Done(key string) bool
+	// Add records that the secret with the supplied key was migrated.
+	Add(key string) error
+}
+
+// A FileCheckpoint is a Checkpoint that records one key per line of a file.
+type FileCheckpoint struct {
+	f    *os.File
+	done map[string]bool
+}
+
+// NewFileCheckpoint returns a Checkpoint recorded in the supplied file, which
+// is created if it does not exist. It must be closed after the migration.
+func NewFileCheckpoint(path string) (*FileCheckpoint, error) {
+	f, err := os.OpenFile(filepath.Clean(path), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, errOpenCheckpoint)
+	}
+	c := &FileCheckpoint{f: f, done: map[string]bool{}}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if l := strings.TrimSpace(s.Text()); l != "" {
+			c.done[l] = true
+		}
+	}
+	if err := s.Err(); err != nil {
+		_ = f.Close()
+		return nil, errors.Wrap(err, errReadCheckpoint)
+	}
+	return c, nil
+}
+
+// Done returns true if the secret with the supplied key was migrated.
+func (c *FileCheckpoint) Done(key string) bool {
+	return c.done[key]
+}
+
+// Add records that the secret with the supplied key was migrated.
+func (c *FileCheckpoint) Add(key string) error {
+	if _, err := c.f.WriteString(key + "\n"); err != nil {
+		return errors.Wrap(err, errWriteCheckpoint)
+	}
+	c.done[key] = true
+	return errors.Wrap(c.f.Sync(), errWriteCheckpoint)
+}
+
+// Close closes the checkpoint file.
+func (c *FileCheckpoint) Close() error {
+	return c.f.Close()
+}
+
+// A MigrationResult reports the secrets of a migration.
+type MigrationResult struct {
+	// Migrated are the paths of the secrets that were migrated, or would have
+	// been in a dry run.
+	Migrated []string
+	// Skipped are the paths of the secrets that were skipped, because a
+	// previous run migrated them according to the checkpoint.
+	Skipped []string
+}
+
+// A Migrator copies secrets from the store of one Vault config to the store of
+// another, e.g. from a KV v1 to a KV v2 mount, or to another Vault cluster.
+// Secrets are copied as stored, including their custom metadata, which the KV
+// clients translate between the "metadata:" prefixed keys of KV v1 and the
+// custom_metadata of KV v2. Values encrypted with Vault Transit stay encrypted
+// with the key of the source config.
+type Migrator struct {
+	source *SecretStore
+	target *SecretStore
+
+	dryRun       bool
+	deleteSource bool
+	checkpoint   Checkpoint
+	logger       logging.Logger
+}
+
+// A MigratorOption configures a Migrator.
+type MigratorOption func(*Migrator)
+
+// WithDryRun configures the Migrator to only report the secrets it would
+// migrate, without writing or deleting anything.
+func WithDryRun() MigratorOption {
+	return func(m *Migrator) {
+		m.dryRun = true
+	}
+}
+
+// WithDeleteSource configures the Migrator to delete every source secret once
+// its copy is verified.
+func WithDeleteSource() MigratorOption {
+	return func(m *Migrator) {
+		m.deleteSource = true
+	}
+}
+
+// WithCheckpoint configures the Migrator to skip the secrets recorded in the
+// supplied Checkpoint, and to record the secrets it migrates.
+func WithCheckpoint(c Checkpoint) MigratorOption {
+	return func(m *Migrator) {
+		m.checkpoint = c
+	}
+}
+
+// WithMigrationLogger configures the logger of the Migrator.
+func WithMigrationLogger(l logging.Logger) MigratorOption {
+	return func(m *Migrator) {
+		m.logger = l
+	}
+}
+
+// NewMigrator returns a Migrator that copies secrets from the source to the
+// target store.
+func NewMigrator(source, target *SecretStore, opts ...MigratorOption) *Migrator {
+	m := &Migrator{source: source, target: target, logger: logging.NewNopLogger()}
+	for _, o := range opts {
+		o(m)
+	}
+	return m
+}
+
+// Migrate migrates all secrets under the supplied prefix, which is relative to
+// the mount path, to the same paths of the target store. It stops at the first
+// secret that cannot be migrated; with a Checkpoint, running it again resumes
+// after the secrets that were migrated.
+func (m *Migrator) Migrate(ctx context.Context, prefix string) (*MigrationResult, error) {
+	paths, err := m.source.walk(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &MigrationResult{}
+	for _, p := range paths {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		if m.checkpoint != nil && m.checkpoint.Done(m.checkpointKey(p)) {
+			res.Skipped = append(res.Skipped, p)
+			continue
+		}
+		migrated, err := m.migrate(ctx, p)
+		if err != nil {
+			return res, err
+		}
+		if migrated {
+			res.Migrated = append(res.Migrated, p)
+		}
+	}
+	return res, nil
+}
+
+// migrate migrates the secret at the supplied path, and returns false if it
+// no longer exists.
+func (m *Migrator) migrate(ctx context.Context, path string) (bool, error) {
+	s := &kv.Secret{}
+	err := m.source.client.Get(path, s)
+	if kv.IsNotFound(err) {
+		// Deleted since it was listed.
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, errGetSource, path)
+	}
+
+	log := m.logger.WithValues("path", path)
+	if m.dryRun {
+		log.Info("Would migrate secret", "keys", len(s.Data), "deleteSource", m.deleteSource)
+		return true, nil
+	}
+
+	if err := m.copy(ctx, path, s); err != nil {
+		return false, err
+	}
+	if m.deleteSource {
+		if err := m.source.client.Delete(path); err != nil {
+			return false, errors.Wrapf(err, errDeleteSource, path)
+		}
+	}
+	if m.checkpoint != nil {
+		if err := m.checkpoint.Add(m.checkpointKey(path)); err != nil {
+			return false, errors.Wrapf(err, errCheckpoint, path)
+		}
+	}
+	log.Info("Migrated secret", "keys", len(s.Data), "deletedSource", m.deleteSource)
+	return true, nil
+}
+
+// checkpointKey returns the checkpoint key of the secret at the supplied path,
+// i.e. the source config, target config and path separated by tabs, which
+// neither config names nor secret paths contain.
+func (m *Migrator) checkpointKey(path string) string {
+	return strings.Join([]string{m.source.config, m.target.config, path}, "\t")
+}
+
+// copy writes the supplied secret to the target store and verifies it.
+func (m *Migrator) copy(ctx context.Context, path string, s *kv.Secret) error {
+	unlock, err := m.target.lockPath(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := m.target.client.Apply(path, s); err != nil {
+		return errors.Wrapf(err, errApplyTarget, path)
+	}
+	got := &kv.Secret{}
+	if err := m.target.client.Get(path, got); err != nil {
+		return errors.Wrapf(err, errGetTarget, path)
+	}
+	if !equalMaps(s.Data, got.Data) || !equalMaps(s.CustomMeta, got.CustomMeta) {
+		return errors.Errorf(errVerifyTarget, path)
+	}
+	return nil
+}
+
+func equalMaps(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,255 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package kv
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/vault/fake"
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/vault/kv"
+)
+
+// memKV returns a fake KVClient backed by the supplied map.
+func memKV(secrets map[string]*kv.Secret) *fake.KVClient {
+	return &fake.KVClient{
+		GetFn: func(path string, secret *kv.Secret) error {
+			s, ok := secrets[path]
+			if !ok {
+				return kv.ErrNotFound
+			}
+			*secret = *kv.NewSecret(s.Data, s.CustomMeta)
+			return nil
+		},
+		ApplyFn: func(path string, secret *kv.Secret, ao ...kv.ApplyOption) error {
+			s, ok := secrets[path]
+			if !ok {
+				s = kv.NewSecret(nil, nil)
+				secrets[path] = s
+			} else {
+				// Like the KV clients, options only apply to updates.
+				for _, o := range ao {
+					if err := o(kv.NewSecret(s.Data, s.CustomMeta), secret); err != nil {
+						return err
+					}
+				}
+			}
+			for k, v := range secret.Data {
+				s.AddData(k, v)
+			}
+			s.CustomMeta = secret.CustomMeta
+			return nil
+		},
+		DeleteFn: func(path string) error {
+			delete(secrets, path)
+			return nil
+		},
+		ListFn: func(path string) ([]string, error) {
+			seen := map[string]bool{}
+			for p := range secrets {
+				rel := p
+				if path != "" {
+					if !strings.HasPrefix(p, path+"/") {
+						continue
+					}
+					rel = strings.TrimPrefix(p, path+"/")
+				}
+				if dir, _, found := strings.Cut(rel, "/"); found {
+					seen[dir+"/"] = true
+					continue
+				}
+				seen[rel] = true
+			}
+			keys := make([]string, 0, len(seen))
+			for k := range seen {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			return keys, nil
+		},
+	}
+}
+
+type memCheckpoint map[string]bool
+
+func (c memCheckpoint) Done(key string) bool { return c[key] }
+func (c memCheckpoint) Add(key string) error { c[key] = true; return nil }
+
+func TestMigrate(t *testing.T) {
+	secrets := func() map[string]*kv.Secret {
+		return map[string]*kv.Secret{
+			"ns-a/db":       kv.NewSecret(map[string]string{"password": "s3cr3t"}, map[string]string{"owner": "a"}),
+			"ns-a/cache":    kv.NewSecret(map[string]string{"token": "t0k3n"}, nil),
+			"ns-b/nested/x": kv.NewSecret(map[string]string{"key": "value"}, nil),
+		}
+	}
+	type want struct {
+		res    *MigrationResult
+		source []string
+		target []string
+		err    error
+	}
+	cases := map[string]struct {
+		reason     string
+		prefix     string
+		opts       []MigratorOption
+		target     map[string]*kv.Secret
+		checkpoint memCheckpoint
+		want       want
+	}{
+		"All": {
+			reason: "Should copy all secrets under the prefix, recursively.",
+			want: want{
+				res:    &MigrationResult{Migrated: []string{"ns-a/cache", "ns-a/db", "ns-b/nested/x"}},
+				source: []string{"ns-a/cache", "ns-a/db", "ns-b/nested/x"},
+				target: []string{"ns-a/cache", "ns-a/db", "ns-b/nested/x"},
+			},
+		},
+		"Prefix": {
+			reason: "Should only copy secrets under the prefix.",
+			prefix: "/ns-a/",
+			want: want{
+				res:    &MigrationResult{Migrated: []string{"ns-a/cache", "ns-a/db"}},
+				source: []string{"ns-a/cache", "ns-a/db", "ns-b/nested/x"},
+				target: []string{"ns-a/cache", "ns-a/db"},
+			},
+		},
+		"DryRun": {
+			reason: "Should not write or delete anything in a dry run.",
+			opts:   []MigratorOption{WithDryRun(), WithDeleteSource()},
+			want: want{
+				res:    &MigrationResult{Migrated: []string{"ns-a/cache", "ns-a/db", "ns-b/nested/x"}},
+				source: []string{"ns-a/cache", "ns-a/db", "ns-b/nested/x"},
+			},
+		},
+		"DeleteSource": {
+			reason: "Should delete source secrets after copying them.",
+			prefix: "ns-b",
+			opts:   []MigratorOption{WithDeleteSource()},
+			want: want{
+				res:    &MigrationResult{Migrated: []string{"ns-b/nested/x"}},
+				source: []string{"ns-a/cache", "ns-a/db"},
+				target: []string{"ns-b/nested/x"},
+			},
+		},
+		"Resume": {
+			reason:     "Should skip secrets recorded in the checkpoint.",
+			checkpoint: memCheckpoint{"src\tdst\tns-a/cache": true},
+			want: want{
+				res:    &MigrationResult{Migrated: []string{"ns-a/db", "ns-b/nested/x"}, Skipped: []string{"ns-a/cache"}},
+				source: []string{"ns-a/cache", "ns-a/db", "ns-b/nested/x"},
+				target: []string{"ns-a/db", "ns-b/nested/x"},
+			},
+		},
+		"ResumeOtherConfigs": {
+			reason:     "Should not skip secrets recorded in the checkpoint by a migration between other configs.",
+			checkpoint: memCheckpoint{"src\tother\tns-a/cache": true, "other\tdst\tns-a/db": true},
+			want: want{
+				res:    &MigrationResult{Migrated: []string{"ns-a/cache", "ns-a/db", "ns-b/nested/x"}},
+				source: []string{"ns-a/cache", "ns-a/db", "ns-b/nested/x"},
+				target: []string{"ns-a/cache", "ns-a/db", "ns-b/nested/x"},
+			},
+		},
+		"VerifyFailed": {
+			reason: "Should stop at a target secret that does not match its source.",
+			prefix: "ns-a",
+			opts:   []MigratorOption{WithDeleteSource()},
+			target: map[string]*kv.Secret{"ns-a/cache": kv.NewSecret(map[string]string{"other": "value"}, nil)},
+			want: want{
+				res:    &MigrationResult{},
+				source: []string{"ns-a/cache", "ns-a/db", "ns-b/nested/x"},
+				target: []string{"ns-a/cache"},
+				err:    errors.Errorf(errVerifyTarget, "ns-a/cache"),
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			src := secrets()
+			dst := tc.target
+			if dst == nil {
+				dst = map[string]*kv.Secret{}
+			}
+			opts := tc.opts
+			if tc.checkpoint != nil {
+				opts = append(opts, WithCheckpoint(tc.checkpoint))
+			}
+			m := NewMigrator(&SecretStore{client: memKV(src), config: "src"}, &SecretStore{client: memKV(dst), config: "dst"}, opts...)
+
+			res, err := m.Migrate(context.Background(), tc.prefix)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nm.Migrate(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.res, res); diff != "" {
+				t.Errorf("\n%s\nm.Migrate(...): -want result, +got result:\n%s", tc.reason, diff)
+			}
+			keys := func(m map[string]*kv.Secret) []string {
+				var out []string
+				for k := range m {
+					out = append(out, k)
+				}
+				return out
+			}
+			if diff := cmp.Diff(tc.want.source, keys(src), sortStrings); diff != "" {
+				t.Errorf("\n%s\nm.Migrate(...): -want source, +got source:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.target, keys(dst), sortStrings); diff != "" {
+				t.Errorf("\n%s\nm.Migrate(...): -want target, +got target:\n%s", tc.reason, diff)
+			}
+			if tc.want.err != nil {
+				return
+			}
+			want := secrets()
+			for _, p := range tc.want.target {
+				if !equalMaps(want[p].Data, dst[p].Data) || !equalMaps(want[p].CustomMeta, dst[p].CustomMeta) {
+					t.Errorf("\n%s\nm.Migrate(...): target %q differs from source", tc.reason, p)
+				}
+			}
+		})
+	}
+}
+
+func TestFileCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint")
+	c, err := NewFileCheckpoint(path)
+	if err != nil {
+		t.Fatalf("NewFileCheckpoint(...): %v", err)
+	}
+	if err := c.Add("ns/a"); err != nil {
+		t.Fatalf("c.Add(...): %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("c.Close(): %v", err)
+	}
+
+	c, err = NewFileCheckpoint(path)
+	if err != nil {
+		t.Fatalf("NewFileCheckpoint(...): %v", err)
+	}
+	defer c.Close() //nolint:errcheck // Only read in the test.
+	if !c.Done("ns/a") || c.Done("ns/b") {
+		t.Errorf("NewFileCheckpoint(...): want only ns/a done after reopening")
+	}
+}
@@ -0,0 +1,109 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package kv
+
+import (
+	"context"
+
+	"github.com/crossplane/crossplane-runtime/pkg/connection/store"
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/apis/config/v1alpha1"
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/vault/kv"
+)
+
+const (
+	errNoMirror     = "mirror configured but no mirror store provided"
+	errMirror       = "cannot mirror secret to config %q"
+	errMirrorRead   = "cannot read secret from mirror config %q"
+	errMirrorFailed = "cannot mirror secret"
+)
+
+// WithMirror configures the SecretStore to mirror writes and deletions to the
+// supplied SecretStore, according to the mirror settings of its config, which
+// requires this option.
+func WithMirror(m *SecretStore) StoreOption {
+	return func(ss *SecretStore) {
+		ss.mirror = m
+	}
+}
+
+// mirrorWrite applies a write that was applied to the primary config to the
+// mirror, if any. The mirror is written after the path of the primary is
+// unlocked, so that configs mirroring to each other cannot deadlock.
+func (ss *SecretStore) mirrorWrite(ctx context.Context, s *store.Secret, wo ...store.WriteOption) error {
+	if ss.mirror == nil {
+		return nil
+	}
+	_, err := ss.mirror.writeKeyValues(ctx, s, wo...)
+	return ss.mirrorResult("write", s.ScopedName, err)
+}
+
+// mirrorDelete applies a deletion that was applied to the primary config to
+// the mirror, if any.
+func (ss *SecretStore) mirrorDelete(ctx context.Context, s *store.Secret, do ...store.DeleteOption) error {
+	if ss.mirror == nil {
+		return nil
+	}
+	return ss.mirrorResult("delete", s.ScopedName, ss.mirror.deleteKeyValues(ctx, s, do...))
+}
+
+// mirrorResult returns the supplied error of mirroring an operation if the
+// mirror policy is strict. Otherwise, it is only logged and counted.
+func (ss *SecretStore) mirrorResult(op string, n store.ScopedName, err error) error {
+	if err == nil {
+		return nil
+	}
+	mirrorFailures.WithLabelValues(ss.config, op).Inc()
+	err = errors.Wrapf(err, errMirror, ss.mirror.config)
+	if ss.mirrorPolicy == v1alpha1.VaultMirrorStrict {
+		return err
+	}
+	ss.logger.Info(errMirrorFailed, "config", ss.config, "operation", op, "scope", n.Scope, "name", n.Name, "error", err)
+	return nil
+}
+
+// readMirror reads a secret from the mirror, after reading it from the primary
+// config returned the supplied error, or found no secret. If the mirror cannot
+// be read either, the error of the primary takes precedence.
+func (ss *SecretStore) readMirror(ctx context.Context, n store.ScopedName, s *store.Secret, primary error) error {
+	mirrorReadFallbacks.WithLabelValues(ss.config).Inc()
+	*s = store.Secret{}
+	if err := ss.mirror.ReadKeyValues(ctx, n, s); err != nil {
+		if primary != nil {
+			return primary
+		}
+		return errors.Wrapf(err, errMirrorRead, ss.mirror.config)
+	}
+	return nil
+}
+
+// shouldFallback returns true if a read that returned the supplied secret and
+// error should fall back to the mirror, i.e. if the secret was not found or
+// the server is unavailable.
+func shouldFallback(s *store.Secret, err error) bool {
+	if err == nil {
+		return len(s.Data) == 0 && s.Metadata == nil
+	}
+	return isUnavailable(err)
+}
+
+// isUnavailable returns true if the supplied error indicates that the Vault
+// server could not be reached, or could not serve the request.
+func isUnavailable(err error) bool {
+	return kv.ReasonOf(err) == kv.ReasonUnavailable
+}
@@ -0,0 +1,194 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package kv
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/vault/api"
+
+	"github.com/crossplane/crossplane-runtime/pkg/connection/store"
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/apis/config/v1alpha1"
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/vault/fake"
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/vault/kv"
+)
+
+func TestMirror(t *testing.T) {
+	n := store.ScopedName{Scope: "ns", Name: "conn"}
+	failing := &fake.KVClient{
+		GetFn:    func(_ string, _ *kv.Secret) error { return errBoom },
+		ApplyFn:  func(_ string, _ *kv.Secret, _ ...kv.ApplyOption) error { return errBoom },
+		DeleteFn: func(_ string) error { return errBoom },
+	}
+
+	type want struct {
+		err     error
+		primary []string
+		mirror  []string
+	}
+	cases := map[string]struct {
+		reason string
+		policy v1alpha1.VaultMirrorPolicy
+		mirror KVClient
+		delete bool
+		want   want
+	}{
+		"Write": {
+			reason: "Should write the secret to the primary and the mirror.",
+			want:   want{primary: []string{"ns/conn"}, mirror: []string{"ns/conn"}},
+		},
+		"WriteBestEffort": {
+			reason: "Should not fail a write that could not be mirrored with the BestEffort policy.",
+			policy: v1alpha1.VaultMirrorBestEffort,
+			mirror: failing,
+			want:   want{primary: []string{"ns/conn"}},
+		},
+		"WriteStrict": {
+			reason: "Should fail a write that could not be mirrored with the Strict policy, after writing the primary.",
+			policy: v1alpha1.VaultMirrorStrict,
+			mirror: failing,
+			want: want{
+				err:     errors.Wrapf(errors.Wrap(errBoom, errApply), errMirror, "mirror"),
+				primary: []string{"ns/conn"},
+			},
+		},
+		"Delete": {
+			reason: "Should delete the secret from the primary and the mirror.",
+			delete: true,
+		},
+		"DeleteStrict": {
+			reason: "Should fail a deletion that could not be mirrored with the Strict policy.",
+			policy: v1alpha1.VaultMirrorStrict,
+			mirror: failing,
+			delete: true,
+			want: want{
+				err: errors.Wrapf(errors.Wrap(errBoom, errGet), errMirror, "mirror"),
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			primary := map[string]*kv.Secret{}
+			mirror := map[string]*kv.Secret{}
+			if tc.delete {
+				primary["ns/conn"] = kv.NewSecret(map[string]string{"a": "b"}, nil)
+				mirror["ns/conn"] = kv.NewSecret(map[string]string{"a": "b"}, nil)
+			}
+			m := &SecretStore{client: memKV(mirror), config: "mirror"}
+			if tc.mirror != nil {
+				m.client = tc.mirror
+			}
+			ss := &SecretStore{client: memKV(primary), config: "primary", mirror: m, mirrorPolicy: tc.policy, logger: logging.NewNopLogger()}
+
+			s := &store.Secret{ScopedName: n, Data: store.KeyValues{"a": []byte("b")}}
+			var err error
+			if tc.delete {
+				err = ss.DeleteKeyValues(context.Background(), &store.Secret{ScopedName: n})
+			} else {
+				_, err = ss.WriteKeyValues(context.Background(), s)
+			}
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nss.%s(...): -want error, +got error:\n%s", tc.reason, name, diff)
+			}
+			keys := func(m map[string]*kv.Secret) []string {
+				var out []string
+				for k := range m {
+					out = append(out, k)
+				}
+				return out
+			}
+			if diff := cmp.Diff(tc.want.primary, keys(primary), sortStrings); diff != "" {
+				t.Errorf("\n%s\nss.%s(...): -want primary, +got primary:\n%s", tc.reason, name, diff)
+			}
+			if tc.mirror == nil {
+				if diff := cmp.Diff(tc.want.mirror, keys(mirror), sortStrings); diff != "" {
+					t.Errorf("\n%s\nss.%s(...): -want mirror, +got mirror:\n%s", tc.reason, name, diff)
+				}
+			}
+		})
+	}
+}
+
+func TestReadFallback(t *testing.T) {
+	n := store.ScopedName{Scope: "ns", Name: "conn"}
+	errDenied := &api.ResponseError{StatusCode: 403}
+	errSealed := &api.ResponseError{StatusCode: 503}
+	getErr := func(err error) *fake.KVClient {
+		return &fake.KVClient{GetFn: func(_ string, _ *kv.Secret) error { return err }}
+	}
+
+	type want struct {
+		err  error
+		data store.KeyValues
+	}
+	cases := map[string]struct {
+		reason   string
+		primary  KVClient
+		fallback bool
+		want     want
+	}{
+		"Primary": {
+			reason:   "Should read secrets that exist in the primary from the primary.",
+			primary:  memKV(map[string]*kv.Secret{"ns/conn": kv.NewSecret(map[string]string{"from": "primary"}, nil)}),
+			fallback: true,
+			want:     want{data: store.KeyValues{"from": []byte("primary")}},
+		},
+		"NotFound": {
+			reason:   "Should read secrets that do not exist in the primary from the mirror.",
+			primary:  memKV(map[string]*kv.Secret{}),
+			fallback: true,
+			want:     want{data: store.KeyValues{"from": []byte("mirror")}},
+		},
+		"Unavailable": {
+			reason:   "Should read secrets from the mirror if the primary is unavailable.",
+			primary:  getErr(errSealed),
+			fallback: true,
+			want:     want{data: store.KeyValues{"from": []byte("mirror")}},
+		},
+		"Denied": {
+			reason:   "Should not read secrets from the mirror if the primary denied the read.",
+			primary:  getErr(errDenied),
+			fallback: true,
+			want:     want{err: errors.Wrap(errDenied, errGet)},
+		},
+		"FallbackDisabled": {
+			reason:  "Should not read secrets from the mirror unless configured.",
+			primary: memKV(map[string]*kv.Secret{}),
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			m := &SecretStore{client: memKV(map[string]*kv.Secret{"ns/conn": kv.NewSecret(map[string]string{"from": "mirror"}, nil)}), config: "mirror"}
+			ss := &SecretStore{client: tc.primary, config: "primary", mirror: m, readFallback: tc.fallback}
+
+			s := &store.Secret{}
+			err := ss.ReadKeyValues(context.Background(), n, s)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nss.ReadKeyValues(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.data, s.Data); diff != "" {
+				t.Errorf("\n%s\nss.ReadKeyValues(...): -want data, +got data:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package kv
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+)
+
+const (
+	errPurge = "cannot purge secret %q"
+)
+
+// A purger permanently deletes soft deleted secrets whose retention period
+// elapsed.
+type purger interface {
+	Purge(path string) (bool, error)
+}
+
+// Purge permanently deletes the secrets under the supplied prefix, which is
+// relative to the mount paths, that were soft deleted with the DestroyAfter
+// deletion policy and whose retention period elapsed. The mounts of all routes
+// are purged. It returns the paths of the purged secrets, qualified with their
+// mount. Nothing is purged with other deletion policies.
+func (ss *SecretStore) Purge(ctx context.Context, prefix string) ([]string, error) {
+	var purged []string
+	defer func() {
+		purgedSecrets.WithLabelValues(ss.config).Add(float64(len(purged)))
+	}()
+	for _, r := range ss.mountRoutes() {
+		p, ok := r.client.(purger)
+		if !ok {
+			continue
+		}
+		paths, err := walkPaths(r.client, prefix)
+		if err != nil {
+			return purged, err
+		}
+		for _, path := range paths {
+			ok, err := ss.purge(ctx, p, path)
+			if err != nil {
+				return purged, err
+			}
+			if ok {
+				purged = append(purged, filepath.Join(r.mount, path))
+			}
+		}
+	}
+	return purged, nil
+}
+
+// purge purges the secret at the supplied path, and returns whether it was
+// purged.
+func (ss *SecretStore) purge(ctx context.Context, p purger, path string) (bool, error) {
+	unlock, err := ss.lockPath(ctx, path)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	defer ss.invalidate(path)
+
+	// The secret might have been written again since it was listed, which
+	// the purger checks for while holding the lock.
+	ok, err := p.Purge(path)
+	return ok, errors.Wrapf(err, errPurge, path)
+}
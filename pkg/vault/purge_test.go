@@ -0,0 +1,155 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package kv
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/vault/fake"
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/vault/kv"
+)
+
+// purgingKV is a KVClient that purges secrets with the supplied function.
+type purgingKV struct {
+	*fake.KVClient
+	purge func(path string) (bool, error)
+}
+
+func (c *purgingKV) Purge(path string) (bool, error) { return c.purge(path) }
+
+func TestPurge(t *testing.T) {
+	secrets := func() map[string]*kv.Secret {
+		return map[string]*kv.Secret{
+			"ns/expired":  kv.NewSecret(nil, map[string]string{kv.DeletedAtLabel: "2023-01-01T00:00:00Z"}),
+			"ns/live":     kv.NewSecret(map[string]string{"k": "v"}, nil),
+			"other/stale": kv.NewSecret(nil, map[string]string{kv.DeletedAtLabel: "2023-01-01T00:00:00Z"}),
+		}
+	}
+	// expired purges the secrets marked as deleted.
+	expired := func(s map[string]*kv.Secret) func(path string) (bool, error) {
+		return func(path string) (bool, error) {
+			if _, ok := s[path].CustomMeta[kv.DeletedAtLabel]; !ok {
+				return false, nil
+			}
+			delete(s, path)
+			return true, nil
+		}
+	}
+	type want struct {
+		purged []string
+		remain []string
+		err    error
+	}
+	cases := map[string]struct {
+		reason string
+		client func(s map[string]*kv.Secret) KVClient
+		prefix string
+		want   want
+	}{
+		"NoPurger": {
+			reason: "Should not purge anything if the client does not soft delete secrets with a retention period.",
+			client: func(s map[string]*kv.Secret) KVClient { return memKV(s) },
+			want: want{
+				remain: []string{"ns/expired", "ns/live", "other/stale"},
+			},
+		},
+		"Purged": {
+			reason: "Should purge the expired secrets under the prefix.",
+			client: func(s map[string]*kv.Secret) KVClient {
+				return &purgingKV{KVClient: memKV(s), purge: expired(s)}
+			},
+			prefix: "ns",
+			want: want{
+				purged: []string{"ns/expired"},
+				remain: []string{"ns/live", "other/stale"},
+			},
+		},
+		"PurgeFailed": {
+			reason: "Should return the secrets purged so far if a secret cannot be purged.",
+			client: func(s map[string]*kv.Secret) KVClient {
+				purge := expired(s)
+				return &purgingKV{KVClient: memKV(s), purge: func(path string) (bool, error) {
+					if path == "other/stale" {
+						return false, errBoom
+					}
+					return purge(path)
+				}}
+			},
+			want: want{
+				purged: []string{"ns/expired"},
+				remain: []string{"ns/live", "other/stale"},
+				err:    errors.Wrapf(errBoom, errPurge, "other/stale"),
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			s := secrets()
+			ss := &SecretStore{client: tc.client(s)}
+			purged, err := ss.Purge(context.Background(), tc.prefix)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nss.Purge(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.purged, purged); diff != "" {
+				t.Errorf("\n%s\nss.Purge(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			var remain []string
+			for p := range s {
+				remain = append(remain, p)
+			}
+			if diff := cmp.Diff(tc.want.remain, remain, sortStrings); diff != "" {
+				t.Errorf("\n%s\nss.Purge(...): -want remaining, +got remaining:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestPurgeRoutes(t *testing.T) {
+	deleted := func() *kv.Secret {
+		return kv.NewSecret(nil, map[string]string{kv.DeletedAtLabel: "2023-01-01T00:00:00Z"})
+	}
+	purging := func(s map[string]*kv.Secret) KVClient {
+		return &purgingKV{KVClient: memKV(s), purge: func(path string) (bool, error) {
+			delete(s, path)
+			return true, nil
+		}}
+	}
+	primary := map[string]*kv.Secret{"ns/a": deleted()}
+	tenant := map[string]*kv.Secret{"team/ns/b": deleted()}
+	ss := &SecretStore{client: purging(primary), mount: "secret", routes: []route{
+		{scope: "ns", mount: "tenant", client: purging(tenant)},
+		// Routes to the same mount are only purged once.
+		{scope: "other", mount: "tenant", client: purging(tenant)},
+	}}
+
+	purged, err := ss.Purge(context.Background(), "")
+	if err != nil {
+		t.Fatalf("ss.Purge(...): %v", err)
+	}
+	if diff := cmp.Diff([]string{"secret/ns/a", "tenant/team/ns/b"}, purged); diff != "" {
+		t.Errorf("ss.Purge(...): -want, +got:\n%s", diff)
+	}
+	if len(primary) != 0 || len(tenant) != 0 {
+		t.Errorf("ss.Purge(...): want all routes purged, got %d and %d secrets left", len(primary), len(tenant))
+	}
+}
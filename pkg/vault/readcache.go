@@ -0,0 +1,227 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package kv
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	v1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/crossplane/crossplane-runtime/pkg/connection/store"
+)
+
+// Results of reads through a ReadCache.
+const (
+	readCacheHit       = "hit"
+	readCacheMiss      = "miss"
+	readCacheCoalesced = "coalesced"
+)
+
+// A ReadCache caches secrets read by SecretStores in memory for a bounded
+// time, and coalesces concurrent reads of the same secret. It should be shared
+// between all SecretStores of a replica, so that writes and deletions through
+// any of them invalidate the cached secret. Secrets written through other
+// replicas, or directly to Vault, may be read stale for up to the TTL.
+type ReadCache struct {
+	ttl     time.Duration
+	maxSize int
+
+	mu      sync.Mutex
+	entries map[readCacheKey]*list.Element
+	// order holds the entries from the most to the least recently added,
+	// which, given a fixed TTL, is also the order in which they expire.
+	order *list.List
+	calls map[readCacheKey]*readCall
+}
+
+type readCacheKey struct {
+	config string
+	path   string
+}
+
+type readCacheEntry struct {
+	key     readCacheKey
+	secret  store.Secret
+	expires time.Time
+}
+
+// A readCall is a read in flight, whose result is shared with the concurrent
+// reads of the same secret.
+type readCall struct {
+	done   chan struct{}
+	secret store.Secret
+	err    error
+}
+
+// NewReadCache returns a ReadCache that caches up to the supplied number of
+// secrets for the supplied TTL.
+func NewReadCache(ttl time.Duration, maxSize int) *ReadCache {
+	return &ReadCache{
+		ttl:     ttl,
+		maxSize: maxSize,
+		entries: map[readCacheKey]*list.Element{},
+		order:   list.New(),
+		calls:   map[readCacheKey]*readCall{},
+	}
+}
+
+// WithReadCache configures the SecretStore to cache the secrets it reads with
+// the supplied ReadCache. Secrets read as response-wrapped tokens are never
+// cached, since every token can only be unwrapped once.
+func WithReadCache(c *ReadCache) StoreOption {
+	return func(ss *SecretStore) {
+		ss.reads = c
+	}
+}
+
+// read returns a copy of the cached secret of the supplied config and path in
+// the supplied secret. If it is not cached, it is read with the supplied
+// function, unless a concurrent read of the same secret is in flight, whose
+// result is returned instead.
+func (c *ReadCache) read(ctx context.Context, config, path string, s *store.Secret, fn func(s *store.Secret) error) error {
+	k := readCacheKey{config: config, path: path}
+
+	c.mu.Lock()
+	c.expireLocked(time.Now())
+	if e, ok := c.entries[k]; ok {
+		copySecret(s, &e.Value.(*readCacheEntry).secret)
+		c.mu.Unlock()
+		readCacheRequests.WithLabelValues(config, readCacheHit).Inc()
+		return nil
+	}
+	if call, ok := c.calls[k]; ok {
+		c.mu.Unlock()
+		readCacheRequests.WithLabelValues(config, readCacheCoalesced).Inc()
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if call.err != nil {
+			return call.err
+		}
+		copySecret(s, &call.secret)
+		return nil
+	}
+	call := &readCall{done: make(chan struct{})}
+	c.calls[k] = call
+	c.mu.Unlock()
+	readCacheRequests.WithLabelValues(config, readCacheMiss).Inc()
+
+	call.err = fn(&call.secret)
+
+	c.mu.Lock()
+	// The call was removed if the secret was invalidated while it was in
+	// flight, in which case its result may be stale and is not cached.
+	if c.calls[k] == call {
+		delete(c.calls, k)
+		if call.err == nil {
+			c.addLocked(k, &call.secret, time.Now())
+		}
+	}
+	c.mu.Unlock()
+	close(call.done)
+
+	if call.err != nil {
+		return call.err
+	}
+	copySecret(s, &call.secret)
+	return nil
+}
+
+// invalidate drops the cached secret of the supplied config and path, and
+// prevents reads in flight from caching it.
+func (c *ReadCache) invalidate(config, path string) {
+	k := readCacheKey{config: config, path: path}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[k]; ok {
+		c.removeLocked(e)
+	}
+	delete(c.calls, k)
+}
+
+// InvalidateConfig drops all cached secrets of the supplied config, and
+// prevents reads in flight from caching them.
+func (c *ReadCache) InvalidateConfig(config string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, e := range c.entries {
+		if k.config == config {
+			c.removeLocked(e)
+		}
+	}
+	for k := range c.calls {
+		if k.config == config {
+			delete(c.calls, k)
+		}
+	}
+}
+
+func (c *ReadCache) addLocked(k readCacheKey, s *store.Secret, now time.Time) {
+	if c.maxSize <= 0 {
+		return
+	}
+	if e, ok := c.entries[k]; ok {
+		c.removeLocked(e)
+	}
+	for c.order.Len() >= c.maxSize {
+		c.removeLocked(c.order.Back())
+	}
+	e := &readCacheEntry{key: k, expires: now.Add(c.ttl)}
+	copySecret(&e.secret, s)
+	c.entries[k] = c.order.PushFront(e)
+}
+
+// expireLocked drops the expired secrets, which are the least recently added.
+func (c *ReadCache) expireLocked(now time.Time) {
+	for e := c.order.Back(); e != nil && !now.Before(e.Value.(*readCacheEntry).expires); e = c.order.Back() {
+		c.removeLocked(e)
+	}
+}
+
+// removeLocked drops a cached secret, zeroing its values so that they do not
+// linger in memory until they are garbage collected.
+func (c *ReadCache) removeLocked(e *list.Element) {
+	en := c.order.Remove(e).(*readCacheEntry)
+	delete(c.entries, en.key)
+	for _, v := range en.secret.Data {
+		for i := range v {
+			v[i] = 0
+		}
+	}
+}
+
+// copySecret deep copies the supplied source secret to the supplied
+// destination, so that neither shares values with the cache.
+func copySecret(dst, src *store.Secret) {
+	dst.ScopedName = src.ScopedName
+	dst.Data = nil
+	if src.Data != nil {
+		dst.Data = make(store.KeyValues, len(src.Data))
+		for k, v := range src.Data {
+			dst.Data[k] = append([]byte(nil), v...)
+		}
+	}
+	dst.Metadata = nil
+	if src.Metadata != nil {
+		dst.Metadata = &v1.ConnectionSecretMetadata{}
+		src.Metadata.DeepCopyInto(dst.Metadata)
+	}
+}
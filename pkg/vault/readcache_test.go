@@ -0,0 +1,172 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package kv
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/crossplane/crossplane-runtime/pkg/connection/store"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/vault/kv"
+)
+
+func TestReadCache(t *testing.T) {
+	c := NewReadCache(time.Hour, 2)
+	reads := 0
+	read := func(value string) func(s *store.Secret) error {
+		return func(s *store.Secret) error {
+			reads++
+			s.Data = store.KeyValues{"key": []byte(value)}
+			return nil
+		}
+	}
+
+	s := &store.Secret{}
+	if err := c.read(context.Background(), "vault", "ns/a", s, read("a")); err != nil {
+		t.Fatalf("c.read(...): unexpected error: %v", err)
+	}
+	// Modifying a returned secret must not modify the cached one.
+	s.Data["key"][0] = 'x'
+	s = &store.Secret{}
+	if err := c.read(context.Background(), "vault", "ns/a", s, read("other")); err != nil {
+		t.Fatalf("c.read(...): unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(store.KeyValues{"key": []byte("a")}, s.Data); diff != "" {
+		t.Errorf("c.read(...): want cached secret, -want, +got:\n%s", diff)
+	}
+	if reads != 1 {
+		t.Errorf("c.read(...): want 1 read, got %d", reads)
+	}
+
+	// The least recently added secret is evicted, and zeroed, once the cache
+	// is full.
+	cached := c.entries[readCacheKey{config: "vault", path: "ns/a"}].Value.(*readCacheEntry).secret.Data["key"]
+	_ = c.read(context.Background(), "vault", "ns/b", &store.Secret{}, read("b"))
+	_ = c.read(context.Background(), "vault", "ns/c", &store.Secret{}, read("c"))
+	if _, ok := c.entries[readCacheKey{config: "vault", path: "ns/a"}]; ok {
+		t.Errorf("c.read(...): want least recently added secret evicted")
+	}
+	if diff := cmp.Diff([]byte{0}, cached); diff != "" {
+		t.Errorf("c.read(...): want evicted secret zeroed, -want, +got:\n%s", diff)
+	}
+
+	// Invalidated and expired secrets are read again.
+	reads = 0
+	c.invalidate("vault", "ns/b")
+	_ = c.read(context.Background(), "vault", "ns/b", &store.Secret{}, read("b"))
+	c.InvalidateConfig("vault")
+	_ = c.read(context.Background(), "vault", "ns/b", &store.Secret{}, read("b"))
+	c.mu.Lock()
+	c.expireLocked(time.Now().Add(2 * time.Hour))
+	c.mu.Unlock()
+	_ = c.read(context.Background(), "vault", "ns/b", &store.Secret{}, read("b"))
+	if reads != 3 {
+		t.Errorf("c.read(...): want 3 reads after invalidation and expiry, got %d", reads)
+	}
+}
+
+func TestReadCacheCoalescing(t *testing.T) {
+	c := NewReadCache(time.Hour, 10)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	reads := 0
+	slow := func(s *store.Secret) error {
+		reads++
+		close(started)
+		<-release
+		s.Data = store.KeyValues{"key": []byte("stale")}
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	got := make([]store.KeyValues, 2)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s := &store.Secret{}
+		_ = c.read(context.Background(), "vault", "ns/a", s, slow)
+		got[0] = s.Data
+	}()
+	<-started
+
+	// A concurrent read of the same secret shares the read in flight.
+	coalesced := readCacheRequests.WithLabelValues("vault", readCacheCoalesced)
+	before := testutil.ToFloat64(coalesced)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s := &store.Secret{}
+		_ = c.read(context.Background(), "vault", "ns/a", s, func(_ *store.Secret) error {
+			t.Errorf("c.read(...): want concurrent read coalesced")
+			return nil
+		})
+		got[1] = s.Data
+	}()
+	for testutil.ToFloat64(coalesced) == before {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The secret is written while the read is in flight, so its result must
+	// not be cached.
+	c.invalidate("vault", "ns/a")
+	close(release)
+	wg.Wait()
+
+	want := []store.KeyValues{{"key": []byte("stale")}, {"key": []byte("stale")}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("c.read(...): -want, +got:\n%s", diff)
+	}
+	if reads != 1 {
+		t.Errorf("c.read(...): want 1 read, got %d", reads)
+	}
+	if _, ok := c.entries[readCacheKey{config: "vault", path: "ns/a"}]; ok {
+		t.Errorf("c.read(...): want result of invalidated read not cached")
+	}
+}
+
+func TestReadCacheWriteInvalidates(t *testing.T) {
+	n := store.ScopedName{Scope: "ns", Name: "conn"}
+	secrets := map[string]*kv.Secret{"ns/conn": kv.NewSecret(map[string]string{"key": "old"}, nil)}
+	ss := &SecretStore{client: memKV(secrets), config: "vault", reads: NewReadCache(time.Hour, 10)}
+
+	read := func() store.KeyValues {
+		s := &store.Secret{}
+		if err := ss.ReadKeyValues(context.Background(), n, s); err != nil {
+			t.Fatalf("ss.ReadKeyValues(...): unexpected error: %v", err)
+		}
+		return s.Data
+	}
+	read()
+	if _, err := ss.WriteKeyValues(context.Background(), &store.Secret{ScopedName: n, Data: store.KeyValues{"key": []byte("new")}}); err != nil {
+		t.Fatalf("ss.WriteKeyValues(...): unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(store.KeyValues{"key": []byte("new")}, read()); diff != "" {
+		t.Errorf("ss.ReadKeyValues(...): want written secret, -want, +got:\n%s", diff)
+	}
+	if err := ss.DeleteKeyValues(context.Background(), &store.Secret{ScopedName: n}); err != nil {
+		t.Fatalf("ss.DeleteKeyValues(...): unexpected error: %v", err)
+	}
+	if got := read(); got != nil {
+		t.Errorf("ss.ReadKeyValues(...): want no data after deletion, got %v", got)
+	}
+}
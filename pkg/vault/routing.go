@@ -0,0 +1,263 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package kv
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/hashicorp/vault/api"
+
+	"github.com/crossplane/crossplane-runtime/pkg/connection/store"
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/apis/config/v1alpha1"
+)
+
+const (
+	errNoRoute       = "no route matches secret %q"
+	errRouteTemplate = "cannot parse path template of route %d"
+	errRoutePath     = "cannot render path of secret %q"
+	errRouteScope    = "invalid scope pattern of route %d"
+	errRouteScopes   = "path template of route %d cannot be combined with secret metadata scopes"
+)
+
+// A route is a mount and Vault namespace secrets are stored in, see
+// v1alpha1.VaultRoute.
+type route struct {
+	scope  string
+	labels map[string]string
+	path   *template.Template
+
+	// mount is the mount path of the route, qualified with its Vault
+	// namespace, if any.
+	mount string
+
+	client  KVClient
+	wrapped WrappedKVClient
+}
+
+// pathData is the data of route path templates.
+type pathData struct {
+	Scope string
+	Name  string
+}
+
+// matchesScope returns true if the route matches the scope of the supplied
+// secret.
+func (r *route) matchesScope(n store.ScopedName) bool {
+	if r.scope == "" {
+		return true
+	}
+	ok, _ := path.Match(r.scope, n.Scope)
+	return ok
+}
+
+// matches returns true if the route matches the supplied secret and labels.
+func (r *route) matches(n store.ScopedName, labels map[string]string) bool {
+	if !r.matchesScope(n) {
+		return false
+	}
+	for k, v := range r.labels {
+		if lv, ok := labels[k]; !ok || lv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// secretPath returns the path of the supplied secret in the mount of the
+// route.
+func (r *route) secretPath(n store.ScopedName) (string, error) {
+	if r.path == nil {
+		return filepath.Join(n.Scope, n.Name), nil
+	}
+	b := &strings.Builder{}
+	if err := r.path.Execute(b, pathData{Scope: n.Scope, Name: n.Name}); err != nil {
+		return "", errors.Wrapf(err, errRoutePath, n.Name)
+	}
+	return strings.Trim(filepath.Clean(b.String()), "/"), nil
+}
+
+// scopedName returns the scoped name of the secret at the supplied path of the
+// route, and false if the route templates paths, which cannot be reversed.
+func (r *route) scopedName(p string) (store.ScopedName, bool) {
+	if r.path != nil {
+		return store.ScopedName{}, false
+	}
+	scope, name, ok := strings.Cut(p, "/")
+	if !ok {
+		return store.ScopedName{Name: p}, true
+	}
+	return store.ScopedName{Scope: scope, Name: name}, true
+}
+
+// newRoutes returns the routes of the supplied config. Clients of routes use
+// the supplied Vault client, and the supplied wrapping client if not nil.
+func newRoutes(c, wc *api.Client, spec *v1alpha1.VaultConfigSpec) ([]route, error) {
+	routes := make([]route, len(spec.Routing.Routes))
+	for i, vr := range spec.Routing.Routes {
+		if _, err := path.Match(vr.Scope, ""); err != nil {
+			return nil, errors.Wrapf(err, errRouteScope, i)
+		}
+		ns := spec.Namespace
+		if vr.Namespace != nil {
+			ns = vr.Namespace
+		}
+		r := route{scope: vr.Scope, labels: vr.MatchLabels}
+		if vr.PathTemplate != "" {
+			// Metadata settings are resolved by the scope a path starts
+			// with, which templated paths need not.
+			if sm := spec.SecretMetadata; sm != nil && len(sm.Scopes) > 0 {
+				return nil, errors.Errorf(errRouteScopes, i)
+			}
+			t, err := template.New("path").Option("missingkey=error").Parse(vr.PathTemplate)
+			if err != nil {
+				return nil, errors.Wrapf(err, errRouteTemplate, i)
+			}
+			r.path = t
+		}
+
+		rs := spec.DeepCopy()
+		if vr.MountPath != "" {
+			rs.MountPath = vr.MountPath
+		}
+		r.mount = mountKey(ns, rs.MountPath)
+		rc, rwc := c, wc
+		if vr.Namespace != nil {
+			rc = c.WithNamespace(*vr.Namespace)
+			if wc != nil {
+				rwc = wc.WithNamespace(*vr.Namespace)
+			}
+		}
+		kc, err := newKVClient(rc.Logical(), rs)
+		if err != nil {
+			return nil, err
+		}
+		r.client = kc
+		if rwc != nil {
+			if r.wrapped, err = newKVClient(rwc.Logical(), rs); err != nil {
+				return nil, err
+			}
+		}
+		routes[i] = r
+	}
+	return routes, nil
+}
+
+// mountKey returns the supplied mount path qualified with the supplied Vault
+// namespace, if any.
+func mountKey(ns *string, mountPath string) string {
+	if ns == nil {
+		return strings.Trim(mountPath, "/")
+	}
+	return strings.Trim(path.Join(*ns, mountPath), "/")
+}
+
+// defaultRoute returns the route of secrets not matched by any route, or nil
+// if they are rejected.
+func (ss *SecretStore) defaultRoute() *route {
+	if ss.rejectUnrouted {
+		return nil
+	}
+	return &route{client: ss.client, wrapped: ss.wrapped, mount: ss.mount}
+}
+
+// mountRoutes returns a route of every mount secrets may be written to, the
+// default route first, if any.
+func (ss *SecretStore) mountRoutes() []*route {
+	var routes []*route
+	seen := map[string]bool{}
+	if r := ss.defaultRoute(); r != nil {
+		routes = append(routes, r)
+		seen[r.mount] = true
+	}
+	for i := range ss.routes {
+		r := &ss.routes[i]
+		if !seen[r.mount] {
+			routes = append(routes, r)
+			seen[r.mount] = true
+		}
+	}
+	return routes
+}
+
+// writeRoute returns the route the supplied secret is written to.
+func (ss *SecretStore) writeRoute(n store.ScopedName, labels map[string]string) (*route, error) {
+	for i := range ss.routes {
+		if ss.routes[i].matches(n, labels) {
+			return &ss.routes[i], nil
+		}
+	}
+	if r := ss.defaultRoute(); r != nil {
+		return r, nil
+	}
+	return nil, errors.Errorf(errNoRoute, filepath.Join(n.Scope, n.Name))
+}
+
+// readRoutes returns the routes the supplied secret may have been written
+// to, in order. Reads and deletions carry no labels, so all routes matching
+// the scope of the secret are returned, until the first route without labels,
+// which matches all secrets of the scope.
+func (ss *SecretStore) readRoutes(n store.ScopedName) ([]*route, error) {
+	var routes []*route
+	for i := range ss.routes {
+		r := &ss.routes[i]
+		if !r.matchesScope(n) {
+			continue
+		}
+		routes = append(routes, r)
+		if len(r.labels) == 0 {
+			return routes, nil
+		}
+	}
+	if r := ss.defaultRoute(); r != nil {
+		routes = append(routes, r)
+	}
+	if len(routes) == 0 {
+		return nil, errors.Errorf(errNoRoute, filepath.Join(n.Scope, n.Name))
+	}
+	return routes, nil
+}
+
+// pruneRoutes deletes the supplied secret from all routes it may have been
+// written to other than the supplied path of the supplied route, e.g. before
+// its labels changed, so that reads do not return a stale copy.
+func (ss *SecretStore) pruneRoutes(n store.ScopedName, w *route, wp string) error {
+	if len(ss.routes) == 0 {
+		return nil
+	}
+	routes, err := ss.readRoutes(n)
+	if err != nil {
+		return err
+	}
+	for _, r := range routes {
+		p, err := r.secretPath(n)
+		if err != nil {
+			return err
+		}
+		if r.mount == w.mount && p == wp {
+			continue
+		}
+		if err := ss.deleteFrom(r, p, &store.Secret{ScopedName: n}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
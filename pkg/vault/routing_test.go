@@ -0,0 +1,193 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package kv
+
+import (
+	"context"
+	"testing"
+	"text/template"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	v1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/crossplane/crossplane-runtime/pkg/connection/store"
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/apis/config/v1alpha1"
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/vault/kv"
+)
+
+func TestRouting(t *testing.T) {
+	type want struct {
+		err    error
+		config []string
+		teams  []string
+		prod   []string
+	}
+	cases := map[string]struct {
+		reason string
+		reject bool
+		secret *store.Secret
+		want   want
+	}{
+		"Scope": {
+			reason: "Secrets should be written to the first route matching their scope, at the path of its template.",
+			secret: &store.Secret{ScopedName: store.ScopedName{Scope: "team-a", Name: "conn"}},
+			want:   want{teams: []string{"crossplane/team-a/conn"}},
+		},
+		"Labels": {
+			reason: "Secrets should be written to the first route matching their labels.",
+			secret: &store.Secret{
+				ScopedName: store.ScopedName{Scope: "team-a", Name: "conn"},
+				Metadata:   &v1.ConnectionSecretMetadata{Labels: map[string]string{"env": "prod"}},
+			},
+			want: want{prod: []string{"team-a/conn"}},
+		},
+		"Default": {
+			reason: "Secrets not matched by any route should be written to the mount of the config.",
+			secret: &store.Secret{ScopedName: store.ScopedName{Scope: "infra", Name: "conn"}},
+			want:   want{config: []string{"infra/conn"}},
+		},
+		"Reject": {
+			reason: "Secrets not matched by any route should be rejected if configured.",
+			reject: true,
+			secret: &store.Secret{ScopedName: store.ScopedName{Scope: "infra", Name: "conn"}},
+			want: want{
+				err: errors.Wrap(errors.Errorf(errNoRoute, "infra/conn"), errApply),
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			config := map[string]*kv.Secret{}
+			teams := map[string]*kv.Secret{}
+			prod := map[string]*kv.Secret{}
+			ss := &SecretStore{
+				client: memKV(config),
+				routes: []route{
+					{labels: map[string]string{"env": "prod"}, client: memKV(prod)},
+					{scope: "team-*", path: template.Must(template.New("").Parse("crossplane/{{ .Scope }}/{{ .Name }}")), client: memKV(teams)},
+				},
+				rejectUnrouted: tc.reject,
+			}
+			tc.secret.Data = store.KeyValues{"a": []byte("b")}
+
+			_, err := ss.WriteKeyValues(context.Background(), tc.secret)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nss.WriteKeyValues(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			for n, m := range map[string]struct {
+				want []string
+				got  map[string]*kv.Secret
+			}{"config": {tc.want.config, config}, "teams": {tc.want.teams, teams}, "prod": {tc.want.prod, prod}} {
+				if diff := cmp.Diff(m.want, keysOf(m.got), sortStrings, cmpopts.EquateEmpty()); diff != "" {
+					t.Errorf("\n%s\n%s: -want, +got:\n%s", tc.reason, n, diff)
+				}
+			}
+			if err != nil {
+				return
+			}
+
+			// Reads carry no labels, so they must find the secret in any
+			// route it may have been written to.
+			got := &store.Secret{}
+			if err := ss.ReadKeyValues(context.Background(), tc.secret.ScopedName, got); err != nil {
+				t.Fatalf("\n%s\nss.ReadKeyValues(...): %v", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.secret.Data, got.Data); diff != "" {
+				t.Errorf("\n%s\nss.ReadKeyValues(...): -want, +got:\n%s", tc.reason, diff)
+			}
+
+			if err := ss.DeleteKeyValues(context.Background(), &store.Secret{ScopedName: tc.secret.ScopedName}); err != nil {
+				t.Fatalf("\n%s\nss.DeleteKeyValues(...): %v", tc.reason, err)
+			}
+			if len(config)+len(teams)+len(prod) != 0 {
+				t.Errorf("\n%s\nss.DeleteKeyValues(...): secrets left in config %v, teams %v, prod %v", tc.reason, keysOf(config), keysOf(teams), keysOf(prod))
+			}
+		})
+	}
+}
+
+func TestRoutingLabelsChanged(t *testing.T) {
+	config := map[string]*kv.Secret{}
+	prod := map[string]*kv.Secret{}
+	ss := &SecretStore{
+		client: memKV(config),
+		mount:  "secret",
+		routes: []route{
+			{labels: map[string]string{"env": "prod"}, client: memKV(prod), mount: "prod"},
+		},
+	}
+	n := store.ScopedName{Scope: "team-a", Name: "conn"}
+
+	writes := []struct {
+		labels map[string]string
+		data   string
+		config []string
+		prod   []string
+	}{
+		{labels: map[string]string{"env": "prod"}, data: "first", prod: []string{"team-a/conn"}},
+		{data: "second", config: []string{"team-a/conn"}},
+		{labels: map[string]string{"env": "prod"}, data: "third", prod: []string{"team-a/conn"}},
+	}
+	for i, w := range writes {
+		s := &store.Secret{ScopedName: n, Metadata: &v1.ConnectionSecretMetadata{Labels: w.labels}, Data: store.KeyValues{"a": []byte(w.data)}}
+		if _, err := ss.WriteKeyValues(context.Background(), s); err != nil {
+			t.Fatalf("write %d: ss.WriteKeyValues(...): %v", i, err)
+		}
+		if diff := cmp.Diff(w.config, keysOf(config), cmpopts.EquateEmpty()); diff != "" {
+			t.Errorf("write %d: the secret should only be left in the route of its current labels: config: -want, +got:\n%s", i, diff)
+		}
+		if diff := cmp.Diff(w.prod, keysOf(prod), cmpopts.EquateEmpty()); diff != "" {
+			t.Errorf("write %d: the secret should only be left in the route of its current labels: prod: -want, +got:\n%s", i, diff)
+		}
+
+		got := &store.Secret{}
+		if err := ss.ReadKeyValues(context.Background(), n, got); err != nil {
+			t.Fatalf("write %d: ss.ReadKeyValues(...): %v", i, err)
+		}
+		if diff := cmp.Diff(s.Data, got.Data); diff != "" {
+			t.Errorf("write %d: reads should return the last written values: -want, +got:\n%s", i, diff)
+		}
+	}
+}
+
+func keysOf(m map[string]*kv.Secret) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func TestNewRoutesMetadataScopes(t *testing.T) {
+	spec := &v1alpha1.VaultConfigSpec{
+		MountPath: "secret",
+		SecretMetadata: &v1alpha1.VaultSecretMetadataConfig{
+			Scopes: []v1alpha1.VaultScopedSecretMetadataSettings{{Scope: "team-a"}},
+		},
+		Routing: &v1alpha1.VaultRoutingConfig{Routes: []v1alpha1.VaultRoute{
+			{Scope: "team-*", PathTemplate: "crossplane/{{ .Scope }}/{{ .Name }}"},
+		}},
+	}
+	_, err := newRoutes(nil, nil, spec)
+	if diff := cmp.Diff(errors.Errorf(errRouteScopes, 0), err, test.EquateErrors()); diff != "" {
+		t.Errorf("newRoutes(...): want scoped metadata settings rejected with templated paths, -want error, +got error:\n%s", diff)
+	}
+}
@@ -20,7 +20,11 @@ import (
 	"context"
 	"crypto/x509"
 	"net/http"
+	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
@@ -30,16 +34,18 @@ import (
 
 	v1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
 	"github.com/crossplane/crossplane-runtime/pkg/connection/store"
-	"github.com/crossplane/crossplane-runtime/pkg/connection/store/vault/kv"
 	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
 	"github.com/crossplane/crossplane-runtime/pkg/resource"
 
 	"github.com/crossplane-contrib/ess-plugin-vault/apis/config/v1alpha1"
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/vault/kv"
 )
 
 // Error strings.
 const (
 	errNoConfig            = "no Vault config provided"
+	errPruneRoutes         = "cannot delete secret from previous routes"
 	errNewClient           = "cannot create new client"
 	errExtractCABundle     = "cannot extract ca bundle"
 	errAppendCABundle      = "cannot append ca bundle"
@@ -48,10 +54,27 @@ const (
 	errLoginKubernetesAuth = "cannot logging in with kubernetes auth"
 	errNoTokenProvided     = "token auth configured but no token provided"
 	errNoRoleProvided      = "kubernetes auth configured but no role provided"
+	errReadAgentToken      = "cannot read agent token"
+	errNoDestroyAfter      = "destroy after deletion configured but no duration provided"
+	errNoTransit           = "transit encryption is not configured"
+	errRewrapPath          = "cannot rewrap secret %q"
+	errWrappingConversion  = "response wrapping cannot be combined with transit encryption, key mapping or a JSON or Nested layout"
+
+	// defaultWrapTTL is the TTL of response-wrapping tokens if not
+	// configured otherwise.
+	defaultWrapTTL = 5 * time.Minute
+	// defaultWrappingKey is the key response-wrapping tokens are returned
+	// under if not configured otherwise.
+	defaultWrappingKey = "wrappingToken"
+
+	// defaultMaxCASRetries is the number of times a write rejected because of
+	// a check-and-set conflict is retried if not configured otherwise.
+	defaultMaxCASRetries = 3
 
 	errGet    = "cannot get secret"
 	errApply  = "cannot apply secret"
 	errDelete = "cannot delete secret"
+	errList   = "cannot list secrets under %q"
 )
 
 // KVClient is a Vault AdditiveKVClient Secrets engine client that supports both v1 and v2.
@@ -59,18 +82,91 @@ type KVClient interface {
 	Get(path string, secret *kv.Secret) error
 	Apply(path string, secret *kv.Secret, ao ...kv.ApplyOption) error
 	Delete(path string) error
+	List(path string) ([]string, error)
+}
+
+// WrappedKVClient is a Vault KV Secrets engine client that reads secrets as
+// response-wrapped tokens.
+type WrappedKVClient interface {
+	GetWrapped(path string) (*api.SecretWrapInfo, error)
 }
 
 // SecretStore is a Vault Secret Store.
 type SecretStore struct {
 	client KVClient
+	config string
+	locker *PathLocker
+
+	wrapped     WrappedKVClient
+	wrappingKey string
+
+	transit *transit
+
+	routes         []route
+	rejectUnrouted bool
+	// mount is the mount path of the config, qualified with its Vault
+	// namespace, if any.
+	mount string
+
+	keys   *keyMapping
+	layout layout
+
+	selector *ServerSelector
+	servers  *serverPool
+
+	reads *ReadCache
+
+	mirror       *SecretStore
+	mirrorPolicy v1alpha1.VaultMirrorPolicy
+	readFallback bool
+	logger       logging.Logger
+
+	// tokenExpiry is when the token the store logged in with expires, if
+	// known. Zero if it does not expire or is not managed by the store.
+	tokenExpiry time.Time
+
+	// The following are only used to check the config.
+	vault     *api.Client
+	mountPath string
+	version   v1alpha1.VaultKVVersion
+}
+
+// TokenExpiry returns when the Vault token the SecretStore logged in with
+// expires. It is zero if the token does not expire, or is not obtained by the
+// SecretStore itself, e.g. a static token or one of a Vault Agent.
+func (ss *SecretStore) TokenExpiry() time.Time {
+	return ss.tokenExpiry
+}
+
+// A StoreOption configures a SecretStore.
+type StoreOption func(*SecretStore)
+
+// WithPathLocker configures the SecretStore to serialize mutations of the same
+// secret path with the supplied PathLocker. It should be shared between all
+// SecretStores of a replica.
+func WithPathLocker(l *PathLocker) StoreOption {
+	return func(ss *SecretStore) {
+		ss.locker = l
+	}
+}
+
+// WithStoreLogger configures the SecretStore to log with the supplied logger.
+func WithStoreLogger(l logging.Logger) StoreOption {
+	return func(ss *SecretStore) {
+		ss.logger = l
+	}
 }
 
 // NewVaultStore returns a new Vault SecretStore.
-func NewVaultStore(ctx context.Context, kube client.Client, cfg *v1alpha1.VaultConfig) (*SecretStore, error) { // nolint: gocyclo
+func NewVaultStore(ctx context.Context, kube client.Client, cfg *v1alpha1.VaultConfig, opts ...StoreOption) (*SecretStore, error) { // nolint: gocyclo
 	if cfg.Spec == nil {
 		return nil, errors.New(errNoConfig)
 	}
+	// Wrapped secrets are unwrapped by consumers, which cannot decrypt, rename
+	// or unpack their values.
+	if cfg.Spec.ResponseWrapping != nil && (cfg.Spec.Transit != nil || cfg.Spec.KeyMapping != nil || newLayout(cfg.Spec).packed()) {
+		return nil, errors.New(errWrappingConversion)
+	}
 	vCfg := api.DefaultConfig()
 	vCfg.Address = cfg.Spec.Server
 
@@ -86,6 +182,50 @@ func NewVaultStore(ctx context.Context, kube client.Client, cfg *v1alpha1.VaultC
 		vCfg.HttpClient.Transport.(*http.Transport).TLSClientConfig.RootCAs = pool
 	}
 
+	ss := &SecretStore{
+		config:    cfg.GetName(),
+		mountPath: cfg.Spec.MountPath,
+		mount:     mountKey(cfg.Spec.Namespace, cfg.Spec.MountPath),
+		version:   v1alpha1.VaultKVVersionV2,
+		logger:    logging.NewNopLogger(),
+	}
+	if cfg.Spec.Version != nil {
+		ss.version = *cfg.Spec.Version
+	}
+	if ns := cfg.GetNamespace(); ns != "" {
+		ss.config = ns + "/" + cfg.GetName()
+	}
+	for _, o := range opts {
+		o(ss)
+	}
+
+	if m := cfg.Spec.Mirror; m != nil {
+		if ss.mirror == nil {
+			return nil, errors.New(errNoMirror)
+		}
+		ss.mirrorPolicy = m.Policy
+		ss.readFallback = m.ReadFallback
+	}
+
+	if len(cfg.Spec.Servers) > 0 {
+		if ss.selector == nil {
+			ss.selector = NewServerSelector()
+		}
+		servers := make([]string, len(cfg.Spec.Servers))
+		for i, s := range cfg.Spec.Servers {
+			servers[i] = string(s)
+		}
+		p, err := ss.selector.pool(ss.config, servers, vCfg.HttpClient.Transport)
+		if err != nil {
+			return nil, err
+		}
+		// Requests are sent to the selected server by the transport, so the
+		// address only serves as the base of request urls.
+		vCfg.Address = p.server()
+		vCfg.HttpClient.Transport = &failoverTransport{pool: p, base: vCfg.HttpClient.Transport}
+		ss.servers = p
+	}
+
 	c, err := api.NewClient(vCfg)
 	if err != nil {
 		return nil, errors.Wrap(err, errNewClient)
@@ -128,36 +268,130 @@ func NewVaultStore(ctx context.Context, kube client.Client, cfg *v1alpha1.VaultC
 			return nil, errors.Wrap(err, errSetupKubernetesAuth)
 		}
 
-		_, err = c.Auth().Login(ctx, auth)
+		login, err := c.Auth().Login(ctx, auth)
 		if err != nil {
 			return nil, errors.Wrap(err, errLoginKubernetesAuth)
 		}
+		if login != nil && login.Auth != nil && login.Auth.LeaseDuration > 0 {
+			ss.tokenExpiry = time.Now().Add(time.Duration(login.Auth.LeaseDuration) * time.Second)
+		}
+	case v1alpha1.VaultAuthAgent:
+		// The agent adds its auto-auth token to requests without a token,
+		// so a token from the environment of the plugin must not be sent.
+		c.ClearToken()
+		if a := cfg.Spec.Auth.Agent; a != nil && a.TokenPath != "" {
+			if _, err := os.ReadFile(filepath.Clean(a.TokenPath)); err != nil {
+				return nil, errors.Wrap(err, errReadAgentToken)
+			}
+			c = c.WithRequestCallbacks(agentToken(a.TokenPath))
+		}
 	default:
 		return nil, errors.Errorf("%q is not supported as an auth method", cfg.Spec.Auth.Method)
 	}
 
-	var kvClient KVClient
-	switch *cfg.Spec.Version {
-	case v1alpha1.VaultKVVersionV1:
-		kvClient = kv.NewV1Client(c.Logical(), cfg.Spec.MountPath)
-	case v1alpha1.VaultKVVersionV2:
-		kvClient = kv.NewV2Client(c.Logical(), cfg.Spec.MountPath)
+	kvClient, err := newKVClient(c.Logical(), cfg.Spec)
+	if err != nil {
+		return nil, err
 	}
 
-	return &SecretStore{
-		client: kvClient,
-	}, nil
+	ss.client = kvClient
+	ss.vault = c
+
+	if cfg.Spec.Transit != nil {
+		ss.transit = newTransit(c.Logical(), cfg.Spec.Transit)
+	}
+
+	var wc *api.Client
+	if rw := cfg.Spec.ResponseWrapping; rw != nil {
+		// Wrapping is requested per client, so we need a dedicated client to
+		// keep the reads of read-modify-write cycles unwrapped.
+		wc, err = c.Clone()
+		if err != nil {
+			return nil, errors.Wrap(err, errNewClient)
+		}
+		wc.SetToken(c.Token())
+		if cfg.Spec.Namespace != nil {
+			wc.SetNamespace(*cfg.Spec.Namespace)
+		}
+		if a := cfg.Spec.Auth.Agent; cfg.Spec.Auth.Method == v1alpha1.VaultAuthAgent && a != nil && a.TokenPath != "" {
+			wc = wc.WithRequestCallbacks(agentToken(a.TokenPath))
+		}
+		ttl := defaultWrapTTL
+		if rw.TTL != nil {
+			ttl = rw.TTL.Duration
+		}
+		wc.SetWrappingLookupFunc(func(_, _ string) string {
+			return ttl.String()
+		})
+		if ss.wrapped, err = newKVClient(wc.Logical(), cfg.Spec); err != nil {
+			return nil, err
+		}
+		ss.wrappingKey = defaultWrappingKey
+		if rw.Key != "" {
+			ss.wrappingKey = rw.Key
+		}
+	}
+
+	if ss.keys, err = newKeyMapping(cfg.Spec.KeyMapping); err != nil {
+		return nil, err
+	}
+	ss.layout = newLayout(cfg.Spec)
+	if r := cfg.Spec.Routing; r != nil {
+		if ss.routes, err = newRoutes(c, wc, cfg.Spec); err != nil {
+			return nil, err
+		}
+		ss.rejectUnrouted = r.Default == v1alpha1.VaultRoutingDefaultReject
+	}
+	return ss, nil
 }
 
 // ReadKeyValues reads and returns key value pairs for a given Vault Secret.
-func (ss *SecretStore) ReadKeyValues(_ context.Context, n store.ScopedName, s *store.Secret) error {
+// If configured for response wrapping, the only key value returned is the
+// wrapping token of the Secret, and no metadata is returned.
+func (ss *SecretStore) ReadKeyValues(ctx context.Context, n store.ScopedName, s *store.Secret) error {
+	if ss.reads == nil || ss.wrapped != nil {
+		return ss.readThrough(ctx, n, s)
+	}
+	return ss.reads.read(ctx, ss.config, ss.path(n), s, func(s *store.Secret) error {
+		return ss.readThrough(ctx, n, s)
+	})
+}
+
+// readThrough reads a secret from Vault, falling back to the mirror if
+// configured.
+func (ss *SecretStore) readThrough(ctx context.Context, n store.ScopedName, s *store.Secret) error {
+	err := ss.readKeyValues(n, s)
+	if ss.mirror == nil || !ss.readFallback || !shouldFallback(s, err) {
+		return err
+	}
+	return ss.readMirror(ctx, n, s, err)
+}
+
+func (ss *SecretStore) readKeyValues(n store.ScopedName, s *store.Secret) error {
+	if ss.wrapped != nil {
+		return ss.readWrapped(n, s)
+	}
+
 	kvs := &kv.Secret{}
-	if err := ss.client.Get(ss.path(n), kvs); resource.Ignore(kv.IsNotFound, err) != nil {
+	if _, _, err := ss.get(n, kvs); resource.Ignore(kv.IsNotFound, err) != nil {
 		return errors.Wrap(err, errGet)
 	}
 
 	s.ScopedName = n
-	s.Data = keyValuesFromData(kvs.Data)
+	delete(kvs.CustomMeta, kv.DeletedAtLabel)
+	data := kvs.Data
+	if ss.transit != nil {
+		var err error
+		if data, err = ss.transit.decryptData(n, kvs.Data); err != nil {
+			return err
+		}
+		delete(kvs.CustomMeta, TransitKeyVersionLabel)
+	}
+	kvd, err := ss.keyValues(data)
+	if err != nil {
+		return errors.Wrap(err, errGet)
+	}
+	s.Data = kvd
 	if len(kvs.CustomMeta) > 0 {
 		s.Metadata = &v1.ConnectionSecretMetadata{
 			Labels: kvs.CustomMeta,
@@ -166,33 +400,221 @@ func (ss *SecretStore) ReadKeyValues(_ context.Context, n store.ScopedName, s *s
 	return nil
 }
 
-// WriteKeyValues writes key value pairs to a given Vault Secret.
-func (ss *SecretStore) WriteKeyValues(_ context.Context, s *store.Secret, wo ...store.WriteOption) (changed bool, err error) {
-	ao := applyOptions(wo...)
+// RewrapKeyValues re-encrypts the values of a given Vault Secret with the
+// latest version of the configured Transit key, e.g. after rotating the key,
+// without exposing their plaintext.
+func (ss *SecretStore) RewrapKeyValues(ctx context.Context, n store.ScopedName) error {
+	if ss.transit == nil {
+		return errors.New(errNoTransit)
+	}
+	_, err := ss.rewrap(ctx, n, 0)
+	return err
+}
+
+// Rewrap re-encrypts the values of the secrets under the supplied prefix,
+// which is relative to the mount path, that are encrypted with a version of
+// the Transit key older than the supplied one, or all of them if it is zero.
+// Values that are not encrypted yet, e.g. because they were written before
+// Transit encryption was configured, are always encrypted. It returns the
+// paths of the rewrapped secrets.
+func (ss *SecretStore) Rewrap(ctx context.Context, prefix string, minVersion int) ([]string, error) {
+	if ss.transit == nil {
+		return nil, errors.New(errNoTransit)
+	}
+	paths, err := ss.walk(prefix)
+	if err != nil {
+		return nil, err
+	}
+	var rewrapped []string
+	for _, p := range paths {
+		scope, name, _ := strings.Cut(p, "/")
+		ok, err := ss.rewrap(ctx, store.ScopedName{Scope: scope, Name: name}, minVersion)
+		if kv.IsNotFound(err) {
+			// The secret was deleted since it was listed.
+			continue
+		}
+		if err != nil {
+			return rewrapped, errors.Wrapf(err, errRewrapPath, p)
+		}
+		if ok {
+			rewrapped = append(rewrapped, p)
+		}
+	}
+	return rewrapped, nil
+}
+
+// rewrap rewraps the supplied secret if any of its values is outdated, and
+// returns whether it was rewrapped.
+func (ss *SecretStore) rewrap(ctx context.Context, n store.ScopedName, minVersion int) (bool, error) {
+	unlock, err := ss.lock(ctx, n)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	defer ss.invalidate(ss.path(n))
+
+	s := &kv.Secret{}
+	r, p, err := ss.get(n, s)
+	if err != nil {
+		return false, errors.Wrap(err, errGet)
+	}
+	if len(s.Data) == 0 || (minVersion > 0 && !outdated(s.Data, minVersion)) {
+		return false, nil
+	}
+	if err := ss.transit.rewrap(n, s); err != nil {
+		return false, err
+	}
+	return true, errors.Wrap(r.client.Apply(p, s), errApply)
+}
+
+// get reads the supplied secret from the first of its read routes it exists
+// in, and returns that route and the path of the secret in it. An error that
+// satisfies kv.IsNotFound is returned if it does not exist in any route.
+func (ss *SecretStore) get(n store.ScopedName, s *kv.Secret) (*route, string, error) {
+	routes, err := ss.readRoutes(n)
+	if err != nil {
+		return nil, "", err
+	}
+	err = kv.ErrNotFound
+	for _, r := range routes {
+		p, perr := r.secretPath(n)
+		if perr != nil {
+			return nil, "", perr
+		}
+		if err = r.client.Get(p, s); !kv.IsNotFound(err) {
+			return r, p, err
+		}
+	}
+	return nil, "", err
+}
+
+func (ss *SecretStore) readWrapped(n store.ScopedName, s *store.Secret) error {
+	s.ScopedName = n
+	routes, err := ss.readRoutes(n)
+	if err != nil {
+		return errors.Wrap(err, errGet)
+	}
+	for _, r := range routes {
+		p, err := r.secretPath(n)
+		if err != nil {
+			return errors.Wrap(err, errGet)
+		}
+		wi, err := r.wrapped.GetWrapped(p)
+		if kv.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return errors.Wrap(err, errGet)
+		}
+		s.Data = store.KeyValues{ss.wrappingKey: []byte(wi.Token)}
+		return nil
+	}
+	return nil
+}
+
+// WriteKeyValues writes key value pairs to a given Vault Secret, and mirrors
+// the write if configured.
+func (ss *SecretStore) WriteKeyValues(ctx context.Context, s *store.Secret, wo ...store.WriteOption) (changed bool, err error) {
+	if changed, err = ss.writeKeyValues(ctx, s, wo...); err != nil {
+		return false, err
+	}
+	return changed, ss.mirrorWrite(ctx, s, wo...)
+}
+
+func (ss *SecretStore) writeKeyValues(ctx context.Context, s *store.Secret, wo ...store.WriteOption) (changed bool, err error) {
+	unlock, err := ss.lock(ctx, s.ScopedName)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	defer ss.invalidate(ss.path(s.ScopedName))
+
+	ao := ss.applyOptions(wo...)
 
 	ao = append(ao, kv.AllowUpdateIf(func(current, desired *kv.Secret) bool {
 		return !cmp.Equal(current, desired, cmpopts.EquateEmpty(), cmpopts.IgnoreUnexported(kv.Secret{}))
 	}))
 
-	err = ss.client.Apply(ss.path(s.ScopedName), kv.NewSecret(dataFromKeyValues(s.Data), s.GetLabels()), ao...)
+	r, err := ss.writeRoute(s.ScopedName, s.GetLabels())
+	if err != nil {
+		return false, errors.Wrap(err, errApply)
+	}
+	p, err := r.secretPath(s.ScopedName)
+	if err != nil {
+		return false, errors.Wrap(err, errApply)
+	}
+
+	data, err := ss.data(s.Data)
+	if err != nil {
+		return false, errors.Wrap(err, errApply)
+	}
+	desired := kv.NewSecret(data, s.GetLabels())
+	if ss.transit != nil {
+		current := &kv.Secret{}
+		if err := r.client.Get(p, current); resource.Ignore(kv.IsNotFound, err) != nil {
+			return false, errors.Wrap(err, errGet)
+		}
+		if err := ss.transit.encrypt(s.ScopedName, current, desired); err != nil {
+			return false, err
+		}
+	}
 
+	err = r.client.Apply(p, desired, ao...)
+
+	changed = true
 	if resource.IsNotAllowed(err) {
 		// The update was not allowed because it was a no-op.
-		return false, nil
+		changed, err = false, nil
 	}
 	if err != nil {
 		return false, errors.Wrap(err, errApply)
 	}
-	return true, nil
+	// Copies left behind by a failed pruning are pruned by the next write,
+	// even if it is a no-op.
+	return changed, errors.Wrap(ss.pruneRoutes(s.ScopedName, r, p), errPruneRoutes)
 }
 
 // DeleteKeyValues delete key value pairs from a given Vault Secret.
 // If no kv specified, the whole secret instance is deleted.
 // If kv specified, those would be deleted and secret instance will be deleted
-// only if there is no Data left.
-func (ss *SecretStore) DeleteKeyValues(_ context.Context, s *store.Secret, do ...store.DeleteOption) error {
+// only if there is no Data left. The deletion is mirrored if configured.
+func (ss *SecretStore) DeleteKeyValues(ctx context.Context, s *store.Secret, do ...store.DeleteOption) error {
+	if err := ss.deleteKeyValues(ctx, s, do...); err != nil {
+		return err
+	}
+	return ss.mirrorDelete(ctx, s, do...)
+}
+
+func (ss *SecretStore) deleteKeyValues(ctx context.Context, s *store.Secret, do ...store.DeleteOption) error {
+	unlock, err := ss.lock(ctx, s.ScopedName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	defer ss.invalidate(ss.path(s.ScopedName))
+
+	routes, err := ss.readRoutes(s.ScopedName)
+	if err != nil {
+		return errors.Wrap(err, errDelete)
+	}
+	// A secret whose labels changed may exist in more than one route.
+	for _, r := range routes {
+		p, err := r.secretPath(s.ScopedName)
+		if err != nil {
+			return errors.Wrap(err, errDelete)
+		}
+		if err := ss.deleteFrom(r, p, s, do...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteFrom deletes the supplied keys of the secret at the supplied path of
+// a route.
+func (ss *SecretStore) deleteFrom(r *route, p string, s *store.Secret, do ...store.DeleteOption) error {
 	Secret := &kv.Secret{}
-	err := ss.client.Get(ss.path(s.ScopedName), Secret)
+	err := r.client.Get(p, Secret)
 
 	if kv.IsNotFound(err) {
 		// Secret already deleted, nothing to do.
@@ -208,76 +630,236 @@ func (ss *SecretStore) DeleteKeyValues(_ context.Context, s *store.Secret, do ..
 		}
 	}
 
+	// Packed data is encrypted as a whole, so it must be decrypted to delete
+	// some of its keys.
+	encrypted := ss.transit != nil && ss.layout.packed()
+	data := Secret.Data
+	if encrypted {
+		if data, err = ss.transit.decryptData(s.ScopedName, data); err != nil {
+			return err
+		}
+	}
+	if data, err = ss.layout.unpack(data); err != nil {
+		return errors.Wrap(err, errGet)
+	}
 	for k := range s.Data {
-		delete(Secret.Data, k)
+		if n, ok := ss.keys.toVault(k); ok {
+			delete(data, n)
+		}
 	}
-	if len(s.Data) == 0 || len(Secret.Data) == 0 {
+	if len(s.Data) == 0 || len(data) == 0 {
 		// Secret is deleted only if:
 		// - No kv to delete specified as input
 		// - No data left in the secret
-		return errors.Wrap(ss.client.Delete(ss.path(s.ScopedName)), errDelete)
+		return errors.Wrap(r.client.Delete(p), errDelete)
 	}
 	// If there are still keys left, update the secret with the remaining.
-	return errors.Wrap(ss.client.Apply(ss.path(s.ScopedName), Secret), errApply)
+	packed, err := ss.layout.pack(data)
+	if err != nil {
+		return errors.Wrap(err, errApply)
+	}
+	if encrypted {
+		desired := kv.NewSecret(packed, Secret.CustomMeta)
+		if err := ss.transit.encrypt(s.ScopedName, Secret, desired); err != nil {
+			return err
+		}
+		packed, Secret.CustomMeta = desired.Data, desired.CustomMeta
+	}
+	Secret.Data = packed
+	return errors.Wrap(r.client.Apply(p, Secret), errApply)
+}
+
+type kvClient interface {
+	KVClient
+	WrappedKVClient
+}
+
+func newKVClient(logical kv.LogicalClient, spec *v1alpha1.VaultConfigSpec) (kvClient, error) {
+	if spec.Version != nil && *spec.Version == v1alpha1.VaultKVVersionV1 {
+		return kv.NewV1Client(logical, spec.MountPath), nil
+	}
+	opts, err := v2ClientOptions(spec)
+	if err != nil {
+		return nil, err
+	}
+	return kv.NewV2Client(logical, spec.MountPath, opts...), nil
+}
+
+func v2ClientOptions(spec *v1alpha1.VaultConfigSpec) ([]kv.V2ClientOption, error) {
+	var opts []kv.V2ClientOption
+	if p := spec.DeletionPolicy; p != nil {
+		switch p.Mode {
+		case v1alpha1.VaultDeletionDestroy, "":
+		case v1alpha1.VaultDeletionSoftDelete:
+			opts = append(opts, kv.WithSoftDelete())
+		case v1alpha1.VaultDeletionDestroyAfter:
+			if p.DestroyAfter == nil || p.DestroyAfter.Duration <= 0 {
+				return nil, errors.New(errNoDestroyAfter)
+			}
+			opts = append(opts, kv.WithDestroyAfter(p.DestroyAfter.Duration))
+		default:
+			return nil, errors.Errorf("%q is not supported as a deletion mode", p.Mode)
+		}
+	}
+	if spec.SecretMetadata != nil {
+		opts = append(opts, kv.WithMetadataSettings(metadataSettings(spec.SecretMetadata)))
+	}
+	retries := defaultMaxCASRetries
+	if ws := spec.WriteStrategy; ws != nil {
+		if ws.Patch {
+			opts = append(opts, kv.WithPatch())
+		}
+		if ws.MaxCASRetries != nil {
+			retries = *ws.MaxCASRetries
+		}
+	}
+	opts = append(opts, kv.WithCASRetries(retries))
+	return opts, nil
+}
+
+// metadataSettings returns a function resolving the metadata settings of a
+// secret path, which is "<scope>/<name>", by overriding the defaults with the
+// settings of the first matching scope.
+func metadataSettings(cfg *v1alpha1.VaultSecretMetadataConfig) func(path string) kv.MetadataSettings {
+	return func(path string) kv.MetadataSettings {
+		ms := kv.MetadataSettings{}
+		mergeMetadataSettings(&ms, cfg.VaultSecretMetadataSettings)
+		for _, sc := range cfg.Scopes {
+			if strings.HasPrefix(path, sc.Scope+"/") {
+				mergeMetadataSettings(&ms, sc.VaultSecretMetadataSettings)
+				break
+			}
+		}
+		return ms
+	}
+}
+
+func mergeMetadataSettings(ms *kv.MetadataSettings, s v1alpha1.VaultSecretMetadataSettings) {
+	if s.MaxVersions != nil {
+		ms.MaxVersions = s.MaxVersions
+	}
+	if s.CASRequired != nil {
+		ms.CASRequired = s.CASRequired
+	}
+	if s.DeleteVersionAfter != nil {
+		ms.DeleteVersionAfter = &s.DeleteVersionAfter.Duration
+	}
+}
+
+// lock serializes read-modify-write cycles on the path of the supplied secret,
+// which would otherwise drop the keys written by a concurrent mutation.
+func (ss *SecretStore) lock(ctx context.Context, n store.ScopedName) (unlock func(), err error) {
+	return ss.lockPath(ctx, ss.path(n))
+}
+
+func (ss *SecretStore) lockPath(ctx context.Context, path string) (unlock func(), err error) {
+	if ss.locker == nil {
+		return func() {}, nil
+	}
+	return ss.locker.Lock(ctx, ss.config, path)
+}
+
+// invalidate drops the cached secret at the supplied path, if any. It is
+// called whenever the secret was, or may have been, mutated.
+func (ss *SecretStore) invalidate(path string) {
+	if ss.reads != nil {
+		ss.reads.invalidate(ss.config, path)
+	}
+}
+
+// walk returns the paths of all secrets under the supplied path, which is
+// relative to the mount path, in order.
+func (ss *SecretStore) walk(path string) ([]string, error) {
+	return walkPaths(ss.client, path)
+}
+
+// walkPaths returns the paths of all secrets under the supplied path of the
+// supplied client, in order.
+func walkPaths(c KVClient, path string) ([]string, error) {
+	path = strings.Trim(path, "/")
+	keys, err := c.List(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, errList, path)
+	}
+	sort.Strings(keys)
+
+	var paths []string
+	for _, k := range keys {
+		p := strings.TrimPrefix(path+"/"+k, "/")
+		if !strings.HasSuffix(k, "/") {
+			paths = append(paths, p)
+			continue
+		}
+		sub, err := walkPaths(c, p)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, sub...)
+	}
+	return paths, nil
+}
+
+// Path returns the path of the secret with the supplied name, relative to the
+// mount path.
+func (ss *SecretStore) Path(s store.ScopedName) string {
+	return ss.path(s)
 }
 
 func (ss *SecretStore) path(s store.ScopedName) string {
 	return filepath.Join(s.Scope, s.Name)
 }
 
-func applyOptions(wo ...store.WriteOption) []kv.ApplyOption {
+// agentToken returns a callback that sets the token of a request to the
+// content of the supplied token sink file of a Vault Agent. The file is read
+// for every request, since the agent rewrites it whenever it authenticates
+// again. If it cannot be read, the request is sent without a token.
+func agentToken(path string) api.RequestCallback {
+	return func(r *api.Request) {
+		if t, err := os.ReadFile(filepath.Clean(path)); err == nil {
+			r.ClientToken = strings.TrimSpace(string(t))
+		}
+	}
+}
+
+func (ss *SecretStore) applyOptions(wo ...store.WriteOption) []kv.ApplyOption {
 	ao := make([]kv.ApplyOption, len(wo))
 	for i := range wo {
 		o := wo[i]
 		ao[i] = func(current, desired *kv.Secret) error {
+			ckv, err := ss.keyValues(current.Data)
+			if err != nil {
+				return err
+			}
 			cs := &store.Secret{
 				Metadata: &v1.ConnectionSecretMetadata{
 					Labels: current.CustomMeta,
 				},
-				Data: keyValuesFromData(current.Data),
+				Data: ckv,
 			}
 
+			dkv, err := ss.keyValues(desired.Data)
+			if err != nil {
+				return err
+			}
 			ds := &store.Secret{
 				Metadata: &v1.ConnectionSecretMetadata{
 					Labels: desired.CustomMeta,
 				},
-				Data: keyValuesFromData(desired.Data),
+				Data: dkv,
 			}
 
 			if err := o(context.Background(), cs, ds); err != nil {
 				return err
 			}
+			data, err := ss.data(ds.Data)
+			if err != nil {
+				return err
+			}
 			desired.CustomMeta = ds.GetLabels()
-			desired.Data = dataFromKeyValues(ds.Data)
+			desired.Data = data
 
 			return nil
 		}
 	}
 	return ao
 }
-
-func keyValuesFromData(data map[string]string) store.KeyValues {
-	if len(data) == 0 {
-		return nil
-	}
-	kv := make(store.KeyValues, len(data))
-	for k, v := range data {
-		kv[k] = []byte(v)
-	}
-	return kv
-}
-
-func dataFromKeyValues(kv store.KeyValues) map[string]string {
-	if len(kv) == 0 {
-		return nil
-	}
-
-	data := make(map[string]string, len(kv))
-	for k, v := range kv {
-		// NOTE(turkenh): vault stores values as strings. So we convert []byte
-		// to string before writing to Vault.
-		data[k] = string(v)
-
-	}
-	return data
-}
@@ -0,0 +1,235 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package kv
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/vault/api"
+
+	"github.com/crossplane/crossplane-runtime/pkg/connection/store"
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/apis/config/v1alpha1"
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/vault/fake"
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/vault/kv"
+)
+
+func TestNewVaultStoreAgent(t *testing.T) {
+	// Unix socket paths are limited to about a hundred bytes, which the test
+	// temporary directory may exceed.
+	dir, err := os.MkdirTemp("", "agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) //nolint:errcheck // Test.
+	socket := filepath.Join(dir, "agent.sock")
+	tokenPath := filepath.Join(dir, "token")
+
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var tokens []string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		tokens = append(tokens, r.Header.Get("X-Vault-Token"))
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"data": {"data": {"foo": "bar"}, "metadata": {"version": 1}}}`))
+	}))
+	srv.Listener = l
+	srv.Start()
+	defer srv.Close()
+
+	// A token of the environment must never be sent to the agent.
+	t.Setenv("VAULT_TOKEN", "s.environment")
+
+	cases := map[string]struct {
+		reason string
+		agent  *v1alpha1.VaultAuthAgentConfig
+		tokens []string
+		want   []string
+	}{
+		"AutoAuthToken": {
+			reason: "Requests should be sent without a token if no token path is configured.",
+			want:   []string{"", ""},
+		},
+		"TokenSink": {
+			reason: "Requests should be sent with the current content of the token sink file.",
+			agent:  &v1alpha1.VaultAuthAgentConfig{TokenPath: tokenPath},
+			tokens: []string{"s.first\n", "s.second\n"},
+			want:   []string{"s.first", "s.second"},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			tokens = nil
+			if len(tc.tokens) > 0 {
+				if err := os.WriteFile(tokenPath, []byte(tc.tokens[0]), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			cfg := &v1alpha1.VaultConfig{Spec: &v1alpha1.VaultConfigSpec{
+				Server:    "unix://" + socket,
+				MountPath: "secret",
+				Auth:      v1alpha1.VaultAuthConfig{Method: v1alpha1.VaultAuthAgent, Agent: tc.agent},
+			}}
+			ss, err := NewVaultStore(context.Background(), nil, cfg)
+			if err != nil {
+				t.Fatalf("\n%s\nNewVaultStore(...): %v", tc.reason, err)
+			}
+			for i := range tc.want {
+				if i > 0 && i < len(tc.tokens) {
+					if err := os.WriteFile(tokenPath, []byte(tc.tokens[i]), 0o600); err != nil {
+						t.Fatal(err)
+					}
+				}
+				s := &store.Secret{}
+				if err := ss.ReadKeyValues(context.Background(), store.ScopedName{Name: "foo"}, s); err != nil {
+					t.Fatalf("\n%s\nss.ReadKeyValues(...): %v", tc.reason, err)
+				}
+				if diff := cmp.Diff(store.KeyValues{"foo": []byte("bar")}, s.Data); diff != "" {
+					t.Errorf("\n%s\nss.ReadKeyValues(...): -want, +got:\n%s", tc.reason, diff)
+				}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if diff := cmp.Diff(tc.want, tokens); diff != "" {
+				t.Errorf("\n%s\nX-Vault-Token: -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestNewVaultStoreWrappingConversion(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		spec   func(s *v1alpha1.VaultConfigSpec)
+	}{
+		"Transit": {
+			reason: "Should refuse to wrap secrets consumers cannot decrypt.",
+			spec: func(s *v1alpha1.VaultConfigSpec) {
+				s.Transit = &v1alpha1.VaultTransitConfig{Key: "crossplane"}
+			},
+		},
+		"KeyMapping": {
+			reason: "Should refuse to wrap secrets stored under mapped keys.",
+			spec: func(s *v1alpha1.VaultConfigSpec) {
+				s.KeyMapping = &v1alpha1.VaultKeyMapping{Case: v1alpha1.VaultKeyCaseUpper}
+			},
+		},
+		"Layout": {
+			reason: "Should refuse to wrap secrets stored as a JSON document.",
+			spec: func(s *v1alpha1.VaultConfigSpec) {
+				s.Layout = v1alpha1.VaultSecretLayoutJSON
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cfg := &v1alpha1.VaultConfig{Spec: &v1alpha1.VaultConfigSpec{
+				Server:           "https://vault.acme.org",
+				MountPath:        "secret",
+				ResponseWrapping: &v1alpha1.VaultResponseWrappingConfig{},
+			}}
+			tc.spec(cfg.Spec)
+			_, err := NewVaultStore(context.Background(), nil, cfg)
+			if diff := cmp.Diff(errors.New(errWrappingConversion), err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nNewVaultStore(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestReadKeyValuesWrapped(t *testing.T) {
+	errBoom := errors.New("boom")
+	wrapped := func(tokens map[string]string) *fake.WrappedKVClient {
+		return &fake.WrappedKVClient{GetWrappedFn: func(path string) (*api.SecretWrapInfo, error) {
+			if path == "ns/broken" {
+				return nil, errBoom
+			}
+			t, ok := tokens[path]
+			if !ok {
+				return nil, kv.ErrNotFound
+			}
+			return &api.SecretWrapInfo{Token: t}, nil
+		}}
+	}
+	ss := &SecretStore{
+		wrapped:     wrapped(map[string]string{"ns/default": "s.default", "team-a/routed": "s.default-routed"}),
+		wrappingKey: "token",
+		routes: []route{
+			{scope: "team-*", wrapped: wrapped(map[string]string{"team-a/routed": "s.routed"})},
+		},
+	}
+
+	type want struct {
+		err  error
+		data store.KeyValues
+	}
+	cases := map[string]struct {
+		reason string
+		name   store.ScopedName
+		want
+	}{
+		"Default": {
+			reason: "Should return the wrapping token of an unrouted secret under the wrapping key.",
+			name:   store.ScopedName{Scope: "ns", Name: "default"},
+			want:   want{data: store.KeyValues{"token": []byte("s.default")}},
+		},
+		"Routed": {
+			reason: "Should return the wrapping token read through the route of the secret.",
+			name:   store.ScopedName{Scope: "team-a", Name: "routed"},
+			want:   want{data: store.KeyValues{"token": []byte("s.routed")}},
+		},
+		"NotFound": {
+			reason: "Should return no data if the secret does not exist.",
+			name:   store.ScopedName{Scope: "ns", Name: "missing"},
+			want:   want{},
+		},
+		"Error": {
+			reason: "Should return errors reading the wrapping token.",
+			name:   store.ScopedName{Scope: "ns", Name: "broken"},
+			want:   want{err: errors.Wrap(errBoom, errGet)},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			s := &store.Secret{}
+			err := ss.ReadKeyValues(context.Background(), tc.name, s)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nss.ReadKeyValues(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.data, s.Data); diff != "" {
+				t.Errorf("\n%s\nss.ReadKeyValues(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if s.Metadata != nil {
+				t.Errorf("\n%s\nss.ReadKeyValues(...): want no metadata, got %v", tc.reason, s.Metadata)
+			}
+		})
+	}
+}
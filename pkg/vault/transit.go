@@ -0,0 +1,279 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package kv
+
+import (
+	"encoding/base64"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/crossplane/crossplane-runtime/pkg/connection/store"
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/apis/config/v1alpha1"
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/vault/kv"
+)
+
+const (
+	errEncrypt      = "cannot encrypt secret values"
+	errDecrypt      = "cannot decrypt secret values"
+	errRewrap       = "cannot rewrap secret values"
+	errNoBatch      = "no batch results returned"
+	errBatchResults = "got %d batch results for %d inputs"
+	errDecodeValue  = "cannot decode plaintext"
+
+	defaultTransitMountPath = "transit"
+
+	// TransitKeyVersionLabel is the custom metadata key holding the oldest
+	// version of the Transit key the values of a secret are encrypted with.
+	// It is not returned as a label of the secret.
+	TransitKeyVersionLabel = kv.TransitKeyVersionLabel
+)
+
+// transit encrypts and decrypts secret values with the Vault Transit Secrets
+// Engine.
+// https://developer.hashicorp.com/vault/api-docs/secret/transit
+type transit struct {
+	client    kv.LogicalClient
+	mountPath string
+	key       string
+	derived   bool
+}
+
+func newTransit(c kv.LogicalClient, cfg *v1alpha1.VaultTransitConfig) *transit {
+	t := &transit{
+		client:    c,
+		mountPath: cfg.MountPath,
+		key:       cfg.Key,
+		derived:   cfg.Context == v1alpha1.VaultTransitContextScopedName,
+	}
+	if t.mountPath == "" {
+		t.mountPath = defaultTransitMountPath
+	}
+	return t
+}
+
+// encrypt sets the values of the desired secret to their ciphertexts. The
+// ciphertexts of the current secret are reused for unchanged values, so that
+// applying an unchanged secret is a no-op. Current values that are not
+// encrypted yet are never reused.
+func (t *transit) encrypt(n store.ScopedName, current, desired *kv.Secret) error {
+	existing := make(map[string]string, len(desired.Data))
+	for k := range desired.Data {
+		if ct, ok := current.Data[k]; ok && encrypted(ct) {
+			existing[k] = ct
+		}
+	}
+	plain, err := t.decrypt(n, existing)
+	if err != nil {
+		return err
+	}
+
+	data := make(map[string]string, len(desired.Data))
+	keys := make([]string, 0, len(desired.Data))
+	in := make([]map[string]any, 0, len(desired.Data))
+	for k, v := range desired.Data {
+		if pv, ok := plain[k]; ok && string(pv) == v {
+			data[k] = existing[k]
+			continue
+		}
+		keys = append(keys, k)
+		in = append(in, map[string]any{"plaintext": base64.StdEncoding.EncodeToString([]byte(v))})
+	}
+	out, err := t.batch("encrypt", n, in)
+	if err != nil {
+		return errors.Wrap(err, errEncrypt)
+	}
+	for i, k := range keys {
+		data[k], _ = out[i]["ciphertext"].(string)
+	}
+
+	desired.Data = data
+	desired.CustomMeta = withKeyVersion(desired.CustomMeta, current.Data, data)
+	return nil
+}
+
+// decrypt returns the plaintexts of the supplied ciphertexts. Values that are
+// not encrypted, e.g. because they were written before Transit encryption was
+// configured, are returned as they are.
+func (t *transit) decrypt(n store.ScopedName, data map[string]string) (store.KeyValues, error) {
+	kv := make(store.KeyValues, len(data))
+	keys := make([]string, 0, len(data))
+	in := make([]map[string]any, 0, len(data))
+	for k, ct := range data {
+		if !encrypted(ct) {
+			kv[k] = []byte(ct)
+			continue
+		}
+		keys = append(keys, k)
+		in = append(in, map[string]any{"ciphertext": ct})
+	}
+	out, err := t.batch("decrypt", n, in)
+	if err != nil {
+		return nil, errors.Wrap(err, errDecrypt)
+	}
+	for i, k := range keys {
+		p, _ := out[i]["plaintext"].(string)
+		if kv[k], err = base64.StdEncoding.DecodeString(p); err != nil {
+			return nil, errors.Wrap(err, errDecodeValue)
+		}
+	}
+	return kv, nil
+}
+
+// decryptData returns the plaintexts of the supplied ciphertexts as data.
+func (t *transit) decryptData(n store.ScopedName, data map[string]string) (map[string]string, error) {
+	kv, err := t.decrypt(n, data)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]string, len(kv))
+	for k, v := range kv {
+		out[k] = string(v)
+	}
+	return out, nil
+}
+
+// rewrap re-encrypts the values of the supplied secret with the latest
+// version of the key without exposing their plaintext. Values that are not
+// encrypted yet are encrypted.
+func (t *transit) rewrap(n store.ScopedName, s *kv.Secret) error {
+	var rewrapKeys, encryptKeys []string
+	var rewrapIn, encryptIn []map[string]any
+	for k, v := range s.Data {
+		if encrypted(v) {
+			rewrapKeys = append(rewrapKeys, k)
+			rewrapIn = append(rewrapIn, map[string]any{"ciphertext": v})
+			continue
+		}
+		encryptKeys = append(encryptKeys, k)
+		encryptIn = append(encryptIn, map[string]any{"plaintext": base64.StdEncoding.EncodeToString([]byte(v))})
+	}
+	rewrapped, err := t.batch("rewrap", n, rewrapIn)
+	if err != nil {
+		return errors.Wrap(err, errRewrap)
+	}
+	ciphertexts, err := t.batch("encrypt", n, encryptIn)
+	if err != nil {
+		return errors.Wrap(err, errEncrypt)
+	}
+	data := make(map[string]string, len(s.Data))
+	for i, k := range rewrapKeys {
+		data[k], _ = rewrapped[i]["ciphertext"].(string)
+	}
+	for i, k := range encryptKeys {
+		data[k], _ = ciphertexts[i]["ciphertext"].(string)
+	}
+	s.Data = data
+	s.CustomMeta = withKeyVersion(s.CustomMeta, nil, data)
+	return nil
+}
+
+// batch performs the supplied operation for all inputs with a single request
+// and returns the results in the same order.
+func (t *transit) batch(op string, n store.ScopedName, in []map[string]any) ([]map[string]any, error) {
+	if len(in) == 0 {
+		return nil, nil
+	}
+	if t.derived {
+		c := base64.StdEncoding.EncodeToString([]byte(path.Join(n.Scope, n.Name)))
+		for i := range in {
+			in[i]["context"] = c
+		}
+	}
+	s, err := t.client.Write(path.Join(t.mountPath, op, t.key), map[string]any{"batch_input": in})
+	if err != nil {
+		return nil, err
+	}
+	if s == nil {
+		return nil, errors.New(errNoBatch)
+	}
+	raw, _ := s.Data["batch_results"].([]any)
+	if len(raw) != len(in) {
+		return nil, errors.Errorf(errBatchResults, len(raw), len(in))
+	}
+	out := make([]map[string]any, len(raw))
+	for i := range raw {
+		out[i], _ = raw[i].(map[string]any)
+		if e, ok := out[i]["error"].(string); ok && e != "" {
+			return nil, errors.New(e)
+		}
+	}
+	return out, nil
+}
+
+// withKeyVersion returns a copy of the supplied labels with the oldest key
+// version of the supplied ciphertexts, where the desired ones take precedence.
+func withKeyVersion(labels map[string]string, current, desired map[string]string) map[string]string {
+	oldest := 0
+	for k, ct := range current {
+		if _, ok := desired[k]; !ok {
+			oldest = olderVersion(oldest, keyVersion(ct))
+		}
+	}
+	for _, ct := range desired {
+		oldest = olderVersion(oldest, keyVersion(ct))
+	}
+
+	out := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		out[k] = v
+	}
+	if oldest > 0 {
+		out[TransitKeyVersionLabel] = strconv.Itoa(oldest)
+	}
+	return out
+}
+
+// encrypted returns true if the supplied value is a ciphertext of the Transit
+// Secrets Engine.
+func encrypted(v string) bool {
+	return strings.HasPrefix(v, "vault:v") && keyVersion(v) > 0
+}
+
+// outdated returns true if any of the supplied values is not encrypted, or is
+// encrypted with a version of the key older than the supplied one.
+func outdated(data map[string]string, minVersion int) bool {
+	for _, v := range data {
+		if !encrypted(v) || keyVersion(v) < minVersion {
+			return true
+		}
+	}
+	return false
+}
+
+// keyVersion returns the key version of a ciphertext of the form
+// "vault:v<version>:<ciphertext>", or zero if it cannot be determined.
+func keyVersion(ct string) int {
+	parts := strings.SplitN(ct, ":", 3)
+	if len(parts) != 3 {
+		return 0
+	}
+	v, err := strconv.Atoi(strings.TrimPrefix(parts[1], "v"))
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+func olderVersion(a, b int) int {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
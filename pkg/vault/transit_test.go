@@ -0,0 +1,334 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package kv
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/hashicorp/vault/api"
+
+	"github.com/crossplane/crossplane-runtime/pkg/connection/store"
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	"github.com/crossplane/crossplane-runtime/pkg/test"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/apis/config/v1alpha1"
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/vault/kv"
+	"github.com/crossplane-contrib/ess-plugin-vault/pkg/vault/kv/fake"
+)
+
+func TestTransitEncrypt(t *testing.T) {
+	n := store.ScopedName{Scope: "ns", Name: "conn"}
+	results := func(in []any, fn func(m map[string]any) map[string]any) *api.Secret {
+		out := make([]any, len(in))
+		for i := range in {
+			out[i] = fn(in[i].(map[string]any))
+		}
+		return &api.Secret{Data: map[string]any{"batch_results": out}}
+	}
+	c := &fake.LogicalClient{
+		WriteFn: func(path string, data map[string]any) (*api.Secret, error) {
+			in := make([]any, 0)
+			for _, i := range data["batch_input"].([]map[string]any) {
+				if i["context"] != base64.StdEncoding.EncodeToString([]byte("ns/conn")) {
+					t.Errorf("unexpected context %q", i["context"])
+				}
+				in = append(in, i)
+			}
+			switch path {
+			case "transit/decrypt/key":
+				return results(in, func(m map[string]any) map[string]any {
+					return map[string]any{"plaintext": base64.StdEncoding.EncodeToString([]byte("unchanged"))}
+				}), nil
+			case "transit/encrypt/key":
+				return results(in, func(m map[string]any) map[string]any {
+					return map[string]any{"ciphertext": "vault:v2:" + m["plaintext"].(string)}
+				}), nil
+			}
+			t.Errorf("unexpected write to %q", path)
+			return nil, nil
+		},
+	}
+	tr := newTransit(c, &v1alpha1.VaultTransitConfig{Key: "key", Context: v1alpha1.VaultTransitContextScopedName})
+
+	current := kv.NewSecret(map[string]string{"a": "vault:v1:old", "c": "vault:v1:other"}, nil)
+	desired := kv.NewSecret(map[string]string{"a": "unchanged", "b": "new"}, map[string]string{"foo": "bar"})
+	if err := tr.encrypt(n, current, desired); err != nil {
+		t.Fatalf("tr.encrypt(...): unexpected error: %v", err)
+	}
+
+	want := kv.NewSecret(map[string]string{
+		"a": "vault:v1:old",
+		"b": "vault:v2:" + base64.StdEncoding.EncodeToString([]byte("new")),
+	}, map[string]string{
+		"foo":                  "bar",
+		TransitKeyVersionLabel: "1",
+	})
+	if diff := cmp.Diff(want, desired, cmpopts.IgnoreUnexported(kv.Secret{})); diff != "" {
+		t.Errorf("tr.encrypt(...): -want, +got:\n%s", diff)
+	}
+}
+
+// fakeTransit returns a LogicalClient that "encrypts" values by base64
+// encoding them with the current version of the key.
+func fakeTransit(version *int) *fake.LogicalClient {
+	return &fake.LogicalClient{
+		WriteFn: func(p string, data map[string]any) (*api.Secret, error) {
+			in := data["batch_input"].([]map[string]any)
+			out := make([]any, len(in))
+			for i, m := range in {
+				switch path.Dir(p) {
+				case "transit/encrypt":
+					out[i] = map[string]any{"ciphertext": fmt.Sprintf("vault:v%d:%s", *version, m["plaintext"])}
+				case "transit/decrypt":
+					parts := strings.SplitN(m["ciphertext"].(string), ":", 3)
+					out[i] = map[string]any{"plaintext": parts[2]}
+				case "transit/rewrap":
+					parts := strings.SplitN(m["ciphertext"].(string), ":", 3)
+					out[i] = map[string]any{"ciphertext": fmt.Sprintf("vault:v%d:%s", *version, parts[2])}
+				default:
+					return nil, errors.Errorf("unexpected write to %q", p)
+				}
+			}
+			return &api.Secret{Data: map[string]any{"batch_results": out}}, nil
+		},
+	}
+}
+
+func ciphertext(version int, v string) string {
+	return fmt.Sprintf("vault:v%d:%s", version, base64.StdEncoding.EncodeToString([]byte(v)))
+}
+
+func TestTransitDecrypt(t *testing.T) {
+	n := store.ScopedName{Scope: "ns", Name: "conn"}
+	type want struct {
+		kv  store.KeyValues
+		err error
+	}
+	cases := map[string]struct {
+		reason string
+		client kv.LogicalClient
+		data   map[string]string
+		want   want
+	}{
+		"Encrypted": {
+			reason: "Should return the plaintexts of ciphertexts.",
+			client: fakeTransit(new(int)),
+			data:   map[string]string{"a": ciphertext(1, "one"), "b": ciphertext(2, "two")},
+			want:   want{kv: store.KeyValues{"a": []byte("one"), "b": []byte("two")}},
+		},
+		"NotEncrypted": {
+			reason: "Should return values that are not encrypted yet as they are.",
+			client: &fake.LogicalClient{WriteFn: func(p string, _ map[string]any) (*api.Secret, error) {
+				t.Errorf("unexpected write to %q", p)
+				return nil, nil
+			}},
+			data: map[string]string{"a": "plain", "b": "with:v1:colons"},
+			want: want{kv: store.KeyValues{"a": []byte("plain"), "b": []byte("with:v1:colons")}},
+		},
+		"Mixed": {
+			reason: "Should only decrypt ciphertexts.",
+			client: fakeTransit(new(int)),
+			data:   map[string]string{"a": ciphertext(1, "one"), "b": "plain"},
+			want:   want{kv: store.KeyValues{"a": []byte("one"), "b": []byte("plain")}},
+		},
+		"DecryptFailed": {
+			reason: "Should return an error if values cannot be decrypted.",
+			client: &fake.LogicalClient{WriteFn: func(string, map[string]any) (*api.Secret, error) {
+				return nil, errBoom
+			}},
+			data: map[string]string{"a": ciphertext(1, "one")},
+			want: want{err: errors.Wrap(errBoom, errDecrypt)},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			tr := newTransit(tc.client, &v1alpha1.VaultTransitConfig{Key: "key"})
+			got, err := tr.decrypt(n, tc.data)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\ntr.decrypt(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.kv, got); diff != "" {
+				t.Errorf("\n%s\ntr.decrypt(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestTransitRewrap(t *testing.T) {
+	n := store.ScopedName{Scope: "ns", Name: "conn"}
+	version := 3
+	tr := newTransit(fakeTransit(&version), &v1alpha1.VaultTransitConfig{Key: "key"})
+
+	s := kv.NewSecret(map[string]string{
+		"a": ciphertext(1, "one"),
+		"b": ciphertext(2, "two"),
+		"c": "plain",
+	}, map[string]string{"foo": "bar", TransitKeyVersionLabel: "1"})
+	if err := tr.rewrap(n, s); err != nil {
+		t.Fatalf("tr.rewrap(...): unexpected error: %v", err)
+	}
+
+	want := kv.NewSecret(map[string]string{
+		"a": ciphertext(3, "one"),
+		"b": ciphertext(3, "two"),
+		"c": ciphertext(3, "plain"),
+	}, map[string]string{"foo": "bar", TransitKeyVersionLabel: "3"})
+	if diff := cmp.Diff(want, s, cmpopts.IgnoreUnexported(kv.Secret{})); diff != "" {
+		t.Errorf("tr.rewrap(...): -want, +got:\n%s", diff)
+	}
+}
+
+func TestTransitRoundTrip(t *testing.T) {
+	n := store.ScopedName{Scope: "ns", Name: "conn"}
+	version := 1
+	secrets := map[string]*kv.Secret{
+		// Written before Transit encryption was configured.
+		"ns/conn": kv.NewSecret(map[string]string{"password": "old", "username": "admin"}, nil),
+	}
+	ss := &SecretStore{client: memKV(secrets), transit: newTransit(fakeTransit(&version), &v1alpha1.VaultTransitConfig{Key: "key"})}
+
+	got := &store.Secret{}
+	if err := ss.ReadKeyValues(context.Background(), n, got); err != nil {
+		t.Fatalf("ss.ReadKeyValues(...): unexpected error: %v", err)
+	}
+	want := &store.Secret{ScopedName: n, Data: store.KeyValues{"password": []byte("old"), "username": []byte("admin")}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ss.ReadKeyValues(...): -want plaintext, +got:\n%s", diff)
+	}
+
+	s := &store.Secret{ScopedName: n, Data: store.KeyValues{"password": []byte("new"), "username": []byte("admin")}}
+	if _, err := ss.WriteKeyValues(context.Background(), s); err != nil {
+		t.Fatalf("ss.WriteKeyValues(...): unexpected error: %v", err)
+	}
+	stored := map[string]string{"password": ciphertext(1, "new"), "username": ciphertext(1, "admin")}
+	if diff := cmp.Diff(stored, secrets["ns/conn"].Data); diff != "" {
+		t.Errorf("ss.WriteKeyValues(...): -want stored, +got stored:\n%s", diff)
+	}
+
+	got = &store.Secret{}
+	if err := ss.ReadKeyValues(context.Background(), n, got); err != nil {
+		t.Fatalf("ss.ReadKeyValues(...): unexpected error: %v", err)
+	}
+	want.Data["password"] = []byte("new")
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ss.ReadKeyValues(...): -want, +got:\n%s", diff)
+	}
+}
+
+func TestRewrap(t *testing.T) {
+	secrets := func() map[string]*kv.Secret {
+		return map[string]*kv.Secret{
+			"ns/current": kv.NewSecret(map[string]string{"k": ciphertext(2, "v")}, map[string]string{TransitKeyVersionLabel: "2"}),
+			"ns/old":     kv.NewSecret(map[string]string{"k": ciphertext(1, "v")}, map[string]string{TransitKeyVersionLabel: "1"}),
+			"ns/plain":   kv.NewSecret(map[string]string{"k": "v"}, nil),
+		}
+	}
+	type want struct {
+		rewrapped []string
+		secrets   map[string]*kv.Secret
+		err       error
+	}
+	cases := map[string]struct {
+		reason     string
+		transit    bool
+		minVersion int
+		want       want
+	}{
+		"NoTransit": {
+			reason: "Should fail if Transit encryption is not configured.",
+			want:   want{err: errors.New(errNoTransit)},
+		},
+		"All": {
+			reason:  "Should rewrap all secrets if no minimum version is supplied.",
+			transit: true,
+			want: want{
+				rewrapped: []string{"ns/current", "ns/old", "ns/plain"},
+				secrets: map[string]*kv.Secret{
+					"ns/current": kv.NewSecret(map[string]string{"k": ciphertext(3, "v")}, map[string]string{TransitKeyVersionLabel: "3"}),
+					"ns/old":     kv.NewSecret(map[string]string{"k": ciphertext(3, "v")}, map[string]string{TransitKeyVersionLabel: "3"}),
+					"ns/plain":   kv.NewSecret(map[string]string{"k": ciphertext(3, "v")}, map[string]string{TransitKeyVersionLabel: "3"}),
+				},
+			},
+		},
+		"Outdated": {
+			reason:     "Should only rewrap secrets encrypted with an older key version, or not encrypted at all.",
+			transit:    true,
+			minVersion: 2,
+			want: want{
+				rewrapped: []string{"ns/old", "ns/plain"},
+				secrets: map[string]*kv.Secret{
+					"ns/current": kv.NewSecret(map[string]string{"k": ciphertext(2, "v")}, map[string]string{TransitKeyVersionLabel: "2"}),
+					"ns/old":     kv.NewSecret(map[string]string{"k": ciphertext(3, "v")}, map[string]string{TransitKeyVersionLabel: "3"}),
+					"ns/plain":   kv.NewSecret(map[string]string{"k": ciphertext(3, "v")}, map[string]string{TransitKeyVersionLabel: "3"}),
+				},
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			s := secrets()
+			version := 3
+			ss := &SecretStore{client: memKV(s)}
+			if tc.transit {
+				ss.transit = newTransit(fakeTransit(&version), &v1alpha1.VaultTransitConfig{Key: "key"})
+			}
+			rewrapped, err := ss.Rewrap(context.Background(), "", tc.minVersion)
+			if diff := cmp.Diff(tc.want.err, err, test.EquateErrors()); diff != "" {
+				t.Errorf("\n%s\nss.Rewrap(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.rewrapped, rewrapped); diff != "" {
+				t.Errorf("\n%s\nss.Rewrap(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if tc.want.secrets == nil {
+				tc.want.secrets = secrets()
+			}
+			if diff := cmp.Diff(tc.want.secrets, s, cmpopts.IgnoreUnexported(kv.Secret{})); diff != "" {
+				t.Errorf("\n%s\nss.Rewrap(...): -want secrets, +got secrets:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRewrapKeyValues(t *testing.T) {
+	n := store.ScopedName{Scope: "ns", Name: "conn"}
+	version := 2
+	secrets := map[string]*kv.Secret{
+		"ns/conn": kv.NewSecret(map[string]string{"k": ciphertext(2, "v")}, map[string]string{TransitKeyVersionLabel: "2"}),
+	}
+	ss := &SecretStore{client: memKV(secrets), transit: newTransit(fakeTransit(&version), &v1alpha1.VaultTransitConfig{Key: "key"})}
+
+	version = 3
+	if err := ss.RewrapKeyValues(context.Background(), n); err != nil {
+		t.Fatalf("ss.RewrapKeyValues(...): unexpected error: %v", err)
+	}
+	want := kv.NewSecret(map[string]string{"k": ciphertext(3, "v")}, map[string]string{TransitKeyVersionLabel: "3"})
+	if diff := cmp.Diff(want, secrets["ns/conn"], cmpopts.IgnoreUnexported(kv.Secret{})); diff != "" {
+		t.Errorf("ss.RewrapKeyValues(...): -want, +got:\n%s", diff)
+	}
+
+	err := ss.RewrapKeyValues(context.Background(), store.ScopedName{Scope: "ns", Name: "missing"})
+	if !kv.IsNotFound(err) {
+		t.Errorf("ss.RewrapKeyValues(...): want not found error, got %v", err)
+	}
+}
@@ -0,0 +1,329 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+// Package webhook contains the validating admission webhooks of Vault
+// configurations.
+package webhook
+
+import (
+	"context"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	v1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/crossplane/crossplane-runtime/pkg/errors"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/apis/config/v1alpha1"
+)
+
+// Webhook paths.
+const (
+	VaultConfigPath           = "/validate-secrets-crossplane-io-v1alpha1-vaultconfig"
+	VaultNamespacedConfigPath = "/validate-secrets-crossplane-io-v1alpha1-vaultnamespacedconfig"
+)
+
+const errUnexpectedType = "unexpected type %T"
+
+// Setup registers the validating webhooks with the supplied server.
+func Setup(s *webhook.Server) {
+	s.Register(VaultConfigPath, admission.WithCustomValidator(&v1alpha1.VaultConfig{}, &validator{}))
+	s.Register(VaultNamespacedConfigPath, admission.WithCustomValidator(&v1alpha1.VaultNamespacedConfig{}, &validator{}))
+}
+
+// validator validates VaultConfigs and VaultNamespacedConfigs.
+type validator struct{}
+
+func (v *validator) ValidateCreate(_ context.Context, obj runtime.Object) error {
+	return validate(obj)
+}
+
+func (v *validator) ValidateUpdate(_ context.Context, _, obj runtime.Object) error {
+	return validate(obj)
+}
+
+func (v *validator) ValidateDelete(_ context.Context, _ runtime.Object) error {
+	return nil
+}
+
+func validate(obj runtime.Object) error {
+	var errs field.ErrorList
+	var gk schema.GroupKind
+	var o client.Object
+	var spec *v1alpha1.VaultConfigSpec
+	switch c := obj.(type) {
+	case *v1alpha1.VaultConfig:
+		gk, o, spec = schema.GroupKind{Group: v1alpha1.Group, Kind: v1alpha1.VaultConfigKind}, c, c.Spec
+		errs = ValidateSpec(c.Spec, field.NewPath("spec"))
+	case *v1alpha1.VaultNamespacedConfig:
+		gk, o, spec = schema.GroupKind{Group: v1alpha1.Group, Kind: v1alpha1.VaultNamespacedConfigKind}, c, c.Spec
+		errs = ValidateSpec(c.Spec, field.NewPath("spec"))
+		errs = append(errs, ValidateNamespacedCredentials(c.GetNamespace(), c.Spec, field.NewPath("spec"))...)
+	default:
+		return errors.Errorf(errUnexpectedType, obj)
+	}
+	if spec != nil && spec.Mirror != nil && spec.Mirror.Name == o.GetName() {
+		errs = append(errs, field.Invalid(field.NewPath("spec", "mirror", "name"), spec.Mirror.Name, "a config cannot mirror to itself"))
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return kerrors.NewInvalid(gk, o.GetName(), errs)
+}
+
+// ValidateSpec returns the field errors of the supplied spec, which would
+// otherwise only be reported when the plugin uses the configuration.
+func ValidateSpec(spec *v1alpha1.VaultConfigSpec, p *field.Path) field.ErrorList {
+	if spec == nil {
+		return field.ErrorList{field.Required(p, "")}
+	}
+
+	var errs field.ErrorList
+	switch {
+	case len(spec.Servers) == 0:
+		if !isHTTPURL(spec.Server) && !isUnixURL(spec.Server) {
+			errs = append(errs, field.Invalid(p.Child("server"), spec.Server, "must be an http, https or unix URL"))
+		}
+	case spec.Server != "":
+		errs = append(errs, field.Forbidden(p.Child("servers"), "cannot be set together with server"))
+	default:
+		for i, s := range spec.Servers {
+			if !isHTTPURL(string(s)) {
+				errs = append(errs, field.Invalid(p.Child("servers").Index(i), s, "must be an http or https URL"))
+			}
+		}
+	}
+	if strings.HasPrefix(spec.MountPath, "/") {
+		errs = append(errs, field.Invalid(p.Child("mountPath"), spec.MountPath, "must not start with a slash"))
+	}
+	if spec.MountPath == "" {
+		errs = append(errs, field.Required(p.Child("mountPath"), ""))
+	}
+	if v := spec.Version; v != nil && *v != v1alpha1.VaultKVVersionV1 && *v != v1alpha1.VaultKVVersionV2 {
+		errs = append(errs, field.NotSupported(p.Child("version"), *v, []string{string(v1alpha1.VaultKVVersionV1), string(v1alpha1.VaultKVVersionV2)}))
+	}
+
+	ap := p.Child("auth")
+	switch spec.Auth.Method {
+	case v1alpha1.VaultAuthToken:
+		if spec.Auth.Token == nil {
+			errs = append(errs, field.Required(ap.Child("token"), "required for Token auth"))
+		}
+	case v1alpha1.VaultAuthKubernetes:
+		if spec.Auth.Kubernetes == nil {
+			errs = append(errs, field.Required(ap.Child("kubernetes"), "required for Kubernetes auth"))
+		} else if spec.Auth.Kubernetes.Role == "" {
+			errs = append(errs, field.Required(ap.Child("kubernetes", "role"), ""))
+		}
+	case v1alpha1.VaultAuthAgent:
+		if a := spec.Auth.Agent; a != nil && a.TokenPath != "" && !filepath.IsAbs(a.TokenPath) {
+			errs = append(errs, field.Invalid(ap.Child("agent", "tokenPath"), a.TokenPath, "must be an absolute path"))
+		}
+	default:
+		errs = append(errs, field.NotSupported(ap.Child("method"), spec.Auth.Method, []string{string(v1alpha1.VaultAuthToken), string(v1alpha1.VaultAuthKubernetes), string(v1alpha1.VaultAuthAgent)}))
+	}
+
+	if dp := spec.DeletionPolicy; dp != nil && dp.Mode == v1alpha1.VaultDeletionDestroyAfter && (dp.DestroyAfter == nil || dp.DestroyAfter.Duration <= 0) {
+		errs = append(errs, field.Required(p.Child("deletionPolicy", "destroyAfter"), "a positive duration is required for DestroyAfter mode"))
+	}
+	if t := spec.Transit; t != nil && t.Key == "" {
+		errs = append(errs, field.Required(p.Child("transit", "key"), ""))
+	}
+	if spec.ResponseWrapping != nil && (spec.Transit != nil || spec.KeyMapping != nil || spec.Layout == v1alpha1.VaultSecretLayoutJSON || spec.Layout == v1alpha1.VaultSecretLayoutNested) {
+		errs = append(errs, field.Forbidden(p.Child("responseWrapping"), "cannot be combined with transit, keyMapping or the JSON and Nested layouts"))
+	}
+	if m := spec.Mirror; m != nil {
+		if m.Name == "" {
+			errs = append(errs, field.Required(p.Child("mirror", "name"), ""))
+		}
+		if m.Policy != "" && m.Policy != v1alpha1.VaultMirrorBestEffort && m.Policy != v1alpha1.VaultMirrorStrict {
+			errs = append(errs, field.NotSupported(p.Child("mirror", "policy"), m.Policy, []string{string(v1alpha1.VaultMirrorBestEffort), string(v1alpha1.VaultMirrorStrict)}))
+		}
+	}
+	if r := spec.Routing; r != nil {
+		errs = append(errs, validateRouting(r, p.Child("routing"))...)
+		if sm := spec.SecretMetadata; sm != nil && len(sm.Scopes) > 0 && templatesPaths(r) {
+			errs = append(errs, field.Forbidden(p.Child("secretMetadata", "scopes"), "cannot be combined with routes with a pathTemplate, since settings are resolved by the scope a path starts with"))
+		}
+	}
+	if km := spec.KeyMapping; km != nil {
+		errs = append(errs, validateKeyMapping(km, p.Child("keyMapping"))...)
+	}
+	if l := spec.Layout; l != "" && l != v1alpha1.VaultSecretLayoutFlat && l != v1alpha1.VaultSecretLayoutJSON && l != v1alpha1.VaultSecretLayoutNested {
+		errs = append(errs, field.NotSupported(p.Child("layout"), l, []string{string(v1alpha1.VaultSecretLayoutFlat), string(v1alpha1.VaultSecretLayoutJSON), string(v1alpha1.VaultSecretLayoutNested)}))
+	}
+	if rl := spec.RateLimit; rl != nil {
+		if rl.Burst > 0 && rl.RequestsPerSecond == 0 {
+			errs = append(errs, field.Invalid(p.Child("rateLimit", "burst"), rl.Burst, "requires requestsPerSecond"))
+		}
+		if rl.QueueTimeout != nil && rl.QueueTimeout.Duration <= 0 {
+			errs = append(errs, field.Invalid(p.Child("rateLimit", "queueTimeout"), rl.QueueTimeout.Duration.String(), "must be positive"))
+		}
+	}
+	// KV v1 secrets store their metadata under keys with this prefix.
+	if strings.HasPrefix(spec.LayoutKey, "metadata:") {
+		errs = append(errs, field.Invalid(p.Child("layoutKey"), spec.LayoutKey, "must not start with metadata:"))
+	}
+	return errs
+}
+
+func validateKeyMapping(km *v1alpha1.VaultKeyMapping, p *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if km.Case != "" && km.Case != v1alpha1.VaultKeyCaseNone && km.Case != v1alpha1.VaultKeyCaseUpper && km.Case != v1alpha1.VaultKeyCaseLower {
+		errs = append(errs, field.NotSupported(p.Child("case"), km.Case, []string{string(v1alpha1.VaultKeyCaseNone), string(v1alpha1.VaultKeyCaseUpper), string(v1alpha1.VaultKeyCaseLower)}))
+	}
+	keys := make([]string, 0, len(km.Rename))
+	for k := range km.Rename {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	renamed := map[string]bool{}
+	for _, k := range keys {
+		n := km.Rename[k]
+		switch {
+		case n == "":
+			errs = append(errs, field.Required(p.Child("rename").Key(k), ""))
+		case renamed[n]:
+			errs = append(errs, field.Duplicate(p.Child("rename").Key(k), n))
+		}
+		renamed[n] = true
+	}
+	errs = append(errs, validatePatterns(km.Include, p.Child("include"))...)
+	errs = append(errs, validatePatterns(km.Exclude, p.Child("exclude"))...)
+	return errs
+}
+
+func validatePatterns(patterns []string, p *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	for i, pt := range patterns {
+		if _, err := path.Match(pt, ""); err != nil {
+			errs = append(errs, field.Invalid(p.Index(i), pt, err.Error()))
+		}
+	}
+	return errs
+}
+
+func validateRouting(r *v1alpha1.VaultRoutingConfig, p *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if len(r.Routes) == 0 {
+		errs = append(errs, field.Required(p.Child("routes"), ""))
+	}
+	if r.Default != "" && r.Default != v1alpha1.VaultRoutingDefaultConfig && r.Default != v1alpha1.VaultRoutingDefaultReject {
+		errs = append(errs, field.NotSupported(p.Child("default"), r.Default, []string{string(v1alpha1.VaultRoutingDefaultConfig), string(v1alpha1.VaultRoutingDefaultReject)}))
+	}
+	for i, route := range r.Routes {
+		rp := p.Child("routes").Index(i)
+		if _, err := path.Match(route.Scope, ""); err != nil {
+			errs = append(errs, field.Invalid(rp.Child("scope"), route.Scope, err.Error()))
+		}
+		if strings.HasPrefix(route.MountPath, "/") {
+			errs = append(errs, field.Invalid(rp.Child("mountPath"), route.MountPath, "must not start with a slash"))
+		}
+		if route.PathTemplate != "" {
+			if _, err := template.New("").Parse(route.PathTemplate); err != nil {
+				errs = append(errs, field.Invalid(rp.Child("pathTemplate"), route.PathTemplate, err.Error()))
+			}
+		}
+	}
+	return errs
+}
+
+// templatesPaths returns true if any route templates the paths of secrets.
+func templatesPaths(r *v1alpha1.VaultRoutingConfig) bool {
+	for _, route := range r.Routes {
+		if route.PathTemplate != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// isUnixURL returns true if the supplied string is the url of a unix socket,
+// e.g. "unix:///var/run/vault/agent.sock".
+func isUnixURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme == "unix" && u.Host == "" && filepath.IsAbs(u.Path)
+}
+
+// ValidateNamespacedCredentials returns the field errors of credentials of a
+// namespaced config, which can only be sourced from Secrets in its namespace.
+// The plugin enforces them whether or not the webhook is enabled.
+func ValidateNamespacedCredentials(ns string, spec *v1alpha1.VaultConfigSpec, p *field.Path) field.ErrorList {
+	if spec == nil {
+		return nil
+	}
+	type credentials struct {
+		path      *field.Path
+		source    v1.CredentialsSource
+		selectors v1.CommonCredentialSelectors
+	}
+	var creds []credentials
+	if ca := spec.CABundle; ca != nil {
+		creds = append(creds, credentials{path: p.Child("caBundle"), source: ca.Source, selectors: ca.CommonCredentialSelectors})
+	}
+	if t := spec.Auth.Token; t != nil {
+		creds = append(creds, credentials{path: p.Child("auth", "token"), source: t.Source, selectors: t.CommonCredentialSelectors})
+	}
+
+	var errs field.ErrorList
+	// The agent and its socket authenticate requests with the identity of
+	// the plugin, not of the tenant.
+	if spec.Auth.Method == v1alpha1.VaultAuthAgent {
+		errs = append(errs, field.NotSupported(p.Child("auth", "method"), spec.Auth.Method, []string{string(v1alpha1.VaultAuthToken), string(v1alpha1.VaultAuthKubernetes)}))
+	}
+	// The Vault client connects to any address with this prefix over a unix
+	// socket, even if it is not a valid URL.
+	if strings.HasPrefix(spec.Server, "unix://") {
+		errs = append(errs, field.Invalid(p.Child("server"), spec.Server, "must be an http or https URL for namespaced configs"))
+	}
+	if k := spec.Auth.Kubernetes; k != nil {
+		kp := p.Child("auth", "kubernetes", "serviceAccountTokenSource")
+		if k.ServiceAccountTokenSource == nil {
+			errs = append(errs, field.Required(kp, "required for namespaced configs"))
+		} else {
+			creds = append(creds, credentials{path: kp, source: k.ServiceAccountTokenSource.Source, selectors: k.ServiceAccountTokenSource.CommonCredentialSelectors})
+		}
+	}
+	for _, c := range creds {
+		if c.source != v1.CredentialsSourceSecret {
+			errs = append(errs, field.NotSupported(c.path.Child("source"), c.source, []string{string(v1.CredentialsSourceSecret)}))
+			continue
+		}
+		if c.selectors.SecretRef == nil {
+			errs = append(errs, field.Required(c.path.Child("secretRef"), ""))
+			continue
+		}
+		if n := c.selectors.SecretRef.Namespace; n != "" && n != ns {
+			errs = append(errs, field.Invalid(c.path.Child("secretRef", "namespace"), n, "must be the namespace of the config"))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,218 @@
+/*
+ Copyright 2023 The Crossplane Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package webhook
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	v1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+
+	"github.com/crossplane-contrib/ess-plugin-vault/apis/config/v1alpha1"
+)
+
+func TestValidateSpec(t *testing.T) {
+	p := field.NewPath("spec")
+	v3 := v1alpha1.VaultKVVersion("v3")
+	valid := func() *v1alpha1.VaultConfigSpec {
+		return &v1alpha1.VaultConfigSpec{
+			Server:    "https://vault.acme.org",
+			MountPath: "secret/",
+			Auth: v1alpha1.VaultAuthConfig{
+				Method: v1alpha1.VaultAuthToken,
+				Token:  &v1alpha1.VaultAuthTokenConfig{Source: v1.CredentialsSourceFilesystem},
+			},
+		}
+	}
+	cases := map[string]struct {
+		reason string
+		spec   func(s *v1alpha1.VaultConfigSpec)
+		want   field.ErrorList
+	}{
+		"Valid": {
+			reason: "Should not return errors for a valid spec.",
+			spec:   func(s *v1alpha1.VaultConfigSpec) {},
+		},
+		"InvalidSpec": {
+			reason: "Should return field errors for all invalid fields.",
+			spec: func(s *v1alpha1.VaultConfigSpec) {
+				s.Server = "vault.acme.org"
+				s.MountPath = "/secret"
+				s.Version = &v3
+				s.Auth.Token = nil
+				s.DeletionPolicy = &v1alpha1.VaultDeletionPolicy{Mode: v1alpha1.VaultDeletionDestroyAfter}
+				s.Mirror = &v1alpha1.VaultMirrorConfig{Policy: "Sometimes"}
+			},
+			want: field.ErrorList{
+				field.Invalid(p.Child("server"), "vault.acme.org", ""),
+				field.Invalid(p.Child("mountPath"), "/secret", ""),
+				field.NotSupported(p.Child("version"), v3, nil),
+				field.Required(p.Child("auth", "token"), ""),
+				field.Required(p.Child("deletionPolicy", "destroyAfter"), ""),
+				field.Required(p.Child("mirror", "name"), ""),
+				field.NotSupported(p.Child("mirror", "policy"), "Sometimes", nil),
+			},
+		},
+		"Servers": {
+			reason: "Should validate every server of a list.",
+			spec: func(s *v1alpha1.VaultConfigSpec) {
+				s.Server = ""
+				s.Servers = []v1alpha1.VaultServerURL{"https://vault-a.acme.org", "vault-b.acme.org"}
+			},
+			want: field.ErrorList{
+				field.Invalid(p.Child("servers").Index(1), "vault-b.acme.org", ""),
+			},
+		},
+		"ServerAndServers": {
+			reason: "Should not allow both a server and a list of servers.",
+			spec: func(s *v1alpha1.VaultConfigSpec) {
+				s.Servers = []v1alpha1.VaultServerURL{"https://vault-a.acme.org"}
+			},
+			want: field.ErrorList{
+				field.Forbidden(p.Child("servers"), ""),
+			},
+		},
+		"KubernetesAuthWithoutRole": {
+			reason: "Should require a role for Kubernetes auth.",
+			spec: func(s *v1alpha1.VaultConfigSpec) {
+				s.Auth = v1alpha1.VaultAuthConfig{
+					Method:     v1alpha1.VaultAuthKubernetes,
+					Kubernetes: &v1alpha1.VaultAuthKubernetesConfig{},
+				}
+				s.DeletionPolicy = &v1alpha1.VaultDeletionPolicy{Mode: v1alpha1.VaultDeletionDestroyAfter, DestroyAfter: &metav1.Duration{Duration: 1}}
+			},
+			want: field.ErrorList{
+				field.Required(p.Child("auth", "kubernetes", "role"), ""),
+			},
+		},
+		"AgentSocket": {
+			reason: "Should allow an agent listening on a unix socket.",
+			spec: func(s *v1alpha1.VaultConfigSpec) {
+				s.Server = "unix:///var/run/vault/agent.sock"
+				s.Auth = v1alpha1.VaultAuthConfig{
+					Method: v1alpha1.VaultAuthAgent,
+					Agent:  &v1alpha1.VaultAuthAgentConfig{TokenPath: "/var/run/vault/token"},
+				}
+			},
+		},
+		"AgentRelativeTokenPath": {
+			reason: "Should require the agent token path to be absolute.",
+			spec: func(s *v1alpha1.VaultConfigSpec) {
+				s.Server = "unix://agent.sock"
+				s.Auth = v1alpha1.VaultAuthConfig{
+					Method: v1alpha1.VaultAuthAgent,
+					Agent:  &v1alpha1.VaultAuthAgentConfig{TokenPath: "token"},
+				}
+			},
+			want: field.ErrorList{
+				field.Invalid(p.Child("server"), "unix://agent.sock", ""),
+				field.Invalid(p.Child("auth", "agent", "tokenPath"), "token", ""),
+			},
+		},
+		"Routing": {
+			reason: "Should validate every route.",
+			spec: func(s *v1alpha1.VaultConfigSpec) {
+				s.Routing = &v1alpha1.VaultRoutingConfig{
+					Routes: []v1alpha1.VaultRoute{
+						{Scope: "team-*", MountPath: "teams", PathTemplate: "{{ .Scope }}/{{ .Name }}"},
+						{Scope: "[", MountPath: "/prod", PathTemplate: "{{ .Scope"},
+					},
+				}
+			},
+			want: field.ErrorList{
+				field.Invalid(p.Child("routing", "routes").Index(1).Child("scope"), "[", ""),
+				field.Invalid(p.Child("routing", "routes").Index(1).Child("mountPath"), "/prod", ""),
+				field.Invalid(p.Child("routing", "routes").Index(1).Child("pathTemplate"), "{{ .Scope", ""),
+			},
+		},
+		"MetadataScopesWithPathTemplate": {
+			reason: "Should not allow scoped metadata settings with templated paths, which need not start with the scope.",
+			spec: func(s *v1alpha1.VaultConfigSpec) {
+				s.SecretMetadata = &v1alpha1.VaultSecretMetadataConfig{
+					Scopes: []v1alpha1.VaultScopedSecretMetadataSettings{{Scope: "team-a"}},
+				}
+				s.Routing = &v1alpha1.VaultRoutingConfig{Routes: []v1alpha1.VaultRoute{
+					{Scope: "team-*", PathTemplate: "crossplane/{{ .Scope }}/{{ .Name }}"},
+				}}
+			},
+			want: field.ErrorList{
+				field.Forbidden(p.Child("secretMetadata", "scopes"), ""),
+			},
+		},
+		"KeyMapping": {
+			reason: "Should require unique names and valid patterns.",
+			spec: func(s *v1alpha1.VaultConfigSpec) {
+				s.KeyMapping = &v1alpha1.VaultKeyMapping{
+					Rename:  map[string]string{"password": "SECRET", "token": "SECRET", "username": ""},
+					Case:    "Title",
+					Exclude: []string{"attribute.*", "["},
+				}
+			},
+			want: field.ErrorList{
+				field.NotSupported(p.Child("keyMapping", "case"), "Title", nil),
+				field.Duplicate(p.Child("keyMapping", "rename").Key("token"), "SECRET"),
+				field.Required(p.Child("keyMapping", "rename").Key("username"), ""),
+				field.Invalid(p.Child("keyMapping", "exclude").Index(1), "[", ""),
+			},
+		},
+		"Layout": {
+			reason: "Should require a supported layout and a layout key not clashing with KV v1 metadata.",
+			spec: func(s *v1alpha1.VaultConfigSpec) {
+				s.Layout = "YAML"
+				s.LayoutKey = "metadata:connection"
+			},
+			want: field.ErrorList{
+				field.NotSupported(p.Child("layout"), "YAML", nil),
+				field.Invalid(p.Child("layoutKey"), "metadata:connection", ""),
+			},
+		},
+		"ResponseWrappingConversion": {
+			reason: "Should not allow response wrapping together with conversions consumers cannot undo.",
+			spec: func(s *v1alpha1.VaultConfigSpec) {
+				s.ResponseWrapping = &v1alpha1.VaultResponseWrappingConfig{}
+				s.Layout = v1alpha1.VaultSecretLayoutJSON
+			},
+			want: field.ErrorList{
+				field.Forbidden(p.Child("responseWrapping"), ""),
+			},
+		},
+		"RateLimit": {
+			reason: "Should require a rate for bursts and a positive queue timeout.",
+			spec: func(s *v1alpha1.VaultConfigSpec) {
+				s.RateLimit = &v1alpha1.VaultRateLimit{Burst: 10, QueueTimeout: &metav1.Duration{}}
+			},
+			want: field.ErrorList{
+				field.Invalid(p.Child("rateLimit", "burst"), 10, ""),
+				field.Invalid(p.Child("rateLimit", "queueTimeout"), "0s", ""),
+			},
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			s := valid()
+			tc.spec(s)
+			got := ValidateSpec(s, p)
+			if diff := cmp.Diff(tc.want, got, cmpopts.EquateEmpty(), cmpopts.IgnoreFields(field.Error{}, "Detail", "BadValue")); diff != "" {
+				t.Errorf("\n%s\nValidateSpec(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}